@@ -0,0 +1,144 @@
+package cassette
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/communication"
+	"github.com/schoeppi5/libts/middleware"
+)
+
+// redacted replaces the values of sensitive args (see middleware.Sensitive) in recorded requests
+const redacted = "***"
+
+// Entry is a single line of a cassette (JSONL)
+// Either Request (with Response or Error) or Notification is set
+type Entry struct {
+	Request      *Request                  `json:"request,omitempty"`
+	Response     string                    `json:"response,omitempty"`
+	Error        *communication.QueryError `json:"error,omitempty"`
+	Failure      string                    `json:"failure,omitempty"` // errors not sent by teamspeak (e.g. connection lost)
+	Notification string                    `json:"notification,omitempty"`
+}
+
+// Request is the recorded form of a libts.Request
+// Args are stored like they are sent to teamspeak: every value as string and lists as multiple values
+type Request struct {
+	ServerID int                 `json:"sid,omitempty"`
+	Command  string              `json:"command"`
+	Args     map[string][]string `json:"args,omitempty"`
+}
+
+// NewRequest converts r
+func NewRequest(r libts.Request) *Request {
+	req := &Request{
+		ServerID: r.ServerID,
+		Command:  r.Command,
+	}
+	params := r.Ordered()
+	if len(params.Pairs) == 0 && len(params.Records) == 0 && len(params.Flags) == 0 {
+		return req
+	}
+	req.Args = map[string][]string{}
+	for _, a := range params.Pairs {
+		req.Args[a.Key] = append(req.Args[a.Key], fmt.Sprint(a.Value))
+	}
+	for _, record := range params.Records {
+		for _, a := range record {
+			req.Args[a.Key] = append(req.Args[a.Key], fmt.Sprint(a.Value))
+		}
+	}
+	for _, f := range params.Flags {
+		req.Args[string(f)] = []string{""}
+	}
+	return req
+}
+
+// redact replaces the values of all sensitive args, so they aren't written to a cassette
+func (r *Request) redact() *Request {
+	for k, v := range r.Args {
+		if !middleware.Sensitive[k] {
+			continue
+		}
+		for i := range v {
+			v[i] = redacted
+		}
+	}
+	return r
+}
+
+// Match returns true, if r and other are the same request
+// Args are compared as set, their order doesn't matter. Redacted values of r match any value
+func (r *Request) Match(other *Request) bool {
+	if r.ServerID != other.ServerID || r.Command != other.Command || len(r.Args) != len(other.Args) {
+		return false
+	}
+	for k, v := range r.Args {
+		o, ok := other.Args[k]
+		if !ok || len(v) != len(o) {
+			return false
+		}
+		for i := range v {
+			if v[i] != o[i] && v[i] != redacted {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// String returns r in serverquery form with sorted args
+func (r *Request) String() string {
+	keys := make([]string, 0, len(r.Args))
+	for k := range r.Args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fields := []string{r.Command}
+	for _, k := range keys {
+		for _, v := range r.Args[k] {
+			fields = append(fields, k+"="+v)
+		}
+	}
+	s := strings.Join(fields, " ")
+	if r.ServerID != 0 {
+		s = fmt.Sprintf("(sid %d) %s", r.ServerID, s)
+	}
+	return s
+}
+
+// err returns the recorded error of e
+func (e Entry) err() error {
+	if e.Error != nil {
+		return communication.ResponseError(*e.Error)
+	}
+	if e.Failure != "" {
+		return errors.New(e.Failure)
+	}
+	return nil
+}
+
+// Read all entries of a cassette
+func Read(r io.Reader) ([]Entry, error) {
+	entries := []Entry{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024) // responses can be large (e.g. logview)
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		e := Entry{}
+		err := json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", len(entries)+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,230 @@
+package cassette_test
+
+import (
+	"bytes"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/cassette"
+	"github.com/schoeppi5/libts/communication"
+	"github.com/schoeppi5/libts/query"
+	"github.com/schoeppi5/libts/serverquery"
+	"github.com/schoeppi5/libts/subscriber"
+	"github.com/schoeppi5/libts/tstest"
+)
+
+func connect(t *testing.T, s *tstest.Server) *serverquery.ServerQuery {
+	addr, err := s.ListenTelnet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, p, _ := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(p)
+	sq, err := serverquery.NewServerQuery(host, port, "serveradmin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sq.Close)
+	return sq
+}
+
+// scenario uses q like an application would
+func scenario(q libts.Query) ([]query.Channel, error) {
+	a := query.Agent{Query: q}
+	_, err := a.Query.DoRaw(libts.Request{
+		ServerID: 1,
+		Command:  "channelcreate",
+		Args:     map[string]interface{}{"channel_name": "Lobby", "channel_topic": "Hello there"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a.ChannelList(1)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	t.Parallel()
+	// given
+	s := tstest.NewServer()
+	defer s.Close()
+	path := filepath.Join(t.TempDir(), "channels.jsonl")
+	r, err := cassette.Create(connect(t, s), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := scenario(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.DoRaw(libts.Request{ServerID: 1, Command: "channelinfo", Args: map[string]interface{}{"cid": 42}})
+	if err == nil {
+		t.Fatal("expected invalid channel")
+	}
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []cassette.Mode{cassette.Strict, cassette.Lenient} {
+		p, err := cassette.Load(path, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// when
+		have, err := scenario(p)
+		_, qerr := p.DoRaw(libts.Request{ServerID: 1, Command: "channelinfo", Args: map[string]interface{}{"cid": 42}})
+
+		// then
+		if err != nil {
+			t.Fatalf("Test %s failed!\n\tUnexpected error: %s", t.Name(), err)
+		}
+		if len(have) != len(want) || have[1].Name != "Lobby" || have[1].Topic != "Hello there" {
+			t.Errorf("Test %s failed!\n\tHave: %+v\n\tWant: %+v", t.Name(), have, want)
+		}
+		if e, ok := qerr.(communication.QueryError); !ok || e.ID != 768 {
+			t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %s", t.Name(), qerr, "invalid channelID")
+		}
+		if unplayed := p.Unplayed(); len(unplayed) != 0 {
+			t.Errorf("Test %s failed!\n\tUnplayed: %v", t.Name(), unplayed)
+		}
+	}
+}
+
+func TestRecordRedactsPasswords(t *testing.T) {
+	t.Parallel()
+	// given
+	login := func(password string) libts.Request {
+		return libts.Request{Command: "login", Args: map[string]interface{}{"client_login_name": "serveradmin", "client_login_password": password}}
+	}
+	buf := &bytes.Buffer{}
+	r := cassette.NewRecorder(cassette.NewPlayer([]cassette.Entry{{Request: cassette.NewRequest(login("secret"))}}, cassette.Strict), buf)
+	if _, err := r.DoRaw(login("secret")); err != nil {
+		t.Fatal(err)
+	}
+	recorded := buf.String()
+	entries, err := cassette.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := cassette.NewPlayer(entries, cassette.Strict)
+
+	// when
+	_, err = p.DoRaw(login("other"))
+
+	// then
+	if strings.Contains(recorded, "secret") {
+		t.Errorf("Test %s failed!\n\tSecret recorded: %s", t.Name(), recorded)
+	}
+	if err != nil {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), err, nil)
+	}
+}
+
+func TestStrictOrder(t *testing.T) {
+	t.Parallel()
+	// given
+	p := cassette.NewPlayer([]cassette.Entry{
+		{Request: &cassette.Request{Command: "version"}, Response: "version=3"},
+		{Request: &cassette.Request{Command: "whoami"}, Response: "client_id=1"},
+	}, cassette.Strict)
+
+	// when
+	_, err := p.DoRaw(libts.Request{Command: "whoami"})
+
+	// then
+	if _, ok := err.(cassette.MismatchError); !ok {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %s", t.Name(), err, "MismatchError")
+	}
+}
+
+func TestLenientOrder(t *testing.T) {
+	t.Parallel()
+	// given
+	p := cassette.NewPlayer([]cassette.Entry{
+		{Request: &cassette.Request{Command: "version"}, Response: "version=3"},
+		{Request: &cassette.Request{Command: "whoami"}, Response: "client_id=1"},
+	}, cassette.Lenient)
+
+	// when
+	first, err1 := p.DoRaw(libts.Request{Command: "whoami"})
+	second, err2 := p.DoRaw(libts.Request{Command: "whoami"})
+	_, err3 := p.DoRaw(libts.Request{Command: "clientlist"})
+
+	// then
+	if err1 != nil || err2 != nil || string(first) != "client_id=1" || string(second) != "client_id=1" {
+		t.Errorf("Test %s failed!\n\tHave: %s, %s (%v, %v)\n\tWant: %s", t.Name(), first, second, err1, err2, "client_id=1")
+	}
+	if _, ok := err3.(cassette.MismatchError); !ok {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %s", t.Name(), err3, "MismatchError")
+	}
+}
+
+func TestArgsAreASet(t *testing.T) {
+	t.Parallel()
+	// given
+	recorded := cassette.NewRequest(libts.Request{
+		Command: "clientinfo",
+		Args:    map[string]interface{}{"clid": []int{1, 2}, "a": "b c", "-flag": ""},
+	})
+
+	// when
+	have := cassette.NewRequest(libts.Request{
+		Command: "clientinfo",
+		Args:    map[string]interface{}{"-flag": "", "a": "b c", "clid": []int{1, 2}},
+	})
+
+	// then
+	if !recorded.Match(have) {
+		t.Errorf("Test %s failed!\n\tHave: %s\n\tWant: %s", t.Name(), have, recorded)
+	}
+	if recorded.Match(cassette.NewRequest(libts.Request{Command: "clientinfo", Args: map[string]interface{}{"clid": []int{2, 1}}})) {
+		t.Errorf("Test %s failed!\n\tDifferent args must not match", t.Name())
+	}
+}
+
+func TestReplayNotifications(t *testing.T) {
+	t.Parallel()
+	// given
+	s := tstest.NewServer()
+	defer s.Close()
+	buf := &bytes.Buffer{}
+	r := cassette.NewRecorder(connect(t, s), buf)
+	record := func(q libts.Query) chan interface{} {
+		c := make(chan interface{}, 1)
+		a := subscriber.Agent{Subscriber: communication.NewBasicSubscriber(q, 1)}
+		if _, err := a.ClientJoinedServer(c); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	c := record(r)
+	s.Connect(1, &tstest.Client{Nickname: "Alice"})
+	select {
+	case <-c:
+	case <-time.After(time.Second):
+		t.Fatal("no notification recorded")
+	}
+	r.Close()
+	entries, err := cassette.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// when
+	c = record(cassette.NewPlayer(entries, cassette.Strict))
+
+	// then
+	select {
+	case e := <-c:
+		if event, ok := e.(*subscriber.ClientEnterViewEvent); !ok || event.Nickname != "Alice" {
+			t.Errorf("Test %s failed!\n\tHave: %+v\n\tWant: %s", t.Name(), e, "Alice")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Test %s failed!\n\tNo notification replayed", t.Name())
+	}
+}
@@ -0,0 +1,181 @@
+package cassette
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/communication"
+)
+
+// Mode of request matching
+type Mode int
+
+const (
+	// Strict requires the requests in the recorded order
+	Strict Mode = iota
+	// Lenient serves the first unplayed matching entry regardless of the order
+	// Once all matching entries are played, the last one is served again
+	Lenient
+)
+
+// MismatchError is returned by a Player for requests not found on the cassette
+type MismatchError struct {
+	Request *Request
+	// Want is the next recorded request (only in Strict mode)
+	Want *Request
+}
+
+func (me MismatchError) Error() string {
+	if me.Want == nil {
+		return fmt.Sprintf("cassette: no recording for %s", me.Request)
+	}
+	return fmt.Sprintf("cassette: unexpected request %s, want %s", me.Request, me.Want)
+}
+
+// Player serves the recordings of a cassette without a server
+// A Player implements libts.Query
+// Recorded notifications are sent once the request recorded before them was played
+type Player struct {
+	mode    Mode
+	entries []Entry
+	notify  chan []byte
+
+	lock   sync.Mutex
+	played []bool
+	next   int // next entry in Strict mode
+}
+
+// NewPlayer serves entries
+func NewPlayer(entries []Entry, mode Mode) *Player {
+	p := &Player{
+		mode:    mode,
+		entries: entries,
+		notify:  make(chan []byte, len(entries)), // never blocks
+		played:  make([]bool, len(entries)),
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.notifications(-1) // notifications before the first request
+	return p
+}
+
+// Load the cassette file path
+func Load(path string, mode Mode) (*Player, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := Read(f)
+	if err != nil {
+		return nil, err
+	}
+	return NewPlayer(entries, mode), nil
+}
+
+// Do plays request and attempts to parse the recorded response in value
+func (p *Player) Do(request libts.Request, value interface{}) error {
+	return p.DoContext(context.Background(), request, value)
+}
+
+// DoRaw plays request and returns the recorded response
+func (p *Player) DoRaw(request libts.Request) ([]byte, error) {
+	return p.DoRawContext(context.Background(), request)
+}
+
+// DoContext plays request and attempts to parse the recorded response in value
+func (p *Player) DoContext(ctx context.Context, request libts.Request, value interface{}) error {
+	raw, err := p.DoRawContext(ctx, request)
+	if err != nil {
+		return err
+	}
+	return communication.Unmarshal(raw, value)
+}
+
+// DoRawContext plays request and returns the recorded response
+func (p *Player) DoRawContext(ctx context.Context, request libts.Request) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	req := NewRequest(request)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	i, err := p.find(req)
+	if err != nil {
+		return nil, err
+	}
+	first := !p.played[i]
+	p.played[i] = true
+	if first {
+		p.notifications(i)
+	}
+	e := p.entries[i]
+	if e.Response == "" {
+		return nil, e.err()
+	}
+	return []byte(e.Response), e.err()
+}
+
+// Notification returns the recorded notifications
+func (p *Player) Notification() <-chan []byte {
+	return p.notify
+}
+
+// Connected always returns true
+func (p *Player) Connected() (bool, error) {
+	return true, nil
+}
+
+// Unplayed returns the recorded requests, that were not requested yet
+func (p *Player) Unplayed() []Request {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	unplayed := []Request{}
+	for i, e := range p.entries {
+		if e.Request != nil && !p.played[i] {
+			unplayed = append(unplayed, *e.Request)
+		}
+	}
+	return unplayed
+}
+
+// find the entry to play for req. p.lock must be held
+func (p *Player) find(req *Request) (int, error) {
+	if p.mode == Strict {
+		for p.next < len(p.entries) && p.entries[p.next].Request == nil {
+			p.next++
+		}
+		if p.next >= len(p.entries) {
+			return 0, MismatchError{Request: req}
+		}
+		if !p.entries[p.next].Request.Match(req) {
+			return 0, MismatchError{Request: req, Want: p.entries[p.next].Request}
+		}
+		p.next++
+		return p.next - 1, nil
+	}
+	last := -1
+	for i, e := range p.entries {
+		if e.Request == nil || !e.Request.Match(req) {
+			continue
+		}
+		if !p.played[i] {
+			return i, nil
+		}
+		last = i
+	}
+	if last < 0 {
+		return 0, MismatchError{Request: req}
+	}
+	return last, nil
+}
+
+// notifications sends the notifications recorded directly after entry i. p.lock must be held
+func (p *Player) notifications(i int) {
+	for j := i + 1; j < len(p.entries) && p.entries[j].Request == nil; j++ {
+		p.notify <- []byte(p.entries[j].Notification)
+	}
+}
@@ -0,0 +1,137 @@
+package cassette
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/communication"
+)
+
+// Recorder wraps a libts.Query and writes every request with its response and all notifications to a cassette
+// A Recorder implements libts.Query itself
+type Recorder struct {
+	query  libts.Query
+	closer io.Closer
+
+	lock    sync.Mutex
+	encoder *json.Encoder
+	err     error // first write error
+
+	notifyOnce sync.Once
+	notify     chan []byte
+}
+
+// NewRecorder records all requests to q in w
+func NewRecorder(q libts.Query, w io.Writer) *Recorder {
+	return &Recorder{
+		query:   q,
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// Create records all requests to q in the cassette file path
+func Create(q libts.Query, path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r := NewRecorder(q, f)
+	r.closer = f
+	return r, nil
+}
+
+// Close the cassette file and return the first error while writing it
+// The wrapped query is not closed
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closer != nil {
+		err := r.closer.Close()
+		if r.err == nil {
+			r.err = err
+		}
+	}
+	return r.err
+}
+
+// Do executes request, records it and attempts to parse the response in value
+func (r *Recorder) Do(request libts.Request, value interface{}) error {
+	return r.DoContext(context.Background(), request, value)
+}
+
+// DoRaw executes request, records it and returns the raw response
+func (r *Recorder) DoRaw(request libts.Request) ([]byte, error) {
+	return r.DoRawContext(context.Background(), request)
+}
+
+// DoContext executes request, records it and attempts to parse the response in value
+func (r *Recorder) DoContext(ctx context.Context, request libts.Request, value interface{}) error {
+	raw, err := r.DoRawContext(ctx, request)
+	if err != nil {
+		return err
+	}
+	return communication.Unmarshal(raw, value)
+}
+
+// DoRawContext executes request, records it and returns the raw response
+// Requests aborted by ctx are not recorded. Sensitive args (see middleware.Sensitive) are recorded as ***
+func (r *Recorder) DoRawContext(ctx context.Context, request libts.Request) ([]byte, error) {
+	data, err := r.query.DoRawContext(ctx, request)
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return data, err
+	}
+	e := Entry{
+		Request:  NewRequest(request).redact(),
+		Response: string(data),
+	}
+	var qe communication.QueryError
+	if errors.As(err, &qe) {
+		e.Error = &qe
+	} else if err != nil {
+		e.Failure = err.Error()
+	}
+	r.write(e)
+	return data, err
+}
+
+// Notification records and passes through the notifications of the wrapped query
+func (r *Recorder) Notification() <-chan []byte {
+	r.notifyOnce.Do(func() {
+		in := r.query.Notification()
+		if in == nil {
+			return
+		}
+		r.notify = make(chan []byte, cap(in))
+		go r.forward(in)
+	})
+	return r.notify
+}
+
+// Connected passes through to the wrapped query without recording
+func (r *Recorder) Connected() (bool, error) {
+	return r.query.Connected()
+}
+
+func (r *Recorder) forward(in <-chan []byte) {
+	defer close(r.notify)
+	for n := range in {
+		r.write(Entry{
+			Notification: string(n),
+		})
+		r.notify <- n
+	}
+}
+
+func (r *Recorder) write(e Entry) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	err := r.encoder.Encode(e)
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+}
@@ -0,0 +1,271 @@
+package communication
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// This file contains the decoder for the tokenized responses
+// It supports the mapstructure tags, encoding.TextUnmarshaler, time.Time and time.Duration (see time.go) and the weak typing of mapstructure (e.g. "1" -> true)
+// The fields of every struct type are looked up once and cached
+
+// plan contains the decodable fields of a struct type
+type plan struct {
+	fields map[string]*fieldPlan // by mapstructure tag or field name
+	folded map[string]*fieldPlan // by lower case name, mapstructure matches field names case insensitive as well
+}
+
+// fieldPlan describes how to set a single struct field
+type fieldPlan struct {
+	name  string
+	kind  string // used in errors, empty for TextUnmarshaler
+	index int
+	set   setFunc
+}
+
+// setFunc parses s and sets v to the result
+type setFunc func(v reflect.Value, s string) error
+
+// plans caches the plan of each struct type (reflect.Type -> *plan)
+// Types with fields the decoder can't set are stored as nil and decoded by mapstructure
+var plans sync.Map
+
+var textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// DecodeFields decodes the fields of a single record to v
+// For duplicate keys, the last value is used
+func DecodeFields(f Fields, v interface{}, opts ...DecodeOption) error {
+	o := DecodeOptions{}.Apply(opts...)
+	u := newUnmapped(o)
+	return u.finish(o, decodeFields(f, v, u))
+}
+
+// decodeFields decodes f to v and collects the unmapped fields in u
+func decodeFields(f Fields, v interface{}, u *unmapped) error {
+	p, ok := planOf(v)
+	if !ok {
+		return decodeMap(f.Map(), v, u)
+	}
+	u.of(v)
+	target := reflect.ValueOf(v).Elem()
+	var errs []string
+	for i := range f {
+		if err := p.decode(target, f[i].Key, f[i].Value, u); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	return decodeError(errs)
+}
+
+// decodeError returns errs in the form of mapstructure, nil without errors
+func decodeError(errs []string) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &mapstructure.Error{Errors: errs}
+}
+
+// planOf returns the plan for v, if v is a pointer to a supported struct
+func planOf(v interface{}) (*plan, bool) {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil, false
+	}
+	t = t.Elem()
+	if p, ok := plans.Load(t); ok {
+		return p.(*plan), p.(*plan) != nil
+	}
+	p := newPlan(t)
+	plans.Store(t, p)
+	return p, p != nil
+}
+
+// newPlan looks up the fields of struct t
+// It returns nil, if any field can't be decoded from a string
+func newPlan(t reflect.Type) *plan {
+	p := &plan{
+		fields: map[string]*fieldPlan{},
+		folded: map[string]*fieldPlan{},
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" { // unexported
+			continue
+		}
+		name := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		set := setter(field.Type, unitOf(field))
+		if set == nil {
+			return nil
+		}
+		f := &fieldPlan{name: name, kind: kindName(field.Type), index: i, set: set}
+		p.fields[name] = f
+		p.folded[strings.ToLower(name)] = f
+	}
+	return p
+}
+
+// decode sets the field matching key of v to s
+// Unknown keys are ignored (and collected in u)
+func (p *plan) decode(v reflect.Value, key, s string, u *unmapped) error {
+	f, ok := p.fields[key]
+	if !ok {
+		if f, ok = p.folded[strings.ToLower(key)]; !ok {
+			u.addUnmapped(key)
+			return nil
+		}
+	}
+	field := v.Field(f.index)
+	err := f.set(field, s)
+	if err == nil {
+		if u != nil && f.kind != "" && lossy(field, s) {
+			u.addLossy(key)
+		}
+		return nil
+	}
+	if f.kind == "" {
+		return fmt.Errorf("error decoding '%s': %s", f.name, err)
+	}
+	return fmt.Errorf("cannot parse '%s' as %s: %s", f.name, f.kind, err)
+}
+
+// kindName returns the kind of t as named in the errors of mapstructure
+// Types decoded as a whole (TextUnmarshaler, time.Time and time.Duration) have no kind
+func kindName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr && !reflect.PtrTo(t).Implements(textUnmarshaler) {
+		t = t.Elem()
+	}
+	if t == timeType || t == durationType || reflect.PtrTo(t).Implements(textUnmarshaler) {
+		return ""
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "int"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "uint"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	}
+	return t.Kind().String()
+}
+
+// setter returns the setFunc for type t, nil if t isn't supported
+// unit is used for time.Duration fields
+func setter(t reflect.Type, unit time.Duration) setFunc {
+	switch t {
+	case timeType:
+		return func(v reflect.Value, s string) error {
+			tm, err := parseTime(s)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(tm))
+			return nil
+		}
+	case durationType:
+		return func(v reflect.Value, s string) error {
+			d, err := parseDuration(s, unit)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+	}
+	if reflect.PtrTo(t).Implements(textUnmarshaler) {
+		return func(v reflect.Value, s string) error {
+			return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+		}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		elem := setter(t.Elem(), unit)
+		if elem == nil {
+			return nil
+		}
+		return func(v reflect.Value, s string) error {
+			if v.IsNil() {
+				v.Set(reflect.New(t.Elem()))
+			}
+			return elem(v.Elem(), s)
+		}
+	case reflect.String:
+		return func(v reflect.Value, s string) error {
+			v.SetString(s)
+			return nil
+		}
+	case reflect.Bool:
+		return func(v reflect.Value, s string) error {
+			if s == "" {
+				v.SetBool(false)
+				return nil
+			}
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return err
+			}
+			v.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(v reflect.Value, s string) error {
+			if s == "" {
+				v.SetInt(0)
+				return nil
+			}
+			i, err := strconv.ParseInt(s, 10, t.Bits())
+			if err != nil {
+				return err
+			}
+			v.SetInt(i)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(v reflect.Value, s string) error {
+			if s == "" {
+				v.SetUint(0)
+				return nil
+			}
+			i, err := strconv.ParseUint(s, 10, t.Bits())
+			if err != nil {
+				return err
+			}
+			v.SetUint(i)
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		return func(v reflect.Value, s string) error {
+			if s == "" {
+				v.SetFloat(0)
+				return nil
+			}
+			f, err := strconv.ParseFloat(s, t.Bits())
+			if err != nil {
+				return err
+			}
+			v.SetFloat(f)
+			return nil
+		}
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			return nil
+		}
+		return func(v reflect.Value, s string) error {
+			v.Set(reflect.ValueOf(s))
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package communication_test
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/schoeppi5/libts/communication"
+)
+
+type groups []int
+
+func (g *groups) UnmarshalText(text []byte) error {
+	for _, s := range strings.Split(string(text), ",") {
+		var i int
+		if _, err := fmt.Sscan(s, &i); err != nil {
+			return err
+		}
+		*g = append(*g, i)
+	}
+	return nil
+}
+
+type decodeTest struct {
+	ID          int
+	Nickname    string   `mapstructure:"client_nickname"`
+	Away        bool     `mapstructure:"client_away"`
+	Talker      bool     `mapstructure:"client_is_talker"`
+	IconID      uint32   `mapstructure:"client_icon_id"`
+	Created     int64    `mapstructure:"client_created"`
+	Ratio       float64  `mapstructure:"ratio"`
+	Groups      groups   `mapstructure:"client_servergroups"`
+	Bandwidth   *big.Int `mapstructure:"bandwidth"`
+	Total       big.Int  `mapstructure:"total"`
+	Hash        string   `mapstructure:"client_base64HashClientUID"`
+	Ignored     string   `mapstructure:"-"`
+	Description *string  `mapstructure:"client_description"`
+}
+
+const decodeRecord = `id=5 client_nickname=serveradmin\sfrom\s127.0.0.1 client_away=1 client_is_talker= client_icon_id=4294967295 client_created=1600000000 ratio=0.5 client_servergroups=6,8 bandwidth=18446744073709551615 total=42 client_base64HashClientUID=abc client_description=hi unknown=1`
+
+func TestDecodeFields(t *testing.T) {
+	// given
+	description := "hi"
+	bandwidth, _ := new(big.Int).SetString("18446744073709551615", 10)
+	want := decodeTest{
+		ID:          5,
+		Nickname:    "serveradmin from 127.0.0.1",
+		Away:        true,
+		IconID:      4294967295,
+		Created:     1600000000,
+		Ratio:       0.5,
+		Groups:      groups{6, 8},
+		Bandwidth:   bandwidth,
+		Hash:        "abc",
+		Description: &description,
+	}
+	want.Total.SetInt64(42)
+	have := decodeTest{}
+
+	// when
+	err := communication.DecodeFields(communication.Tokenize(decodeRecord)[0], &have)
+
+	// then
+	if err != nil || !reflect.DeepEqual(have, want) {
+		LogTestError(have, want, t, fmt.Sprint(err))
+	}
+}
+
+func TestDecodeFieldsLikeMapstructure(t *testing.T) {
+	// given
+	record := communication.Tokenize(decodeRecord)[0]
+	want := decodeTest{}
+	config := &mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.TextUnmarshallerHookFunc(),
+		Result:           &want,
+		WeaklyTypedInput: true,
+	}
+	decoder, _ := mapstructure.NewDecoder(config)
+	if err := decoder.Decode(record.Map()); err != nil {
+		t.Fatal(err)
+	}
+	have := decodeTest{}
+
+	// when
+	err := communication.Decode(record.Map(), &have)
+
+	// then
+	if err != nil || !reflect.DeepEqual(have, want) {
+		LogTestError(have, want, t, fmt.Sprint(err))
+	}
+}
+
+func TestDecodeFieldsError(t *testing.T) {
+	// given
+	have := decodeTest{}
+	want := "1 error(s) decoding:\n\n* cannot parse 'client_created' as int: strconv.ParseInt: parsing \"yesterday\": invalid syntax"
+
+	// when
+	err := communication.DecodeFields(communication.Tokenize("client_created=yesterday client_nickname=a")[0], &have)
+
+	// then
+	if err == nil || err.Error() != want {
+		LogTestError(err, want, t)
+	}
+	if have.Nickname != "a" { // the other fields are still decoded
+		LogTestError(have.Nickname, "a", t)
+	}
+}
+
+func TestUnmarshalSlice(t *testing.T) {
+	// given
+	have := []decodeTest{}
+
+	// when
+	err := communication.Unmarshal([]byte("id=1 client_nickname=a|id=2\n"), &have)
+
+	// then
+	want := []decodeTest{{ID: 1, Nickname: "a"}, {ID: 2}}
+	if err != nil || !reflect.DeepEqual(have, want) {
+		LogTestError(have, want, t, fmt.Sprint(err))
+	}
+}
+
+// clients returns a clientlist like response of n clients
+func clients(n int) []byte {
+	records := make([]string, n)
+	for i := range records {
+		records[i] = strings.Replace(decodeRecord, "id=5", fmt.Sprintf("id=%d", i), 1)
+	}
+	return []byte(strings.Join(records, "|"))
+}
+
+func BenchmarkUnmarshalMapstructure(b *testing.B) {
+	r := clients(300)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		list := []decodeTest{}
+		for _, m := range communication.ConvertResponse(r) {
+			item := decodeTest{}
+			config := &mapstructure.DecoderConfig{
+				DecodeHook:       mapstructure.TextUnmarshallerHookFunc(),
+				Result:           &item,
+				WeaklyTypedInput: true,
+			}
+			decoder, _ := mapstructure.NewDecoder(config)
+			if err := decoder.Decode(m); err != nil {
+				b.Fatal(err)
+			}
+			list = append(list, item)
+		}
+	}
+}
+
+func BenchmarkUnmarshalResponse(b *testing.B) {
+	r := clients(300)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		list := []decodeTest{}
+		if err := communication.UnmarshalResponse(communication.ConvertResponse(r), &list); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	r := clients(300)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		list := []decodeTest{}
+		if err := communication.Unmarshal(r, &list); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestUnmarshalStrict(t *testing.T) {
+	// given
+	have := []decodeTest{}
+	want := communication.UnmappedError{
+		Type:     "communication_test.decodeTest",
+		Unmapped: []string{"client_version", "unknown"},
+		Lossy:    []string{"client_created", "client_is_talker"},
+	}
+
+	// when
+	err := communication.Unmarshal([]byte("id=1 client_is_talker= unknown=1|id=2 client_created=007 client_version=3.13"), &have, communication.WithStrict())
+
+	// then
+	var e communication.UnmappedError
+	if !errors.As(err, &e) || !reflect.DeepEqual(e, want) {
+		LogTestError(err, want, t)
+	}
+	if len(have) != 2 || have[1].Created != 7 { // the value is decoded nevertheless
+		LogTestError(have, "2 decoded items", t)
+	}
+}
+
+func TestUnmarshalUnmappedHandler(t *testing.T) {
+	// given
+	var reported []communication.UnmappedError
+	handler := communication.WithUnmappedHandler(func(e communication.UnmappedError) {
+		reported = append(reported, e)
+	})
+	mapped := decodeTest{}
+	unmapped := []map[string]interface{}{}
+
+	// when
+	err := communication.Unmarshal([]byte("id=1 client_nickname=a"), &mapped, handler)
+	err2 := communication.Unmarshal([]byte("id=1 unknown=1"), &unmapped, handler) // maps take every field
+
+	// then
+	if err != nil || err2 != nil || len(reported) != 0 {
+		LogTestError(reported, "nothing reported", t, fmt.Sprint(err, err2))
+	}
+
+	// when
+	err = communication.Decode(map[string]interface{}{"id": 1.0, "unknown": "1"}, &mapped, handler) // decoded by mapstructure
+
+	// then
+	want := []communication.UnmappedError{{Type: "communication_test.decodeTest", Unmapped: []string{"unknown"}}}
+	if err != nil || !reflect.DeepEqual(reported, want) {
+		LogTestError(reported, want, t, fmt.Sprint(err))
+	}
+}
+
+type timeTest struct {
+	Created  time.Time      `mapstructure:"client_created"`
+	Expires  time.Time      `mapstructure:"expires_at"`
+	IdleTime time.Duration  `mapstructure:"client_idle_time" unit:"ms"`
+	Uptime   time.Duration  `mapstructure:"virtualserver_uptime" unit:"s"`
+	BanTime  *time.Duration `mapstructure:"bantime"`
+}
+
+func TestDecodeTime(t *testing.T) {
+	// given
+	record := communication.Tokenize("client_created=1600000000 expires_at=0 client_idle_time=1500 virtualserver_uptime=3600 bantime=60")[0]
+	banTime := time.Minute
+	want := timeTest{
+		Created:  time.Unix(1600000000, 0),
+		IdleTime: 1500 * time.Millisecond,
+		Uptime:   time.Hour,
+		BanTime:  &banTime,
+	}
+	have := timeTest{}
+
+	// when
+	err := communication.DecodeFields(record, &have, communication.WithStrict())
+
+	// then
+	if err != nil || !reflect.DeepEqual(have, want) {
+		LogTestError(have, want, t, fmt.Sprint(err))
+	}
+}
+
+func TestDecodeTimeMapstructure(t *testing.T) {
+	// given
+	record := communication.Tokenize("client_created=1600000000 virtualserver_uptime=3600 client_idle_time=1500 tags=a")[0]
+	want := struct {
+		Created  time.Time     `mapstructure:"client_created"`
+		Uptime   time.Duration `mapstructure:"virtualserver_uptime"`
+		IdleTime time.Duration `mapstructure:"client_idle_time" unit:"ms"`
+		Tags     []string      `mapstructure:"tags"` // not supported by the cached decoder
+	}{time.Unix(1600000000, 0), time.Hour, 1500 * time.Millisecond, []string{"a"}}
+	have := want
+	have.Created, have.Uptime, have.IdleTime, have.Tags = time.Time{}, 0, 0, nil
+
+	// when
+	err := communication.DecodeFields(record, &have)
+
+	// then
+	if err != nil || !reflect.DeepEqual(have, want) {
+		LogTestError(have, want, t, fmt.Sprint(err))
+	}
+}
@@ -0,0 +1,179 @@
+package communication
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/schoeppi5/libts"
+)
+
+// ErrDispatcherClosed is returned for requests to a closed Dispatcher
+var ErrDispatcherClosed = errors.New("dispatcher closed")
+
+// Dispatcher serializes the requests of many goroutines on one query connection
+// Commands are queued and written one after another. The response up to the terminating error line is handed back to the caller that sent the command
+// The selected virtual server is part of every job, so switching servers (use) can not interfere with other callers
+type Dispatcher struct {
+	in       <-chan []byte
+	out      io.Writer
+	timeout  time.Duration
+	jobs     chan *job
+	closed   chan struct{}
+	close    sync.Once
+	lock     sync.Mutex
+	serverID int
+}
+
+type job struct {
+	ctx       context.Context
+	serverID  int
+	cmd       []byte // nil if the job only selects serverID
+	keepAlive bool   // cmd is written without waiting for a response
+	result    chan result
+}
+
+type result struct {
+	data []byte
+	err  error
+}
+
+// NewDispatcher starts dispatching requests written to out and answered on in
+// If out implements Deadliner, the deadline of a request is applied to out while the request is running. Requests without a deadline use timeout (0 for none)
+// Once the context of a running request is done, out is interrupted (see WatchContext)
+func NewDispatcher(in <-chan []byte, out io.Writer, timeout time.Duration) *Dispatcher {
+	d := &Dispatcher{
+		in:      in,
+		out:     out,
+		timeout: timeout,
+		jobs:    make(chan *job),
+		closed:  make(chan struct{}),
+	}
+	go d.loop()
+	return d
+}
+
+// Do queues cmd and waits for its response
+// If serverID is not 0, the virtual server is selected before cmd is sent
+// When ctx is done before the response arrived, Do returns ctx.Err(). The response is discarded once it arrives
+func (d *Dispatcher) Do(ctx context.Context, serverID int, cmd []byte) ([]byte, error) {
+	if cmd == nil {
+		cmd = []byte{}
+	}
+	return d.enqueue(ctx, &job{ctx: ctx, serverID: serverID, cmd: cmd})
+}
+
+// Use selects the virtual server sid for all following requests without a ServerID
+func (d *Dispatcher) Use(ctx context.Context, sid int) error {
+	_, err := d.enqueue(ctx, &job{ctx: ctx, serverID: sid})
+	return err
+}
+
+// ServerID returns the currently selected virtual server
+func (d *Dispatcher) ServerID() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.serverID
+}
+
+// KeepAlive writes a keepalive line every interval between the requests until the dispatcher is closed or writing fails
+func (d *Dispatcher) KeepAlive(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-d.closed:
+				return
+			}
+			_, err := d.enqueue(context.Background(), &job{ctx: context.Background(), cmd: []byte(" \n"), keepAlive: true})
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the dispatcher. Queued requests return ErrDispatcherClosed
+// Close does not close the connection
+func (d *Dispatcher) Close() {
+	d.close.Do(func() {
+		close(d.closed)
+	})
+}
+
+func (d *Dispatcher) enqueue(ctx context.Context, j *job) ([]byte, error) {
+	j.result = make(chan result, 1) // never block the loop on an abandoned job
+	select {
+	case d.jobs <- j:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-d.closed:
+		return nil, ErrDispatcherClosed
+	}
+	select {
+	case r := <-j.result:
+		return r.data, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// loop runs one job at a time until the dispatcher is closed
+func (d *Dispatcher) loop() {
+	for {
+		select {
+		case j := <-d.jobs:
+			data, err := d.run(j)
+			j.result <- result{data: data, err: err}
+		case <-d.closed:
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) run(j *job) ([]byte, error) {
+	if err := j.ctx.Err(); err != nil { // caller isn't waiting anymore
+		return nil, err
+	}
+	if j.serverID != 0 && j.serverID != d.ServerID() {
+		use := libts.Request{
+			Command: "use",
+			Args: map[string]interface{}{
+				"sid": j.serverID,
+			},
+		}
+		_, err := d.write(j.ctx, []byte(use.String()))
+		if err != nil {
+			return nil, err
+		}
+		d.lock.Lock()
+		d.serverID = j.serverID
+		d.lock.Unlock()
+	}
+	if j.cmd == nil {
+		return nil, nil
+	}
+	if j.keepAlive {
+		_, err := d.out.Write(j.cmd)
+		return nil, err
+	}
+	return d.write(j.ctx, j.cmd)
+}
+
+// write cmd and read the whole response
+// Once ctx is done, the connection is interrupted, so the loop isn't blocked by a response that never arrives
+func (d *Dispatcher) write(ctx context.Context, cmd []byte) ([]byte, error) {
+	if conn, ok := d.out.(Deadliner); ok {
+		stop := WatchContext(ctx, conn, d.timeout)
+		defer stop()
+	}
+	data, err := Run(d.in, d.out, cmd)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return data, err
+}
@@ -0,0 +1,256 @@
+package communication_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schoeppi5/libts/communication"
+)
+
+// echoScript answers "echo x=<n>" with "x=<n> sid=<selected server>" and keeps track of use
+func echoScript() func(cmd string) []string {
+	sid := 0
+	return func(cmd string) []string {
+		parts := strings.SplitN(cmd, " ", 2)
+		switch parts[0] {
+		case "use":
+			fmt.Sscanf(parts[1], "sid=%d", &sid)
+			return []string{"error id=0 msg=ok"}
+		case "echo":
+			return []string{fmt.Sprintf("%s sid=%d", parts[1], sid), "error id=0 msg=ok"}
+		case "slow":
+			time.Sleep(50 * time.Millisecond)
+			return []string{"slow=1", "error id=0 msg=ok"}
+		case "fail":
+			return []string{"error id=768 msg=invalid\\schannelID"}
+		}
+		return []string{"error id=256 msg=command\\snot\\sfound"}
+	}
+}
+
+func TestDispatcherConcurrentRequests(t *testing.T) {
+	t.Parallel()
+	// given
+	conn := newScriptedConn(echoScript())
+	defer conn.Close()
+	d := communication.NewDispatcher(conn.in, conn, 0)
+	defer d.Close()
+	callers := 50
+
+	// when
+	wg := sync.WaitGroup{}
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sid := i%3 + 1
+			have, err := d.Do(context.Background(), sid, []byte(fmt.Sprintf("echo x=%d", i)))
+
+			// then
+			want := fmt.Sprintf("x=%d sid=%d", i, sid)
+			if err != nil {
+				LogTestError(err, nil, t)
+				return
+			}
+			if string(have) != want {
+				LogTestError(string(have), want, t)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestDispatcherUseOnlyWhenNeeded(t *testing.T) {
+	t.Parallel()
+	// given
+	conn := newScriptedConn(echoScript())
+	defer conn.Close()
+	d := communication.NewDispatcher(conn.in, conn, 0)
+	defer d.Close()
+	want := []string{"use sid=1", "echo x=1", "echo x=2", "echo x=3", "use sid=2", "echo x=4"}
+
+	// when
+	d.Do(context.Background(), 1, []byte("echo x=1"))
+	d.Do(context.Background(), 1, []byte("echo x=2"))
+	d.Do(context.Background(), 0, []byte("echo x=3"))
+	d.Do(context.Background(), 2, []byte("echo x=4"))
+
+	// then
+	have := conn.Sent()
+	if strings.Join(have, ",") != strings.Join(want, ",") {
+		LogTestError(have, want, t)
+	}
+	if d.ServerID() != 2 {
+		LogTestError(d.ServerID(), 2, t)
+	}
+}
+
+func TestDispatcherUse(t *testing.T) {
+	t.Parallel()
+	// given
+	conn := newScriptedConn(echoScript())
+	defer conn.Close()
+	d := communication.NewDispatcher(conn.in, conn, 0)
+	defer d.Close()
+
+	// when
+	err := d.Use(context.Background(), 7)
+	have, _ := d.Do(context.Background(), 0, []byte("echo x=1"))
+
+	// then
+	if err != nil {
+		LogTestError(err, nil, t)
+	}
+	if string(have) != "x=1 sid=7" {
+		LogTestError(string(have), "x=1 sid=7", t)
+	}
+}
+
+func TestDispatcherErrorResponse(t *testing.T) {
+	t.Parallel()
+	// given
+	conn := newScriptedConn(echoScript())
+	defer conn.Close()
+	d := communication.NewDispatcher(conn.in, conn, 0)
+	defer d.Close()
+
+	// when
+	_, err := d.Do(context.Background(), 0, []byte("fail"))
+	have, _ := d.Do(context.Background(), 0, []byte("echo x=1"))
+
+	// then
+	if e, ok := err.(communication.QueryError); !ok || e.ID != 768 {
+		LogTestError(err, "Query error(768)", t)
+	}
+	if string(have) != "x=1 sid=0" {
+		LogTestError(string(have), "x=1 sid=0", t, "response after error got mixed up")
+	}
+}
+
+func TestDispatcherCancelledRequestKeepsOrder(t *testing.T) {
+	t.Parallel()
+	// given
+	conn := newScriptedConn(echoScript())
+	defer conn.Close()
+	d := communication.NewDispatcher(conn.in, conn, 0)
+	defer d.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// when
+	_, err := d.Do(ctx, 0, []byte("slow"))
+	have, _ := d.Do(context.Background(), 0, []byte("echo x=1"))
+
+	// then
+	if err != context.DeadlineExceeded {
+		LogTestError(err, context.DeadlineExceeded, t)
+	}
+	if string(have) != "x=1 sid=0" {
+		LogTestError(string(have), "x=1 sid=0", t, "response of cancelled request was not discarded")
+	}
+}
+
+func TestDispatcherClosed(t *testing.T) {
+	t.Parallel()
+	// given
+	conn := newScriptedConn(echoScript())
+	defer conn.Close()
+	d := communication.NewDispatcher(conn.in, conn, 0)
+
+	// when
+	d.Close()
+	_, err := d.Do(context.Background(), 0, []byte("echo x=1"))
+
+	// then
+	if err != communication.ErrDispatcherClosed {
+		LogTestError(err, communication.ErrDispatcherClosed, t)
+	}
+}
+
+func TestDispatcherConnectionClosed(t *testing.T) {
+	t.Parallel()
+	// given
+	conn := newScriptedConn(echoScript())
+	d := communication.NewDispatcher(conn.in, conn, 0)
+	defer d.Close()
+	conn.Close()
+	time.Sleep(10 * time.Millisecond) // let the conn close in
+
+	// when
+	_, err := d.Do(context.Background(), 0, []byte("echo x=1"))
+
+	// then
+	if err != io.ErrClosedPipe {
+		LogTestError(err, io.ErrClosedPipe, t)
+	}
+}
+
+func TestDispatcherCancelInterruptsConn(t *testing.T) {
+	t.Parallel()
+	// given
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go io.Copy(ioutil.Discard, server) // never answers
+	in := make(chan []byte)
+	go communication.Read(client, in, nil)
+	d := communication.NewDispatcher(in, client, 0)
+	defer d.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	d.Do(ctx, 0, []byte("version"))
+
+	// when
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := d.Do(ctx, 0, []byte("version"))
+
+	// then
+	if err == nil || err == context.DeadlineExceeded {
+		LogTestError(err, "connection closed", t, "the cancelled request still blocks the dispatcher")
+	}
+}
+
+func TestDispatcherKeepAlive(t *testing.T) {
+	t.Parallel()
+	// given
+	echo := echoScript()
+	conn := newScriptedConn(func(cmd string) []string {
+		if strings.TrimSpace(cmd) == "" { // keepalives aren't answered
+			return nil
+		}
+		return echo(cmd)
+	})
+	defer conn.Close()
+	d := communication.NewDispatcher(conn.in, conn, 0)
+	defer d.Close()
+
+	// when
+	d.KeepAlive(5 * time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	have, err := d.Do(context.Background(), 0, []byte("echo x=1"))
+
+	// then
+	if err != nil || string(have) != "x=1 sid=0" {
+		LogTestError(string(have), "x=1 sid=0", t, fmt.Sprint(err))
+	}
+	keepAlives := 0
+	for _, cmd := range conn.Sent() {
+		if cmd == " " {
+			keepAlives++
+		}
+	}
+	if keepAlives == 0 {
+		LogTestError(keepAlives, "at least 1", t)
+	}
+}
@@ -1,56 +1,167 @@
 package communication
 
 import (
+	"strconv"
 	"sync"
+	"sync/atomic"
 
 	"github.com/schoeppi5/libts"
 )
 
 // EventStore is used to manage events across a subscriber and the event loop (communication.SortEvents)
-// it is basically a thread-safe map
+// it is basically a thread-safe map of event names to their listeners
+// Every event name can have any number of listeners, each belonging to a subscription
 type EventStore struct {
-	store map[string]*libts.Event
+	store map[string][]listener
 	lock  sync.Locker
 }
 
+// listener is a single event of a subscription
+type listener struct {
+	id    libts.SubscriptionID
+	route Route
+	event *libts.Event
+	box   *mailbox
+}
+
+// Route limits the notifications a listener receives to a virtual server and channel
+// 0 matches all servers or channels
+type Route struct {
+	ServerID  int
+	ChannelID int
+}
+
+// channelKeys are the fields of a notification containing the channels it is about
+var channelKeys = []string{"cid", "ctid", "cfid"}
+
+// matchesChannel returns true, if f is about the channel of r
+func (r Route) matchesChannel(f Fields) bool {
+	if r.ChannelID == 0 {
+		return true
+	}
+	cid := strconv.Itoa(r.ChannelID)
+	for _, key := range channelKeys {
+		if v, ok := f.Get(key); ok && v == cid {
+			return true
+		}
+	}
+	return false
+}
+
 // NewEventStore retuns a thread safe EventStore
 func NewEventStore() *EventStore {
 	return &EventStore{
-		store: make(map[string]*libts.Event),
+		store: make(map[string][]listener),
 		lock:  &sync.Mutex{},
 	}
 }
 
-// Add adds/updates name event pairs to/in the store
-func (es *EventStore) Add(name string, event *libts.Event) {
+// Add adds event as listener of name for subscription id
+// Existing listeners of name are kept
+func (es *EventStore) Add(id libts.SubscriptionID, name string, event *libts.Event) {
+	es.AddRoute(id, name, Route{}, event)
+}
+
+// AddRoute is like Add, but event only receives the notifications matching r
+func (es *EventStore) AddRoute(id libts.SubscriptionID, name string, r Route, event *libts.Event) {
 	es.lock.Lock()
 	defer es.lock.Unlock()
-	es.store[name] = event
+	es.store[name] = append(es.store[name], listener{id: id, route: r, event: event, box: newMailbox(event)})
 }
 
-// Del deletes name event pairs from the store
+// Del deletes all listeners of name from the store
 func (es *EventStore) Del(name string) {
 	es.lock.Lock()
 	defer es.lock.Unlock()
+	for _, l := range es.store[name] {
+		l.box.stop()
+	}
 	delete(es.store, name)
 }
 
-// Get returns the event to a name
-func (es *EventStore) Get(name string) (*libts.Event, bool) {
+// Remove deletes the listeners of subscription id
+// Returns false, if there were none
+func (es *EventStore) Remove(id libts.SubscriptionID) bool {
 	es.lock.Lock()
 	defer es.lock.Unlock()
-	e, ok := es.store[name]
-	return e, ok
+	removed := false
+	for name, listeners := range es.store {
+		kept := make([]listener, 0, len(listeners))
+		for _, l := range listeners {
+			if l.id != id {
+				kept = append(kept, l)
+				continue
+			}
+			l.box.stop()
+		}
+		removed = removed || len(kept) != len(listeners)
+		if len(kept) == 0 {
+			delete(es.store, name)
+			continue
+		}
+		es.store[name] = kept
+	}
+	return removed
+}
+
+// Get returns the listeners of name
+func (es *EventStore) Get(name string) ([]*libts.Event, bool) {
+	es.lock.Lock()
+	defer es.lock.Unlock()
+	listeners, ok := es.store[name]
+	events := make([]*libts.Event, len(listeners))
+	for i := range listeners {
+		events[i] = listeners[i].event
+	}
+	return events, ok
+}
+
+// listeners returns a copy of the listeners of name
+func (es *EventStore) listeners(name string) []listener {
+	es.lock.Lock()
+	defer es.lock.Unlock()
+	return append([]listener{}, es.store[name]...)
+}
+
+// Dropped returns the number of events dropped by the listeners of subscription id (see libts.Backpressure)
+func (es *EventStore) Dropped(id libts.SubscriptionID) uint64 {
+	es.lock.Lock()
+	defer es.lock.Unlock()
+	dropped := uint64(0)
+	for _, listeners := range es.store {
+		for _, l := range listeners {
+			if l.id == id {
+				dropped += atomic.LoadUint64(&l.box.dropped)
+			}
+		}
+	}
+	return dropped
+}
+
+// all returns all listeners
+func (es *EventStore) all() []listener {
+	es.lock.Lock()
+	defer es.lock.Unlock()
+	all := []listener{}
+	for _, listeners := range es.store {
+		all = append(all, listeners...)
+	}
+	return all
 }
 
 // Clean the whole store
 func (es *EventStore) Clean() {
 	es.lock.Lock()
 	defer es.lock.Unlock()
-	es.store = make(map[string]*libts.Event)
+	for _, listeners := range es.store {
+		for _, l := range listeners {
+			l.box.stop()
+		}
+	}
+	es.store = make(map[string][]listener)
 }
 
-// Len returns the number of events in the store
+// Len returns the number of event names in the store
 func (es *EventStore) Len() int {
 	es.lock.Lock()
 	defer es.lock.Unlock()
@@ -17,14 +17,59 @@ func TestAdd(t *testing.T) {
 	}
 
 	// when
-	es.Add(key, value)
+	es.Add(1, key, value)
 
 	// then
-	if es.store[key] != value {
+	if len(es.store[key]) != 1 || es.store[key][0].event != value {
 		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), es.store[key], value)
 	}
 }
 
+func TestAddMultiple(t *testing.T) {
+	// given
+	es := NewEventStore()
+	key := "test"
+	first := &libts.Event{Template: "first"}
+	second := &libts.Event{Template: "second"}
+
+	// when
+	es.Add(1, key, first)
+	es.Add(2, key, second)
+
+	// then
+	v, _ := es.Get(key)
+	if len(v) != 2 || v[0] != first || v[1] != second {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), v, []*libts.Event{first, second})
+	}
+}
+
+func TestRemove(t *testing.T) {
+	// given
+	es := NewEventStore()
+	first := &libts.Event{Template: "first"}
+	second := &libts.Event{Template: "second"}
+	es.Add(1, "test", first)
+	es.Add(2, "test", second)
+	es.Add(1, "other", first)
+
+	// when
+	ok := es.Remove(1)
+
+	// then
+	if !ok {
+		t.Errorf("Test %s failed!\n\tSubscription %d not removed", t.Name(), 1)
+	}
+	if v, _ := es.Get("test"); len(v) != 1 || v[0] != second {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), v, []*libts.Event{second})
+	}
+	if _, ok := es.Get("other"); ok {
+		t.Errorf("Test %s failed!\n\tKey %s still present in store", t.Name(), "other")
+	}
+	if es.Remove(1) {
+		t.Errorf("Test %s failed!\n\tSubscription %d removed twice", t.Name(), 1)
+	}
+}
+
 func TestDel(t *testing.T) {
 	// given
 	es := NewEventStore()
@@ -33,7 +78,7 @@ func TestDel(t *testing.T) {
 		C:        nil,
 		Template: nil,
 	}
-	es.Add(key, value)
+	es.Add(1, key, value)
 
 	// when
 	es.Del(key)
@@ -52,7 +97,7 @@ func TestGetPresent(t *testing.T) {
 		C:        nil,
 		Template: nil,
 	}
-	es.Add(key, value)
+	es.Add(1, key, value)
 
 	// when
 	v, ok := es.Get(key)
@@ -61,7 +106,7 @@ func TestGetPresent(t *testing.T) {
 	if !ok {
 		t.Errorf("Test %s failed!\n\tKey %s not present in store", t.Name(), key)
 	}
-	if v != value {
+	if len(v) != 1 || v[0] != value {
 		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), v, value)
 	}
 }
@@ -85,7 +130,7 @@ func TestLen(t *testing.T) {
 	es := NewEventStore()
 	keyCount := 10
 	for i := 0; i < keyCount; i++ {
-		es.Add(fmt.Sprintf("%d", i), nil)
+		es.Add(1, fmt.Sprintf("%d", i), nil)
 	}
 
 	// when
@@ -99,7 +144,7 @@ func TestLen(t *testing.T) {
 func TestClean(t *testing.T) {
 	// given
 	es := NewEventStore()
-	es.Add("test", nil)
+	es.Add(1, "test", nil)
 
 	// when
 	es.Clean()
@@ -113,7 +158,7 @@ func TestClean(t *testing.T) {
 func TestKeys(t *testing.T) {
 	// given
 	es := NewEventStore()
-	es.Add("test", nil)
+	es.Add(1, "test", nil)
 
 	// when
 	keys := es.Keys()
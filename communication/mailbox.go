@@ -0,0 +1,333 @@
+package communication
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/schoeppi5/libts"
+)
+
+// GapNotification is sent on the notification channel of a query once notifications were dropped or the connection was lost
+// The line is "notifygap dropped=N", where N is the number of dropped notifications (0 if unknown, e.g. after a reconnect)
+// It is part of the notifications of the query and turned into a libts.Gap for every listener
+const GapNotification = "notifygap"
+
+// mailbox delivers the events of a single listener according to its Backpressure
+// DropOldest and Unbounded queue the events, which are sent to the channel by their own goroutine
+// Block waits for the listener until the mailbox is stopped
+type mailbox struct {
+	event   *libts.Event
+	dropped uint64 // atomic
+
+	lock    sync.Mutex
+	queue   []interface{}
+	limit   int // of the queue, 0 for Unbounded
+	gap     *libts.Gap
+	high    bool // OnHighWater was called, reset once the queue is empty
+	closed  bool
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// newMailbox returns the mailbox for event
+func newMailbox(event *libts.Event) *mailbox {
+	m := &mailbox{event: event}
+	if event == nil {
+		return m
+	}
+	m.done = make(chan struct{})
+	switch event.Backpressure {
+	case libts.DropOldest, libts.Unbounded:
+		if event.Backpressure == libts.DropOldest {
+			m.limit = event.Buffer
+			if m.limit < 1 {
+				m.limit = cap(event.C)
+			}
+			if m.limit < 1 {
+				m.limit = 1
+			}
+		}
+		m.wake = make(chan struct{}, 1)
+		m.stopped = make(chan struct{})
+		go m.forward()
+	}
+	return m
+}
+
+// deliver sends e to the listener
+func (m *mailbox) deliver(e interface{}) {
+	switch m.event.Backpressure {
+	case libts.DropNewest:
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		if m.gap != nil {
+			select { // the gap is reported before the next event
+			case m.event.C <- *m.gap:
+				m.gap = nil
+			default:
+				m.drop(e)
+				return
+			}
+		}
+		select {
+		case m.event.C <- e:
+		default:
+			m.drop(e)
+		}
+	case libts.DropOldest, libts.Unbounded:
+		m.push(e)
+	default:
+		select { // a stopped listener isn't read anymore
+		case <-m.done:
+			return
+		default:
+		}
+		select {
+		case m.event.C <- e:
+		case <-m.done:
+		}
+	}
+}
+
+// drop counts e as dropped and adds it to the next gap. m.lock must be held
+func (m *mailbox) drop(e interface{}) {
+	if g, ok := e.(libts.Gap); ok {
+		m.missed(g)
+		return
+	}
+	atomic.AddUint64(&m.dropped, 1)
+	m.missed(libts.Gap{Dropped: 1})
+}
+
+// missed adds g to the next gap. m.lock must be held
+func (m *mailbox) missed(g libts.Gap) {
+	if m.gap == nil {
+		m.gap = &g
+		return
+	}
+	if m.gap.Dropped != 0 && g.Dropped != 0 {
+		m.gap.Dropped += g.Dropped
+		return
+	}
+	m.gap.Dropped = 0 // unknown
+}
+
+// push queues e for the forwarding goroutine
+func (m *mailbox) push(e interface{}) {
+	m.lock.Lock()
+	if m.closed {
+		m.lock.Unlock()
+		return
+	}
+	if m.limit > 0 && len(m.queue) >= m.limit {
+		m.drop(m.queue[0])
+		m.queue[0] = nil
+		m.queue = m.queue[1:]
+	}
+	m.queue = append(m.queue, e)
+	highWater := m.event.OnHighWater != nil && m.event.HighWater > 0 && !m.high && len(m.queue) >= m.event.HighWater
+	if highWater {
+		m.high = true
+	}
+	queued := len(m.queue)
+	m.lock.Unlock()
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	if highWater {
+		m.event.OnHighWater(queued)
+	}
+}
+
+// next returns the next event of the queue, the gap first
+func (m *mailbox) next() (interface{}, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.gap != nil {
+		g := *m.gap
+		m.gap = nil
+		return g, true
+	}
+	if len(m.queue) == 0 {
+		return nil, false
+	}
+	e := m.queue[0]
+	m.queue[0] = nil
+	m.queue = m.queue[1:]
+	if len(m.queue) == 0 {
+		m.high = false
+	}
+	return e, true
+}
+
+// forward sends the queued events to the channel until m is stopped
+func (m *mailbox) forward() {
+	defer close(m.stopped)
+	for {
+		e, ok := m.next()
+		if !ok {
+			select {
+			case <-m.wake:
+				continue
+			case <-m.done:
+				return
+			}
+		}
+		select {
+		case m.event.C <- e:
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// reportGap sends g to the listener before any following event
+func (m *mailbox) reportGap(g libts.Gap) {
+	switch m.event.Backpressure {
+	case libts.DropNewest:
+		m.lock.Lock()
+		m.missed(g)
+		m.lock.Unlock()
+	default:
+		m.deliver(g)
+	}
+}
+
+// stop the forwarding goroutine and a blocked delivery. Queued events are discarded
+// stop waits for the goroutine, so the channel can be closed afterwards
+func (m *mailbox) stop() {
+	m.lock.Lock()
+	if m.closed {
+		m.lock.Unlock()
+		return
+	}
+	m.closed = true
+	m.queue = nil
+	m.lock.Unlock()
+	if m.done != nil {
+		close(m.done)
+	}
+	if m.stopped != nil {
+		<-m.stopped
+	}
+}
+
+// gapRetry is the interval in which a pending GapNotification is sent again, while the channel is full
+const gapRetry = 50 * time.Millisecond
+
+// gapTimeout limits waiting for room for the pending GapNotification before the channel is closed
+const gapTimeout = time.Second
+
+// notifier forwards notifications to a channel without blocking
+// Dropped notifications are reported by a GapNotification, once the channel has room again
+type notifier struct {
+	c       chan<- []byte
+	lock    sync.Mutex
+	gap     bool
+	dropped uint64
+	retry   *time.Timer // sends the pending GapNotification, nil if none is scheduled
+	closed  bool
+}
+
+// send data to the channel or count it as dropped
+func (n *notifier) send(data []byte) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.closed {
+		return
+	}
+	if !n.flush() {
+		n.drop()
+		return
+	}
+	select {
+	case n.c <- data:
+	default:
+		n.drop()
+	}
+}
+
+// flush sends the pending GapNotification. Returns false, if it didn't fit into the channel
+// If so, it is sent again after gapRetry. n.lock must be held
+func (n *notifier) flush() bool {
+	if !n.gap {
+		return true
+	}
+	select {
+	case n.c <- n.notification():
+		n.gap, n.dropped = false, 0
+		return true
+	default:
+		n.schedule()
+		return false
+	}
+}
+
+// schedule sending the pending GapNotification after gapRetry. n.lock must be held
+func (n *notifier) schedule() {
+	if n.retry != nil || n.closed {
+		return
+	}
+	n.retry = time.AfterFunc(gapRetry, func() {
+		n.lock.Lock()
+		defer n.lock.Unlock()
+		n.retry = nil
+		if !n.closed {
+			n.flush()
+		}
+	})
+}
+
+// notification returns the pending GapNotification. n.lock must be held
+func (n *notifier) notification() []byte {
+	return []byte(GapNotification + " dropped=" + strconv.FormatUint(n.dropped, 10))
+}
+
+// drop counts a dropped notification. n.lock must be held
+func (n *notifier) drop() {
+	if !n.gap || n.dropped != 0 {
+		n.dropped++
+	}
+	n.gap = true
+	n.schedule()
+}
+
+// lost reports a gap of unknown size, e.g. because the connection was lost
+func (n *notifier) lost() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.closed {
+		return
+	}
+	n.gap, n.dropped = true, 0
+	n.flush()
+}
+
+// close sends the pending GapNotification, waiting up to gapTimeout for room, and stops n
+// The channel can be closed afterwards
+func (n *notifier) close() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.closed {
+		return
+	}
+	n.closed = true
+	if n.retry != nil {
+		n.retry.Stop()
+		n.retry = nil
+	}
+	if !n.gap {
+		return
+	}
+	timeout := time.NewTimer(gapTimeout)
+	defer timeout.Stop()
+	select {
+	case n.c <- n.notification():
+		n.gap, n.dropped = false, 0
+	case <-timeout.C:
+	}
+}
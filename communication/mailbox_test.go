@@ -0,0 +1,97 @@
+package communication
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNotifier(t *testing.T) {
+	// given
+	c := make(chan []byte, 2)
+	n := &notifier{c: c}
+	for _, data := range []string{"notifya", "notifyb", "notifyc", "notifyd"} {
+		n.send([]byte(data))
+	}
+	have := []string{string(<-c), string(<-c)}
+
+	// when
+	n.send([]byte("notifye"))
+
+	// then
+	have = append(have, string(<-c), string(<-c))
+	want := []string{"notifya", "notifyb", GapNotification + " dropped=2", "notifye"}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), have, want)
+	}
+}
+
+func TestNotifierLost(t *testing.T) {
+	// given
+	c := make(chan []byte, 1)
+	n := &notifier{c: c}
+	n.lost()
+
+	// when
+	n.send([]byte("notifya")) // the gap was sent right away, notifya doesn't fit
+	first := string(<-c)
+	second := string(<-c) // sent by the retry
+
+	// then
+	if want := GapNotification + " dropped=0"; first != want {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), first, want)
+	}
+	if want := GapNotification + " dropped=1"; second != want {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), second, want)
+	}
+}
+
+func TestNotifierFlushesTrailingGap(t *testing.T) {
+	// given
+	c := make(chan []byte, 1)
+	n := &notifier{c: c}
+	n.send([]byte("notifya"))
+	n.send([]byte("notifyb"))
+
+	// when
+	first := string(<-c)
+	var second string
+	select {
+	case data := <-c:
+		second = string(data)
+	case <-time.After(time.Second):
+	}
+
+	// then
+	have := []string{first, second}
+	want := []string{"notifya", GapNotification + " dropped=1"}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), have, want)
+	}
+}
+
+func TestNotifierClose(t *testing.T) {
+	// given
+	c := make(chan []byte, 1)
+	n := &notifier{c: c}
+	n.send([]byte("notifya"))
+	n.send([]byte("notifyb"))
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-c // makes room, before the gap is retried
+	}()
+
+	// when
+	n.close()
+	close(c)
+
+	// then
+	have := []string{}
+	for data := range c {
+		have = append(have, string(data))
+	}
+	want := []string{GapNotification + " dropped=1"}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), have, want)
+	}
+}
@@ -1,3 +1,157 @@
 package communication_test
 
-// TODO: write query mock
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/schoeppi5/libts/communication"
+)
+
+// scriptedConn is a fake query connection
+// Every command written to it is answered by script on in, one command at a time and in order
+type scriptedConn struct {
+	in     chan []byte
+	cmds   chan []byte
+	script func(cmd string) []string
+	lock   sync.Mutex
+	sent   []string
+	closed bool
+}
+
+func newScriptedConn(script func(cmd string) []string) *scriptedConn {
+	sc := &scriptedConn{
+		in:     make(chan []byte),
+		cmds:   make(chan []byte, 100),
+		script: script,
+	}
+	go sc.respond()
+	return sc
+}
+
+// Write fullfills the io.Writer interface
+func (sc *scriptedConn) Write(p []byte) (int, error) {
+	cmd := string(bytes.TrimSuffix(p, []byte("\n")))
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	if sc.closed {
+		return 0, io.ErrClosedPipe
+	}
+	sc.sent = append(sc.sent, cmd)
+	sc.cmds <- []byte(cmd)
+	return len(p), nil
+}
+
+// Sent returns all commands written so far
+func (sc *scriptedConn) Sent() []string {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	return append([]string{}, sc.sent...)
+}
+
+// Close stops answering and closes in
+func (sc *scriptedConn) Close() {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	if !sc.closed {
+		sc.closed = true
+		close(sc.cmds)
+	}
+}
+
+func (sc *scriptedConn) respond() {
+	for cmd := range sc.cmds {
+		for _, line := range sc.script(string(cmd)) {
+			sc.in <- []byte(line)
+		}
+	}
+	close(sc.in)
+}
+
+// fakeServer accepts connections from a communication.Dialer and answers commands using script
+// Every connection starts with the TS3 header and banner
+type fakeServer struct {
+	script func(cmd string) []string
+	lock   sync.Mutex
+	conns  []net.Conn
+	sent   []string
+	fail   int // number of dials to fail
+}
+
+func newFakeServer(script func(cmd string) []string) *fakeServer {
+	return &fakeServer{
+		script: script,
+	}
+}
+
+// Dial fullfills communication.Dialer
+func (fs *fakeServer) Dial(ctx context.Context) (*communication.Connection, error) {
+	fs.lock.Lock()
+	if fs.fail > 0 {
+		fs.fail--
+		fs.lock.Unlock()
+		return nil, errors.New("connection refused")
+	}
+	client, server := net.Pipe()
+	fs.conns = append(fs.conns, server)
+	fs.lock.Unlock()
+	go fs.serve(server)
+	return communication.NewConnection(client, client, client, 5)
+}
+
+// Kill the latest connection
+func (fs *fakeServer) Kill() {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	fs.conns[len(fs.conns)-1].Close()
+}
+
+// Notify pushes n on the latest connection
+func (fs *fakeServer) Notify(n string) {
+	fs.lock.Lock()
+	conn := fs.conns[len(fs.conns)-1]
+	fs.lock.Unlock()
+	fmt.Fprintf(conn, "%s\n\r", n)
+}
+
+// Sent returns all commands received so far
+func (fs *fakeServer) Sent() []string {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	return append([]string{}, fs.sent...)
+}
+
+// Dials returns the number of successful dials
+func (fs *fakeServer) Dials() int {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	return len(fs.conns)
+}
+
+func (fs *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprint(conn, "TS3\n\rWelcome to the fake TeamSpeak 3 ServerQuery interface\n\r")
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSpace(line)
+		if cmd == "" {
+			continue
+		}
+		fs.lock.Lock()
+		fs.sent = append(fs.sent, cmd)
+		fs.lock.Unlock()
+		for _, l := range fs.script(cmd) {
+			fmt.Fprintf(conn, "%s\n\r", l)
+		}
+	}
+}
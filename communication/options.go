@@ -0,0 +1,246 @@
+package communication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/schoeppi5/libts"
+)
+
+// ContextDialer opens network connections (e.g. *net.Dialer or a proxy)
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Options of a query transport
+// Not every transport supports every option (e.g. webquery has no notifications and no nickname)
+type Options struct {
+	// Dialer opens the connection. Defaults to a net.Dialer using DialTimeout and KeepAlive
+	Dialer ContextDialer
+	// DialTimeout limits establishing the connection (including the ssh handshake)
+	DialTimeout time.Duration
+	// Timeout of a request without a deadline
+	Timeout time.Duration
+	// KeepAlive interval of the connection
+	KeepAlive time.Duration
+	// NotificationBuffer is the size of the notification channel
+	NotificationBuffer int
+	// ServerID is selected (use sid=) after login
+	ServerID int
+	// ServerPort selects the virtual server by its port (use port=) after login, if ServerID is 0
+	ServerPort int
+	// Nickname of the query, set after the virtual server was selected
+	Nickname string
+	// ReconnectPolicy enables reconnecting once the connection is lost
+	ReconnectPolicy *ReconnectPolicy
+}
+
+// Option configures Options
+type Option func(*Options)
+
+// WithDialer uses d to open the connection, e.g. to connect through a proxy
+func WithDialer(d ContextDialer) Option {
+	return func(o *Options) {
+		o.Dialer = d
+	}
+}
+
+// WithDialTimeout limits establishing the connection to timeout
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.DialTimeout = timeout
+	}
+}
+
+// WithTimeout limits requests without a deadline to timeout
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = timeout
+	}
+}
+
+// WithKeepAlive keeps the connection alive every interval
+func WithKeepAlive(interval time.Duration) Option {
+	return func(o *Options) {
+		o.KeepAlive = interval
+	}
+}
+
+// WithNotificationBuffer sets the size of the notification channel
+func WithNotificationBuffer(size int) Option {
+	return func(o *Options) {
+		o.NotificationBuffer = size
+	}
+}
+
+// WithServerID selects the virtual server sid after login
+func WithServerID(sid int) Option {
+	return func(o *Options) {
+		o.ServerID = sid
+	}
+}
+
+// WithServerPort selects the virtual server listening on port after login
+func WithServerPort(port int) Option {
+	return func(o *Options) {
+		o.ServerPort = port
+	}
+}
+
+// WithNickname sets the nickname of the query after login
+func WithNickname(nickname string) Option {
+	return func(o *Options) {
+		o.Nickname = nickname
+	}
+}
+
+// WithReconnectPolicy enables reconnecting once the connection is lost
+func WithReconnectPolicy(p *ReconnectPolicy) Option {
+	return func(o *Options) {
+		o.ReconnectPolicy = p
+	}
+}
+
+// Apply opts to a copy of o
+func (o Options) Apply(opts ...Option) Options {
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// DialContext opens a connection to address using Dialer, limited by DialTimeout
+func (o Options) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if o.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.DialTimeout)
+		defer cancel()
+	}
+	dialer := o.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{
+			KeepAlive: o.KeepAlive,
+		}
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// Setup returns a Setup running login (if not nil) and selecting the virtual server and nickname afterwards
+func (o Options) Setup(login Setup) Setup {
+	return func(ctx context.Context, d *Dispatcher) error {
+		if login != nil {
+			err := login(ctx, d)
+			if err != nil {
+				return err
+			}
+		}
+		sid := o.ServerID
+		if sid == 0 && o.ServerPort != 0 {
+			var err error
+			sid, err = serverIDByPort(ctx, d, o.ServerPort)
+			if err != nil {
+				return err
+			}
+		}
+		if sid != 0 {
+			err := d.Use(ctx, sid)
+			if err != nil {
+				return err
+			}
+		}
+		if o.Nickname != "" {
+			update := libts.Request{
+				Command: "clientupdate",
+				Args: map[string]interface{}{
+					"client_nickname": o.Nickname,
+				},
+			}
+			_, err := d.Do(ctx, 0, []byte(update.String()))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// serverIDByPort returns the id of the virtual server listening on port
+func serverIDByPort(ctx context.Context, d *Dispatcher, port int) (int, error) {
+	req := libts.Request{
+		Command: "serveridgetbyport",
+		Args: map[string]interface{}{
+			"virtualserver_port": port,
+		},
+	}
+	data, err := d.Do(ctx, 0, []byte(req.String()))
+	if err != nil {
+		return 0, err
+	}
+	server := struct {
+		ID int `mapstructure:"server_id"`
+	}{}
+	err = Unmarshal(data, &server)
+	if err != nil {
+		return 0, err
+	}
+	if server.ID == 0 {
+		return 0, errors.New("no virtual server on port")
+	}
+	return server.ID, nil
+}
+
+// OptionsFromURL reads the options from the query of a connection url (see libts.Dial)
+// Supported are sid, port, nickname, buffer and the durations timeout, dial_timeout and keepalive (e.g. 10s)
+func OptionsFromURL(u *url.URL) ([]Option, error) {
+	opts := []Option{}
+	q := u.Query()
+	ints := map[string]func(int) Option{
+		"sid":    WithServerID,
+		"port":   WithServerPort,
+		"buffer": WithNotificationBuffer,
+	}
+	for key, option := range ints {
+		if v := q.Get(key); v != "" {
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", key, err)
+			}
+			opts = append(opts, option(i))
+		}
+	}
+	durations := map[string]func(time.Duration) Option{
+		"timeout":      WithTimeout,
+		"dial_timeout": WithDialTimeout,
+		"keepalive":    WithKeepAlive,
+	}
+	for key, option := range durations {
+		if v := q.Get(key); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", key, err)
+			}
+			opts = append(opts, option(d))
+		}
+	}
+	if v := q.Get("nickname"); v != "" {
+		opts = append(opts, WithNickname(v))
+	}
+	return opts, nil
+}
+
+// HostPort returns the host and port of u, using defaultPort if u has none
+func HostPort(u *url.URL, defaultPort int) (string, int, error) {
+	if u.Port() == "" {
+		return u.Hostname(), defaultPort, nil
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		return "", 0, err
+	}
+	return u.Hostname(), port, nil
+}
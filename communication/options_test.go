@@ -0,0 +1,144 @@
+package communication_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schoeppi5/libts/communication"
+)
+
+func portScript(cmd string) []string {
+	if cmd == "serveridgetbyport virtualserver_port=9987" {
+		return []string{"server_id=2", "error id=0 msg=ok"}
+	}
+	return okScript(cmd)
+}
+
+func TestOptionsSetup(t *testing.T) {
+	t.Parallel()
+	// given
+	fs := newFakeServer(portScript)
+	options := communication.Options{}.Apply(
+		communication.WithServerPort(9987),
+		communication.WithNickname("my bot"),
+	)
+
+	// when
+	s, err := communication.NewSession(context.Background(), fs.Dial, options.Setup(login), time.Second, 5)
+
+	// then
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	want := []string{
+		"login client_login_name=test client_login_password=secret",
+		"serveridgetbyport virtualserver_port=9987",
+		"use sid=2",
+		"clientupdate client_nickname=my\\sbot",
+	}
+	if have := fs.Sent(); strings.Join(have, ",") != strings.Join(want, ",") {
+		LogTestError(have, want, t)
+	}
+	if s.ServerID() != 2 {
+		LogTestError(s.ServerID(), 2, t)
+	}
+}
+
+func TestOptionsSetupServerIDWins(t *testing.T) {
+	t.Parallel()
+	// given
+	fs := newFakeServer(portScript)
+	options := communication.Options{}.Apply(
+		communication.WithServerPort(9987),
+		communication.WithServerID(5),
+	)
+
+	// when
+	s, err := communication.NewSession(context.Background(), fs.Dial, options.Setup(nil), time.Second, 5)
+
+	// then
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if have := fs.Sent(); strings.Join(have, ",") != "use sid=5" {
+		LogTestError(have, "use sid=5", t)
+	}
+}
+
+type recordingDialer struct {
+	addresses []string
+}
+
+func (rd *recordingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	rd.addresses = append(rd.addresses, address)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestOptionsDialContext(t *testing.T) {
+	t.Parallel()
+	// given
+	rd := &recordingDialer{}
+	options := communication.Options{}.Apply(
+		communication.WithDialer(rd),
+		communication.WithDialTimeout(10*time.Millisecond),
+	)
+
+	// when
+	_, err := options.DialContext(context.Background(), "tcp", "localhost:10011")
+
+	// then
+	if !errors.Is(err, context.DeadlineExceeded) {
+		LogTestError(err, context.DeadlineExceeded, t)
+	}
+	if len(rd.addresses) != 1 || rd.addresses[0] != "localhost:10011" {
+		LogTestError(rd.addresses, "localhost:10011", t)
+	}
+}
+
+func TestOptionsFromURL(t *testing.T) {
+	t.Parallel()
+	// given
+	u, _ := url.Parse("ts3query://localhost/?sid=3&port=9987&nickname=bot&timeout=5s&keepalive=1m&buffer=10")
+
+	// when
+	opts, err := communication.OptionsFromURL(u)
+
+	// then
+	if err != nil {
+		t.Fatal(err)
+	}
+	have := communication.Options{}.Apply(opts...)
+	want := communication.Options{
+		ServerID:           3,
+		ServerPort:         9987,
+		Nickname:           "bot",
+		Timeout:            5 * time.Second,
+		KeepAlive:          time.Minute,
+		NotificationBuffer: 10,
+	}
+	if have != want {
+		LogTestError(have, want, t)
+	}
+}
+
+func TestOptionsFromURLInvalid(t *testing.T) {
+	t.Parallel()
+	// given
+	u, _ := url.Parse("ts3query://localhost/?sid=one")
+
+	// when
+	_, err := communication.OptionsFromURL(u)
+
+	// then
+	if err == nil {
+		LogTestError(err, "invalid sid", t)
+	}
+}
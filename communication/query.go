@@ -3,19 +3,27 @@ package communication
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"time"
+
+	"github.com/schoeppi5/libts"
 )
 
 // Shared codebase for queries
 
 // QueryError is returned when the query answered with an error
+// Use errors.Is with a libts.ErrorID to check for a specific error, e.g. errors.Is(err, libts.ErrInvalidChannelID)
 type QueryError struct {
 	ID           int    `mapstructure:"id" json:"code"`
 	Message      string `mapstructure:"msg" json:"message"`
-	ExtraMessage string `json:"extra_message"` // only set on webquery
+	ExtraMessage string `mapstructure:"extra_msg" json:"extra_message"`
+	// FailedPermID is the permission missing for the command (only for insufficient permissions)
+	FailedPermID int `mapstructure:"failed_permid" json:"failed_permid,omitempty"`
+	// FailedPermission is the name of FailedPermID, if it could be resolved
+	FailedPermission string `mapstructure:"-" json:"failed_permission,omitempty"`
 }
 
 func (qe QueryError) Error() string {
@@ -23,15 +31,61 @@ func (qe QueryError) Error() string {
 	if qe.ExtraMessage != "" {
 		s += fmt.Sprintf(" (Extra message: %s)", qe.ExtraMessage)
 	}
+	if qe.FailedPermission != "" {
+		s += fmt.Sprintf(" (Failed permission: %s)", qe.FailedPermission)
+	} else if qe.FailedPermID != 0 {
+		s += fmt.Sprintf(" (Failed permission: %d)", qe.FailedPermID)
+	}
 	return s
 }
 
+// Code returns the id of qe as libts.ErrorID
+func (qe QueryError) Code() libts.ErrorID {
+	return libts.ErrorID(qe.ID)
+}
+
+// Is returns true, if target is a libts.ErrorID or QueryError with the same id
+func (qe QueryError) Is(target error) bool {
+	switch t := target.(type) {
+	case libts.ErrorID:
+		return qe.ID == int(t)
+	case QueryError:
+		return qe.ID == t.ID
+	}
+	return false
+}
+
+// EmptyResultError is returned, if teamspeak had nothing to list ("database empty result set")
+// Use errors.As with a QueryError to get the underlying error
+type EmptyResultError struct {
+	QueryError
+}
+
+// Unwrap returns the underlying QueryError
+func (e EmptyResultError) Unwrap() error {
+	return e.QueryError
+}
+
+// ResponseError returns qe as it is reported to the caller
+// An empty result is reported as EmptyResultError, every other error as qe itself
+func ResponseError(qe QueryError) error {
+	if qe.Code() == libts.ErrEmptyResult {
+		return EmptyResultError{QueryError: qe}
+	}
+	return qe
+}
+
 // KeepAlive sends " \n" every t to conn
+// Returns once writing to conn fails
 func KeepAlive(conn io.Writer, t time.Duration) {
 	ticker := time.NewTicker(t)
+	defer ticker.Stop()
 	for {
 		<-ticker.C
-		conn.Write([]byte(" \n"))
+		_, err := conn.Write([]byte(" \n"))
+		if err != nil {
+			return
+		}
 	}
 }
 
@@ -54,7 +108,19 @@ func ReadHeader(r <-chan []byte) error {
 }
 
 // Run writes r to in and reads until it encounters an error. If error has id 0, the read data is returned
+// An empty result is returned as EmptyResultError
+// For commands sent with -continueonerror, the data and error lines of the items are returned line by line
+// These lines can't be assigned to the items reliably, use Each for results per item
 func Run(in <-chan []byte, out io.Writer, r []byte) ([]byte, error) {
+	return RunContext(context.Background(), in, out, r)
+}
+
+// RunContext is like Run, but stops waiting for the response once ctx is done and returns ctx.Err()
+// The remaining response is not consumed, so the connection should be interrupted as well (see WatchContext)
+func RunContext(ctx context.Context, in <-chan []byte, out io.Writer, r []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil { // don't send anything if ctx is already done
+		return nil, err
+	}
 	if !bytes.HasSuffix(r, []byte("\n")) { // a command must be suffixed by \n
 		r = append(r, byte('\n'))
 	}
@@ -62,56 +128,106 @@ func Run(in <-chan []byte, out io.Writer, r []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	continueOnError := continuesOnError(r)
+	separator := byte('|')
+	if continueOnError {
+		separator = '\n'
+	}
 	var data []byte
 	for {
-		d, open := <-in
+		var d []byte
+		var open bool
+		select {
+		case d, open = <-in:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 		if !open {
 			return nil, errors.New("unable to read response: connection closed")
 		}
 		if err = IsError(d); err != nil {
-			if e, ok := err.(QueryError); ok {
-				if e.ID == 0 {
-					return data, nil
-				}
+			e, ok := err.(QueryError)
+			if !ok {
 				return nil, err
 			}
-			return nil, err
+			if e.ID == 0 { // the final error line
+				return data, nil
+			}
+			if !continueOnError {
+				return nil, ResponseError(e)
+			}
 		}
 		if len(data) != 0 {
-			data = append(data, byte('|'))
+			data = append(data, separator)
 		}
 		data = append(data, d...)
 	}
 }
 
+// Deadliner is implemented by connections supporting deadlines (e.g. net.Conn)
+type Deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// WatchContext applies the deadline of ctx to conn. If ctx has no deadline, fallback is used instead (0 for none)
+// Once ctx is done, pending reads and writes on conn are interrupted, which closes the connection for good
+// stop must be called after the request finished. It resets the deadline of conn
+func WatchContext(ctx context.Context, conn Deadliner, fallback time.Duration) (stop func()) {
+	deadline, ok := ctx.Deadline()
+	if !ok && fallback > 0 {
+		deadline = time.Now().Add(fallback)
+	}
+	conn.SetDeadline(deadline)
+	if ctx.Done() == nil { // ctx can never be cancelled
+		return func() {
+			conn.SetDeadline(time.Time{})
+		}
+	}
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0)) // a deadline in the past interrupts everything waiting on conn
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited // otherwise the watcher might interrupt conn after the reset
+		conn.SetDeadline(time.Time{})
+	}
+}
+
 // Read the input from c
 // notifications (prefixed with notify.*) are send to notify, everything else is send to out
 // Stops when c is closed or it encounters an error while reading from c
-// If notify is nil, notifications are discarded
+// If notify is nil, notifications are discarded. Notifications, which don't fit into notify, are dropped and reported by a GapNotification
 // If out is nil, Read returns
-func Read(c io.Reader, out chan<- []byte, notify chan<- []byte) {
+// The returned error is the reason reading from c stopped
+func Read(c io.Reader, out chan<- []byte, notify chan<- []byte) error {
 	if out == nil {
-		return
+		return nil
 	}
 	reader := bufio.NewReader(c)
+	n := &notifier{c: notify}
 	for {
 		data, err := reader.ReadBytes('\n')
 		if err != nil {
 			close(out)
 			if notify != nil {
+				n.close()
 				close(notify)
 			}
-			return
+			return err
 		}
 		data = bytes.TrimRight(bytes.TrimLeft(data, "\r"), "\n") // normalize data
 		if bytes.HasPrefix(data, []byte("notify")) {
 			if notify == nil {
 				continue
 			}
-			select { // non blocking write to notify
-			case notify <- data:
-			default:
-			}
+			n.send(data) // non blocking write to notify
 			continue
 		}
 		out <- data // block on write to out
@@ -2,8 +2,11 @@ package communication_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"reflect"
 	"strings"
@@ -65,6 +68,54 @@ func TestQueryErrorStringExtraMessage(t *testing.T) {
 	}
 }
 
+func TestQueryErrorFailedPermission(t *testing.T) {
+	t.Parallel()
+	// given
+	line := []byte(`error id=2568 msg=insufficient\sclient\spermissions failed_permid=4`)
+	want := "Query error(2568): insufficient client permissions (Failed permission: 4)"
+
+	// when
+	err := communication.IsError(line)
+
+	// then
+	qe, ok := err.(communication.QueryError)
+	if !ok {
+		LogTestError(err, want, t)
+		return
+	}
+	if qe.FailedPermID != 4 {
+		LogTestError(qe.FailedPermID, 4, t)
+	}
+	if qe.Error() != want {
+		LogTestError(qe.Error(), want, t)
+	}
+	qe.FailedPermission = "b_serverinstance_info_view"
+	want = "Query error(2568): insufficient client permissions (Failed permission: b_serverinstance_info_view)"
+	if qe.Error() != want {
+		LogTestError(qe.Error(), want, t)
+	}
+}
+
+func TestQueryErrorIs(t *testing.T) {
+	t.Parallel()
+	// given
+	err := fmt.Errorf("while listing channels: %w", communication.QueryError{ID: 768, Message: "invalid channelID"})
+
+	// when
+	is := errors.Is(err, libts.ErrInvalidChannelID)
+	isNot := errors.Is(err, libts.ErrInvalidClientID)
+	var qe communication.QueryError
+	as := errors.As(err, &qe)
+
+	// then
+	if !is || isNot {
+		LogTestError(fmt.Sprint(is, isNot), fmt.Sprint(true, false), t, "errors.Is doesn't match the error id")
+	}
+	if !as || qe.Code() != libts.ErrInvalidChannelID {
+		LogTestError(qe.Code(), libts.ErrInvalidChannelID, t, "errors.As doesn't find the QueryError")
+	}
+}
+
 func TestKeepAlive(t *testing.T) {
 	// given
 	b := &bytes.Buffer{}
@@ -239,7 +290,7 @@ func TestRunErrorResponse(t *testing.T) {
 		ID:      1234,
 		Message: "it worked",
 	}
-	in <- []byte(fmt.Sprintf("error id=%d msg=%s", want.ID, libts.QueryEncoder.Replace(want.Message)))
+	in <- []byte(fmt.Sprintf("error id=%d msg=%s", want.ID, libts.Escape(want.Message)))
 
 	// when
 	_, err := communication.Run(in, writer, []byte(""))
@@ -300,3 +351,87 @@ func TestSplit(t *testing.T) {
 		LogTestError(n, "notify test", t)
 	}
 }
+func TestRunContextCancelled(t *testing.T) {
+	// given
+	writer := &bytes.Buffer{}
+	in := make(chan []byte)
+	defer close(in)
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := []byte("test")
+
+	// when
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err := communication.RunContext(ctx, in, writer, cmd)
+
+	// then
+	if err != context.Canceled {
+		LogTestError(err, context.Canceled, t)
+	}
+	if writer.String() != "test\n" {
+		LogTestError(writer.String(), "test\n", t)
+	}
+}
+
+func TestRunContextAlreadyDone(t *testing.T) {
+	// given
+	writer := &bytes.Buffer{}
+	in := make(chan []byte)
+	defer close(in)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// when
+	_, err := communication.RunContext(ctx, in, writer, []byte("test"))
+
+	// then
+	if err != context.Canceled {
+		LogTestError(err, context.Canceled, t)
+	}
+	if writer.Len() != 0 {
+		LogTestError(writer.String(), "", t, "nothing should be written with a done context")
+	}
+}
+
+func TestWatchContextInterruptsConn(t *testing.T) {
+	// given
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// when
+	stop := communication.WatchContext(ctx, client, 0)
+	defer stop()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err := client.Read(make([]byte, 1))
+
+	// then
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		LogTestError(err, "timeout error", t)
+	}
+}
+
+func TestWatchContextDeadline(t *testing.T) {
+	// given
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// when
+	stop := communication.WatchContext(ctx, client, time.Hour)
+	defer stop()
+	_, err := client.Read(make([]byte, 1))
+
+	// then
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		LogTestError(err, "timeout error", t)
+	}
+}
@@ -0,0 +1,73 @@
+package communication
+
+import "time"
+
+// ReconnectPolicy configures how a Session reestablishes a lost connection
+// After a reconnect the query is logged in again, the previously selected virtual server is used and all event registrations are renewed
+type ReconnectPolicy struct {
+	// MaxAttempts before giving up. 0 for unlimited attempts
+	MaxAttempts int
+	// InitialInterval to wait before the first attempt. Defaults to 1 second
+	InitialInterval time.Duration
+	// MaxInterval between two attempts. Defaults to 1 minute
+	MaxInterval time.Duration
+	// Multiplier the interval grows by with every failed attempt. Defaults to 2
+	Multiplier float64
+
+	// OnDisconnected is called once the connection is lost, err is the reason
+	OnDisconnected func(err error)
+	// OnReconnecting is called before every attempt. attempt starts at 1
+	OnReconnecting func(attempt int)
+	// OnReconnected is called once the connection is reestablished
+	OnReconnected func(attempts int)
+	// OnGiveUp is called after MaxAttempts failed attempts, err is the error of the last attempt
+	OnGiveUp func(err error)
+}
+
+// Backoff returns the interval to wait before attempt (starting at 1)
+func (rp ReconnectPolicy) Backoff(attempt int) time.Duration {
+	interval := rp.InitialInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	max := rp.MaxInterval
+	if max <= 0 {
+		max = time.Minute
+	}
+	multiplier := rp.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	backoff := float64(interval)
+	for i := 1; i < attempt && backoff < float64(max); i++ {
+		backoff *= multiplier
+	}
+	if backoff > float64(max) {
+		return max
+	}
+	return time.Duration(backoff)
+}
+
+func (rp ReconnectPolicy) disconnected(err error) {
+	if rp.OnDisconnected != nil {
+		rp.OnDisconnected(err)
+	}
+}
+
+func (rp ReconnectPolicy) reconnecting(attempt int) {
+	if rp.OnReconnecting != nil {
+		rp.OnReconnecting(attempt)
+	}
+}
+
+func (rp ReconnectPolicy) reconnected(attempts int) {
+	if rp.OnReconnected != nil {
+		rp.OnReconnected(attempts)
+	}
+}
+
+func (rp ReconnectPolicy) givenUp(err error) {
+	if rp.OnGiveUp != nil {
+		rp.OnGiveUp(err)
+	}
+}
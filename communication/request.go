@@ -1,6 +1,15 @@
 package communication
 
-import "github.com/mitchellh/mapstructure"
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
 
 // MarshalRequest takes an interface and decodes it to a map
 // can be used to send structs of arguments to the query
@@ -12,3 +21,108 @@ func MarshalRequest(i interface{}) (map[string]interface{}, error) {
 	}
 	return m, nil
 }
+
+// MarshalChanges returns the fields of after, which differ from before
+// Use it to build edit requests, which only change what was actually changed
+// before and after have to be structs (or pointers to structs) of the same type. Fields without mapstructure tag are ignored
+// Pointers changed to nil are left out, as a value can't be unset
+func MarshalChanges(before, after interface{}) (map[string]interface{}, error) {
+	if reflect.Indirect(reflect.ValueOf(before)).Type() != reflect.Indirect(reflect.ValueOf(after)).Type() {
+		return nil, errors.New("before and after have different types")
+	}
+	b, err := marshalFields(before, false)
+	if err != nil {
+		return nil, err
+	}
+	a, err := marshalFields(after, false)
+	if err != nil {
+		return nil, err
+	}
+	changes := map[string]interface{}{}
+	for k, v := range a {
+		if v == nil {
+			continue
+		}
+		if old, ok := b[k]; !ok || old != v {
+			changes[k] = v
+		}
+	}
+	return changes, nil
+}
+
+// MarshalOptional returns the fields of i, which are set
+// nil pointers and zero values of fields tagged with omitempty (`mapstructure:"channel_name,omitempty"`) are left out
+func MarshalOptional(i interface{}) (map[string]interface{}, error) {
+	return marshalFields(i, true)
+}
+
+// marshalFields returns the fields of struct i as they are sent to teamspeak
+// If optional is true, nil pointers and empty omitempty fields are left out
+func marshalFields(i interface{}, optional bool) (map[string]interface{}, error) {
+	v := reflect.Indirect(reflect.ValueOf(i))
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("unsupported type %s. Expected type struct", v.Kind())
+	}
+	m := map[string]interface{}{}
+	for j := 0; j < v.NumField(); j++ {
+		field := v.Type().Field(j)
+		tag := strings.Split(field.Tag.Get("mapstructure"), ",")
+		if tag[0] == "" || tag[0] == "-" || field.PkgPath != "" {
+			continue
+		}
+		value := v.Field(j)
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				if !optional {
+					m[tag[0]] = nil
+				}
+				continue
+			}
+			value = value.Elem()
+		} else if optional && omitEmpty(tag) && value.IsZero() {
+			continue
+		}
+		s, err := marshalValue(value, unitOf(field))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.Name, err)
+		}
+		m[tag[0]] = s
+	}
+	return m, nil
+}
+
+func omitEmpty(tag []string) bool {
+	for _, option := range tag[1:] {
+		if option == "omitempty" {
+			return true
+		}
+	}
+	return false
+}
+
+// marshalValue returns v in its serverquery representation (e.g. true -> 1)
+// unit is used for time.Duration values
+func marshalValue(v reflect.Value, unit time.Duration) (string, error) {
+	switch v.Type() {
+	case timeType:
+		return formatTime(v.Interface().(time.Time)), nil
+	case durationType:
+		return formatDuration(time.Duration(v.Int()), unit), nil
+	}
+	p := reflect.New(v.Type()) // TextMarshaler might be implemented by the pointer
+	p.Elem().Set(v)
+	if tm, ok := p.Interface().(encoding.TextMarshaler); ok {
+		text, err := tm.MarshalText()
+		return string(text), err
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return "1", nil
+		}
+		return "0", nil
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+		return "", fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return fmt.Sprint(v.Interface()), nil
+}
@@ -0,0 +1,136 @@
+package communication_test
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/schoeppi5/libts/communication"
+)
+
+type editTest struct {
+	Name    string   `mapstructure:"channel_name"`
+	Topic   string   `mapstructure:"channel_topic,omitempty"`
+	Port    *int     `mapstructure:"port"`
+	Default bool     `mapstructure:"channel_flag_default"`
+	Limit   *big.Int `mapstructure:"limit"`
+	Total   big.Int  `mapstructure:"total"`
+	Ignored string
+}
+
+func TestMarshalChanges(t *testing.T) {
+	// given
+	before := editTest{Name: "lobby", Topic: "hi", Limit: big.NewInt(10), Ignored: "a"}
+	after := before
+	after.Name = "Lobby"
+	after.Default = true
+	after.Total.SetInt64(42)
+	after.Ignored = "b"
+	want := map[string]interface{}{
+		"channel_name":         "Lobby",
+		"channel_flag_default": "1",
+		"total":                "42",
+	}
+
+	// when
+	changes, err := communication.MarshalChanges(before, &after)
+
+	// then
+	if err != nil || !reflect.DeepEqual(changes, want) {
+		LogTestError(changes, want, t)
+	}
+}
+
+func TestMarshalChangesWithoutChanges(t *testing.T) {
+	// given
+	before := editTest{Name: "lobby", Limit: big.NewInt(10)}
+	after := before
+	after.Limit = big.NewInt(10)
+
+	// when
+	changes, err := communication.MarshalChanges(before, after)
+
+	// then
+	if err != nil || len(changes) != 0 {
+		LogTestError(changes, map[string]interface{}{}, t)
+	}
+}
+
+func TestMarshalChangesToNil(t *testing.T) {
+	// given
+	port := 9987
+	before := editTest{Name: "lobby", Port: &port, Limit: big.NewInt(10)}
+	after := before
+	after.Port = nil
+	after.Limit = nil
+
+	// when
+	changes, err := communication.MarshalChanges(before, after)
+
+	// then
+	if err != nil || len(changes) != 0 {
+		LogTestError(changes, map[string]interface{}{}, t)
+	}
+}
+
+func TestMarshalChangesDifferentTypes(t *testing.T) {
+	// when
+	_, err := communication.MarshalChanges(editTest{}, struct{}{})
+
+	// then
+	if err == nil {
+		LogTestError(err, "error", t)
+	}
+}
+
+func TestMarshalOptional(t *testing.T) {
+	// given
+	port := 0
+	i := editTest{Port: &port}
+	want := map[string]interface{}{
+		"channel_name":         "",
+		"port":                 "0",
+		"channel_flag_default": "0",
+		"total":                "0",
+	}
+
+	// when
+	m, err := communication.MarshalOptional(i)
+
+	// then
+	if err != nil || !reflect.DeepEqual(m, want) {
+		LogTestError(m, want, t)
+	}
+}
+
+func TestMarshalChangesTime(t *testing.T) {
+	// given
+	type server struct {
+		Created  time.Time     `mapstructure:"virtualserver_created"`
+		IdleTime time.Duration `mapstructure:"client_idle_time" unit:"ms"`
+		Delay    time.Duration `mapstructure:"channel_delete_delay" unit:"s"`
+	}
+	before := server{}
+	after := server{Created: time.Unix(1600000000, 0), IdleTime: 1500 * time.Millisecond, Delay: time.Minute}
+	want := map[string]interface{}{
+		"virtualserver_created": "1600000000",
+		"client_idle_time":      "1500",
+		"channel_delete_delay":  "60",
+	}
+
+	// when
+	changes, err := communication.MarshalChanges(before, after)
+	decoded := server{}
+	for k, v := range changes {
+		communication.DecodeFields(communication.Fields{{Key: k, Value: v.(string)}}, &decoded)
+	}
+
+	// then
+	if err != nil || !reflect.DeepEqual(changes, want) {
+		LogTestError(changes, want, t)
+	}
+	if !reflect.DeepEqual(decoded, after) {
+		LogTestError(decoded, after, t)
+	}
+}
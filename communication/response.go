@@ -5,116 +5,172 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
-	"strings"
 
 	"github.com/mitchellh/mapstructure"
-	"github.com/schoeppi5/libts"
 )
 
 // UnmarshalResponse attempts to parse body to value
 // If value is a single struct, only the first element of body is unmarsheld
 // If value is a slice of structs, UnmarshalResponse will append to that slice
 // If value is an array of structs, UnmarshalResponse will try to set the indices of the array
-func UnmarshalResponse(body []map[string]interface{}, value interface{}) error {
-	kind := reflect.Indirect(reflect.ValueOf(value)).Kind()
-	if kind == reflect.Struct { // one item expected
-		err := Decode(body[0], value)
-		if err != nil {
-			return err
+// If value is nil, the response is discarded. An empty body leaves value untouched
+// Use WithStrict to find fields value doesn't cover
+func UnmarshalResponse(body []map[string]interface{}, value interface{}, opts ...DecodeOption) error {
+	return unmarshal(len(body), func(i int, v interface{}, u *unmapped) error {
+		return decodeMap(body[i], v, u)
+	}, value, DecodeOptions{}.Apply(opts...))
+}
+
+// Unmarshal parses the raw serverquery response r to value (see UnmarshalResponse)
+// The records are decoded straight from the tokenized response
+func Unmarshal(r []byte, value interface{}, opts ...DecodeOption) error {
+	if value == nil {
+		return nil
+	}
+	records := Records(r)
+	return unmarshal(len(records), func(i int, v interface{}, u *unmapped) error {
+		return decodeFields(records[i], v, u)
+	}, value, DecodeOptions{}.Apply(opts...))
+}
+
+// unmarshal decodes n records to value using decode
+func unmarshal(n int, decode func(i int, v interface{}, u *unmapped) error, value interface{}, o DecodeOptions) error {
+	if value == nil {
+		return nil
+	}
+	u := newUnmapped(o)
+	v := reflect.Indirect(reflect.ValueOf(value))
+	switch v.Kind() {
+	case reflect.Struct: // one item expected
+		if n == 0 {
+			return nil
 		}
-	} else if kind == reflect.Slice { // slice of items expected
-		inter := getTypeOfSlice(value)
-		v := reflect.ValueOf(value).Elem()
-		for i := range body {
-			err := Decode(body[i], &inter)
+		return u.finish(o, decode(0, value, u))
+	case reflect.Slice: // slice of items expected
+		v = reflect.ValueOf(value).Elem()
+		for i := 0; i < n; i++ {
+			item := reflect.New(v.Type().Elem())
+			err := decode(i, item.Interface(), u)
 			if err != nil {
 				return err
 			}
-			v.Set(reflect.Append(v, reflect.ValueOf(inter)))
+			v.Set(reflect.Append(v, item.Elem()))
 		}
-	} else if reflect.Indirect(reflect.ValueOf(value)).Kind() == reflect.Array { // array of items expected
-		inter := getTypeOfSlice(value)
-		v := reflect.ValueOf(value).Elem()
-		for i := range body {
-			if i > reflect.Indirect(reflect.ValueOf(value)).Len()-1 { // reached end of expected output
-				break
-			}
-			err := Decode(body[i], &inter)
+	case reflect.Array: // array of items expected
+		v = reflect.ValueOf(value).Elem()
+		for i := 0; i < n && i < v.Len(); i++ { // stop at the end of expected output
+			item := reflect.New(v.Type().Elem())
+			err := decode(i, item.Interface(), u)
 			if err != nil {
 				return err
 			}
-			v.Index(i).Set(reflect.ValueOf(inter))
+			v.Index(i).Set(item.Elem())
 		}
-	} else {
-		return fmt.Errorf("unsupported type %s. Expected type struct, slice or array", reflect.Indirect(reflect.ValueOf(value)).Kind())
+	default:
+		return fmt.Errorf("unsupported type %s. Expected type struct, slice or array", v.Kind())
 	}
-	return nil
+	return u.finish(o, nil)
+}
+
+// Decode decodes m to v
+// Structs with string values use the cached decoder (see DecodeFields), everything else is decoded by mapstructure
+func Decode(m map[string]interface{}, v interface{}, opts ...DecodeOption) error {
+	o := DecodeOptions{}.Apply(opts...)
+	u := newUnmapped(o)
+	return u.finish(o, decodeMap(m, v, u))
 }
 
-// Decode creates a new decoder and decodes m to v
-func Decode(m map[string]interface{}, v interface{}) error {
+// decodeMap decodes m to v and collects the unmapped fields in u
+func decodeMap(m map[string]interface{}, v interface{}, u *unmapped) error {
 	if reflect.ValueOf(v).Kind() != reflect.Ptr {
 		return errors.New("expected pointer to value, not value")
 	}
+	u.of(v)
+	if p, ok := planOf(v); ok && allStrings(m) {
+		target := reflect.ValueOf(v).Elem()
+		var errs []string
+		for key, value := range m {
+			if err := p.decode(target, key, value.(string), u); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		return decodeError(errs)
+	}
+	m, err := withUnits(m, reflect.TypeOf(v).Elem())
+	if err != nil {
+		return err
+	}
+	var md *mapstructure.Metadata
+	if u != nil {
+		md = &mapstructure.Metadata{}
+	}
 	decodeConfig := &mapstructure.DecoderConfig{
-		DecodeHook:       mapstructure.TextUnmarshallerHookFunc(),
-		Metadata:         nil,
+		DecodeHook:       mapstructure.ComposeDecodeHookFunc(timeHookFunc, mapstructure.TextUnmarshallerHookFunc()),
+		Metadata:         md,
 		Result:           v,
 		WeaklyTypedInput: true,
 	}
 	decoder, _ := mapstructure.NewDecoder(decodeConfig)
-	err := decoder.Decode(m)
+	err = decoder.Decode(m)
 	if err != nil {
 		return err
 	}
+	if md != nil {
+		for _, key := range md.Unused {
+			u.addUnmapped(key)
+		}
+	}
 	return nil
 }
 
-// getTypeOfSlice returns the zero value for the type of a slice or arry
-// e.g.: []struct{} -> zero value of struct{}
-func getTypeOfSlice(s interface{}) interface{} {
-	return reflect.Zero(reflect.ValueOf(s).Elem().Type().Elem()).Interface()
+func allStrings(m map[string]interface{}) bool {
+	for _, v := range m {
+		if _, ok := v.(string); !ok {
+			return false
+		}
+	}
+	return true
 }
 
 // IsError returns the error if any
+// The returned error is a QueryError (even for id 0). Use ResponseError to report it
 func IsError(r []byte) error {
 	parts := bytes.SplitN(r, []byte(" "), 2)
-	if bytes.Compare(parts[0], []byte("error")) == 0 {
-		e := &QueryError{}
-		err := UnmarshalResponse(ConvertResponse(parts[1]), e)
-		if err != nil {
-			return err
+	if bytes.Equal(parts[0], []byte("error")) {
+		e := QueryError{}
+		if len(parts) == 2 {
+			err := DecodeFields(tokenizeRecord(string(parts[1])), &e)
+			if err != nil {
+				return err
+			}
 		}
-		return *e
+		return e
 	}
 	return nil
 }
 
 // ConvertResponse parses the serverquery response to a map
+// For commands sent with -continueonerror, only the data of the successful items is parsed
 func ConvertResponse(r []byte) []map[string]interface{} {
-	var list []map[string]interface{}
-	r = bytes.Trim(bytes.TrimSpace(r), "|")
-	items := bytes.Split(r, []byte("|"))
-	for j := range items {
-		list = append(list, responseToMap(items[j]))
+	records := Records(r)
+	list := make([]map[string]interface{}, len(records))
+	for i := range records {
+		list[i] = records[i].Map()
 	}
 	return list
 }
 
-func responseToMap(r []byte) map[string]interface{} {
-	m := make(map[string]interface{})
-	pairs := bytes.Split(r, []byte(" "))
-	for i := range pairs {
-		kV := bytes.SplitN(pairs[i], []byte("="), 2)
-		key := string(kV[0])
-		if len(kV) != 2 {
-			m[key] = ""
-			continue
-		}
-		if strings.Contains(key, "client_default_channel") { // I do not know why. The client_default_channel is wrongly encoded. I don't know why
-			kV[1] = []byte(libts.QueryDecoder.Replace(string(kV[1])))
+// Records tokenizes the serverquery response r (see Tokenize)
+// For commands sent with -continueonerror, only the records of the successful items are returned
+func Records(r []byte) []Fields {
+	if bytes.IndexByte(r, '\n') >= 0 { // line by line response (see lines)
+		data := [][]byte{}
+		for _, result := range lines(r) {
+			if result.Err == nil && len(result.Data) != 0 {
+				data = append(data, result.Data)
+			}
 		}
-		m[key] = libts.QueryDecoder.Replace(string(kV[1]))
+		r = bytes.Join(data, []byte("|"))
 	}
-	return m
+	return Tokenize(string(bytes.Trim(bytes.TrimSpace(r), "|")))
 }
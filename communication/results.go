@@ -0,0 +1,100 @@
+package communication
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/schoeppi5/libts"
+)
+
+// Result is the outcome of a single item of a bulk request (see Each)
+type Result struct {
+	// Index of the item in the records of the request (e.g. 1 for clid=6 of clid=5|clid=6)
+	Index int
+	// Data of the item, if it succeeded
+	Data []byte
+	// Err is the QueryError of the item, nil if it succeeded
+	Err error
+}
+
+// Decode parses the data of r to value (see Unmarshal)
+// Without data, value is left untouched
+func (r Result) Decode(value interface{}) error {
+	if len(r.Data) == 0 {
+		return nil
+	}
+	return Unmarshal(r.Data, value)
+}
+
+// Each sends every record of req as a request of its own and returns one Result per record, in the order of the records
+// The pairs and flags of req are sent with every record, except -continueonerror. The lines answering a command sent with -continueonerror
+// can't be assigned to its items reliably, so the items are sent one at a time
+// Each only fails, if an item fails without a QueryError (e.g. the connection was lost or ctx is done)
+func Each(ctx context.Context, q libts.Query, req libts.Request) ([]Result, error) {
+	params := req.Ordered()
+	flags := []libts.Flag{}
+	for _, f := range params.Flags {
+		if f != libts.FlagContinueOnError {
+			flags = append(flags, f)
+		}
+	}
+	results := make([]Result, len(params.Records))
+	for i, record := range params.Records {
+		item := libts.Request{
+			ServerID: req.ServerID,
+			Command:  req.Command,
+			Params: &libts.Params{
+				Pairs:   params.Pairs,
+				Records: [][]libts.Arg{record},
+				Flags:   flags,
+			},
+		}
+		data, err := q.DoRawContext(ctx, item)
+		results[i] = Result{Index: i, Data: data}
+		if err == nil {
+			continue
+		}
+		var qe QueryError
+		if !errors.As(err, &qe) { // EmptyResultError unwraps to a QueryError as well
+			return nil, err
+		}
+		results[i].Data, results[i].Err = nil, err
+	}
+	return results, nil
+}
+
+// lines splits the raw response of a command sent with -continueonerror into its data and error lines
+// Teamspeak answers a failed item with its error line and a succeeded item with its data, if any
+func lines(raw []byte) []Result {
+	results := []Result{}
+	if len(raw) == 0 {
+		return results
+	}
+	for _, line := range bytes.Split(raw, []byte("\n")) {
+		err := IsError(line)
+		if err == nil {
+			results = append(results, Result{Data: line})
+			continue
+		}
+		r := Result{}
+		if e, ok := err.(QueryError); !ok {
+			r.Err = err
+		} else if e.ID != 0 {
+			r.Err = ResponseError(e)
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// continuesOnError returns true, if command r is sent with -continueonerror
+// Teamspeak answers the failed items with their own error line and ends the response with the error line of the whole command (id 0)
+func continuesOnError(r []byte) bool {
+	for _, field := range bytes.Split(bytes.TrimRight(r, "\r\n"), []byte(" ")) {
+		if string(field) == string(libts.FlagContinueOnError) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package communication_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/cassette"
+	"github.com/schoeppi5/libts/communication"
+)
+
+func TestRunContinueOnError(t *testing.T) {
+	// given
+	writer := &bytes.Buffer{}
+	in := make(chan []byte, 4)
+	defer close(in)
+	in <- []byte("banid=1|banid=2")
+	in <- []byte("error id=512 msg=invalid\\sclientID")
+	in <- []byte("banid=3")
+	in <- []byte("error id=0 msg=ok")
+	cmd := []byte("banclient clid=1|clid=2|clid=3 time=60 -continueonerror")
+	want := "banid=1|banid=2\nerror id=512 msg=invalid\\sclientID\nbanid=3"
+
+	// when
+	data, err := communication.Run(in, writer, cmd)
+
+	// then
+	if err != nil {
+		LogTestError(err.Error(), "", t, "error while running cmd")
+	}
+	if string(data) != want {
+		LogTestError(string(data), want, t)
+	}
+	if len(in) != 0 {
+		LogTestError(len(in), 0, t, "not all lines of the response were read")
+	}
+}
+
+func TestRunContinueOnErrorWithoutOutput(t *testing.T) {
+	// given
+	writer := &bytes.Buffer{}
+	in := make(chan []byte, 2)
+	defer close(in)
+	in <- []byte("error id=512 msg=invalid\\sclientID")
+	in <- []byte("error id=0 msg=ok")
+	cmd := []byte("clientkick clid=1|clid=2|clid=3 reasonid=5 -continueonerror")
+	want := "error id=512 msg=invalid\\sclientID"
+
+	// when
+	data, err := communication.Run(in, writer, cmd)
+
+	// then
+	if err != nil || string(data) != want {
+		LogTestError(string(data), want, t, fmt.Sprint(err))
+	}
+}
+
+func TestEach(t *testing.T) {
+	t.Parallel()
+	// given
+	ban := func(clid int) *cassette.Request {
+		return cassette.NewRequest(libts.Request{ServerID: 1, Command: "banclient", Args: map[string]interface{}{"clid": clid, "time": 60}})
+	}
+	p := cassette.NewPlayer([]cassette.Entry{
+		{Request: ban(1), Response: "banid=1|banid=2"},
+		{Request: ban(2), Error: &communication.QueryError{ID: 512, Message: "invalid clientID"}},
+		{Request: ban(3), Response: "banid=3"},
+	}, cassette.Strict)
+	req := libts.Request{ServerID: 1, Command: "banclient", Args: map[string]interface{}{"clid": []int{1, 2, 3}, "time": 60, "-continueonerror": ""}}
+
+	// when
+	results, err := communication.Each(context.Background(), p, req)
+
+	// then
+	if err != nil || len(results) != 3 {
+		LogTestError(results, "3 results", t, fmt.Sprint(err))
+		return
+	}
+	for i, r := range results {
+		if r.Index != i {
+			LogTestError(r.Index, i, t)
+		}
+	}
+	if string(results[0].Data) != "banid=1|banid=2" || results[0].Err != nil {
+		LogTestError(results[0], "banid=1|banid=2", t)
+	}
+	if !errors.Is(results[1].Err, libts.ErrInvalidClientID) || len(results[1].Data) != 0 {
+		LogTestError(results[1], libts.ErrInvalidClientID, t)
+	}
+	ids := []struct {
+		ID int `mapstructure:"banid"`
+	}{}
+	if err := results[2].Decode(&ids); err != nil || len(ids) != 1 || ids[0].ID != 3 {
+		LogTestError(ids, 3, t)
+	}
+}
+
+func TestEachConnectionLost(t *testing.T) {
+	t.Parallel()
+	// given
+	kick := func(clid int) *cassette.Request {
+		return cassette.NewRequest(libts.Request{Command: "clientkick", Args: map[string]interface{}{"clid": clid, "reasonid": 5}})
+	}
+	p := cassette.NewPlayer([]cassette.Entry{
+		{Request: kick(1)},
+		{Request: kick(2), Failure: "connection closed"},
+	}, cassette.Strict)
+	req := libts.Request{Command: "clientkick", Args: map[string]interface{}{"clid": []int{1, 2, 3}, "reasonid": 5}}
+
+	// when
+	results, err := communication.Each(context.Background(), p, req)
+
+	// then
+	if err == nil || err.Error() != "connection closed" || results != nil {
+		LogTestError(err, "connection closed", t, fmt.Sprint(results))
+	}
+}
+
+func TestConvertResponseContinueOnError(t *testing.T) {
+	t.Parallel()
+	// given
+	raw := []byte("banid=1\nerror id=512 msg=invalid\\sclientID\nbanid=3")
+	ids := []struct {
+		ID int `mapstructure:"banid"`
+	}{}
+
+	// when
+	err := communication.UnmarshalResponse(communication.ConvertResponse(raw), &ids)
+
+	// then
+	if err != nil || len(ids) != 2 || ids[0].ID != 1 || ids[1].ID != 3 {
+		LogTestError(ids, "[{ID:1} {ID:3}]", t)
+	}
+}
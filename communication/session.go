@@ -0,0 +1,358 @@
+package communication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/schoeppi5/libts"
+)
+
+// ErrSessionClosed is returned for requests to a closed Session
+var ErrSessionClosed = errors.New("session closed")
+
+// Connection is a single established connection to teamspeak
+type Connection struct {
+	// In receives all lines, that aren't notifications
+	In <-chan []byte
+	// Notify receives all notifications
+	Notify <-chan []byte
+	// Out is used to send commands
+	Out io.Writer
+	// Closer closes the connection
+	Closer io.Closer
+	// Lost receives the reason, once the connection is lost
+	Lost <-chan error
+	// KeepAlive is the interval of the keepalive lines written by the Session (0 for none)
+	KeepAlive time.Duration
+}
+
+// NewConnection starts reading from r and slurps the header
+// Commands are written to w. closer is used to close the connection
+// buffer is the size of the In and Notify channels
+func NewConnection(r io.Reader, w io.Writer, closer io.Closer, buffer int) (*Connection, error) {
+	in := make(chan []byte, buffer)
+	notify := make(chan []byte, buffer)
+	lost := make(chan error, 1)
+	go func() {
+		lost <- Read(r, in, notify) // split the input from teamspeak into notifys and everything else
+	}()
+	err := ReadHeader(in)
+	if err != nil {
+		closer.Close()
+		return nil, err
+	}
+	return &Connection{
+		In:     in,
+		Notify: notify,
+		Out:    w,
+		Closer: closer,
+		Lost:   lost,
+	}, nil
+}
+
+// Close the connection
+func (c *Connection) Close() error {
+	return c.Closer.Close()
+}
+
+// Dialer establishes a new Connection
+type Dialer func(ctx context.Context) (*Connection, error)
+
+// Setup prepares a newly established connection (e.g. login) before it is used
+type Setup func(ctx context.Context, d *Dispatcher) error
+
+// Session is the shared codebase of serverquery and sshquery
+// It dispatches the requests over the current connection and, if a ReconnectPolicy is set, reestablishes the connection once it is lost
+// The notification channel stays open across reconnects
+type Session struct {
+	dial     Dialer
+	setup    Setup
+	timeout  time.Duration
+	notify   chan []byte
+	notifier *notifier // forwards to notify, only used by the watch goroutine of the current connection
+	done     chan struct{}
+
+	lock          sync.Mutex
+	policy        *ReconnectPolicy
+	conn          *Connection
+	dispatcher    *Dispatcher
+	ready         chan struct{} // closed once the session is connected or gone for good
+	err           error         // set when the session is gone for good
+	closed        bool
+	registrations []libts.Request
+}
+
+// NewSession dials the first connection and runs setup on it
+// timeout is used by the Dispatcher for requests without a deadline
+// buffer is the size of the notification channel
+func NewSession(ctx context.Context, dial Dialer, setup Setup, timeout time.Duration, buffer int) (*Session, error) {
+	s := &Session{
+		dial:    dial,
+		setup:   setup,
+		timeout: timeout,
+		notify:  make(chan []byte, buffer),
+		done:    make(chan struct{}),
+		ready:   make(chan struct{}),
+	}
+	s.notifier = &notifier{c: s.notify}
+	err := s.connect(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SetReconnectPolicy enables (or with nil disables) reconnecting once the connection is lost
+func (s *Session) SetReconnectPolicy(p *ReconnectPolicy) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.policy = p
+}
+
+// Do sends req and returns the raw response
+// While the session is reconnecting, Do waits until the connection is reestablished or ctx is done
+func (s *Session) Do(ctx context.Context, req libts.Request) ([]byte, error) {
+	for {
+		d, err := s.current(ctx)
+		if err != nil {
+			return nil, err
+		}
+		data, err := d.Do(ctx, req.ServerID, []byte(req.String()))
+		if err == ErrDispatcherClosed { // connection was lost before req was sent. Wait for the next one
+			continue
+		}
+		if err == nil {
+			s.track(req, d)
+		}
+		return data, err
+	}
+}
+
+// Use selects the virtual server sid for all following requests without a ServerID
+func (s *Session) Use(ctx context.Context, sid int) error {
+	for {
+		d, err := s.current(ctx)
+		if err != nil {
+			return err
+		}
+		err = d.Use(ctx, sid)
+		if err == ErrDispatcherClosed {
+			continue
+		}
+		return err
+	}
+}
+
+// ServerID returns the currently selected virtual server (0 while reconnecting)
+func (s *Session) ServerID() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.dispatcher == nil {
+		return 0
+	}
+	return s.dispatcher.ServerID()
+}
+
+// Notification returns the channel receiving all notifications
+// It is closed once the session is gone for good. Missed notifications are reported by a GapNotification
+func (s *Session) Notification() <-chan []byte {
+	return s.notify
+}
+
+// Close the session. The goodbye requests (e.g. logout and quit) are sent beforehand, ignoring their errors
+func (s *Session) Close(goodbye ...libts.Request) {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.done)
+	d, conn := s.dispatcher, s.conn
+	s.lock.Unlock()
+	if d == nil { // reconnecting. The reconnect loop cleans up
+		return
+	}
+	for _, r := range goodbye {
+		d.Do(context.Background(), r.ServerID, []byte(r.String()))
+	}
+	d.Close()
+	conn.Close()
+}
+
+// current returns the dispatcher of the current connection
+func (s *Session) current(ctx context.Context) (*Dispatcher, error) {
+	for {
+		s.lock.Lock()
+		d, ready, err := s.dispatcher, s.ready, s.err
+		s.lock.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		if d != nil {
+			return d, nil
+		}
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// track remembers the event registrations, so they can be renewed after a reconnect
+// Repeated registrations are only remembered once. servernotifyunregister removes all of them
+func (s *Session) track(req libts.Request, d *Dispatcher) {
+	switch req.Command {
+	case "servernotifyregister":
+		if req.ServerID == 0 {
+			req.ServerID = d.ServerID()
+		}
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		for _, r := range s.registrations {
+			if sameRegistration(r, req) {
+				return
+			}
+		}
+		s.registrations = append(s.registrations, req)
+	case "servernotifyunregister":
+		s.lock.Lock()
+		s.registrations = nil
+		s.lock.Unlock()
+	}
+}
+
+// sameRegistration returns true, if a and b register the same event (event, id and virtual server)
+func sameRegistration(a, b libts.Request) bool {
+	return a.ServerID == b.ServerID && fmt.Sprint(a.Args["event"]) == fmt.Sprint(b.Args["event"]) && fmt.Sprint(a.Args["id"]) == fmt.Sprint(b.Args["id"])
+}
+
+// connect dials a new connection, prepares it and restores the state of the session (virtual server and registrations)
+func (s *Session) connect(ctx context.Context, sid int) error {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	d := NewDispatcher(conn.In, conn.Out, s.timeout)
+	if conn.KeepAlive > 0 {
+		d.KeepAlive(conn.KeepAlive)
+	}
+	err = s.restore(ctx, d, sid)
+	if err != nil {
+		d.Close()
+		conn.Close()
+		return err
+	}
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		d.Close()
+		conn.Close()
+		return ErrSessionClosed
+	}
+	s.conn, s.dispatcher = conn, d
+	close(s.ready)
+	s.lock.Unlock()
+	go s.watch(conn, d)
+	return nil
+}
+
+func (s *Session) restore(ctx context.Context, d *Dispatcher, sid int) error {
+	if s.setup != nil {
+		err := s.setup(ctx, d)
+		if err != nil {
+			return err
+		}
+	}
+	if sid != 0 {
+		err := d.Use(ctx, sid)
+		if err != nil {
+			return err
+		}
+	}
+	s.lock.Lock()
+	registrations := append([]libts.Request{}, s.registrations...)
+	s.lock.Unlock()
+	for _, r := range registrations {
+		_, err := d.Do(ctx, r.ServerID, []byte(r.String()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watch forwards the notifications of conn until it is lost and then reconnects if wanted
+func (s *Session) watch(conn *Connection, d *Dispatcher) {
+	for n := range conn.Notify {
+		s.notifier.send(n) // non blocking write to notify
+	}
+	err := <-conn.Lost
+	s.lock.Lock()
+	policy := s.policy
+	if s.closed || policy == nil { // keep the dispatcher, so requests fail because of the lost connection
+		s.lock.Unlock()
+		s.notifier.close()
+		close(s.notify)
+		return
+	}
+	sid := d.ServerID()
+	s.notifier.lost() // the notifications sent while reconnecting are missed
+	s.conn, s.dispatcher = nil, nil
+	s.ready = make(chan struct{})
+	s.lock.Unlock()
+	d.Close()
+	conn.Close()
+	policy.disconnected(err)
+	s.reconnect(*policy, sid)
+}
+
+func (s *Session) reconnect(policy ReconnectPolicy, sid int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-time.After(policy.Backoff(attempt)):
+		case <-s.done:
+			s.fail(ErrSessionClosed)
+			return
+		}
+		policy.reconnecting(attempt)
+		err := s.connect(ctx, sid)
+		if err == nil {
+			policy.reconnected(attempt)
+			return
+		}
+		if err == ErrSessionClosed {
+			s.fail(err)
+			return
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			s.fail(err)
+			policy.givenUp(err)
+			return
+		}
+	}
+}
+
+// fail ends the session for good
+func (s *Session) fail(err error) {
+	s.lock.Lock()
+	s.err = err
+	close(s.ready)
+	s.lock.Unlock()
+	s.notifier.close()
+	close(s.notify)
+}
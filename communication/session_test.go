@@ -0,0 +1,299 @@
+package communication_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/communication"
+)
+
+func okScript(cmd string) []string {
+	if strings.HasPrefix(cmd, "echo ") {
+		return []string{strings.TrimPrefix(cmd, "echo "), "error id=0 msg=ok"}
+	}
+	return []string{"error id=0 msg=ok"}
+}
+
+func login(ctx context.Context, d *communication.Dispatcher) error {
+	_, err := d.Do(ctx, 0, []byte("login client_login_name=test client_login_password=secret"))
+	return err
+}
+
+func fastPolicy() *communication.ReconnectPolicy {
+	return &communication.ReconnectPolicy{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     5 * time.Millisecond,
+	}
+}
+
+func TestSessionDo(t *testing.T) {
+	t.Parallel()
+	// given
+	fs := newFakeServer(okScript)
+	s, err := communication.NewSession(context.Background(), fs.Dial, login, time.Second, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// when
+	have, err := s.Do(context.Background(), libts.Request{Command: "echo", Args: map[string]interface{}{"a": 1}})
+
+	// then
+	if err != nil {
+		LogTestError(err, nil, t)
+	}
+	if string(have) != "a=1" {
+		LogTestError(string(have), "a=1", t)
+	}
+	if sent := fs.Sent(); sent[0] != "login client_login_name=test client_login_password=secret" {
+		LogTestError(sent[0], "login", t, "expected setup to run first")
+	}
+}
+
+func TestSessionWithoutPolicyFailsForGood(t *testing.T) {
+	t.Parallel()
+	// given
+	fs := newFakeServer(okScript)
+	s, err := communication.NewSession(context.Background(), fs.Dial, nil, time.Second, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// when
+	fs.Kill()
+	_, open := <-s.Notification()
+	_, err = s.Do(context.Background(), libts.Request{Command: "version"})
+
+	// then
+	if open {
+		LogTestError(open, false, t, "expected notification channel to be closed")
+	}
+	if err == nil {
+		LogTestError(err, "error", t, "expected request on lost connection to fail")
+	}
+	if fs.Dials() != 1 {
+		LogTestError(fs.Dials(), 1, t)
+	}
+}
+
+func TestSessionReconnectRestoresState(t *testing.T) {
+	t.Parallel()
+	// given
+	fs := newFakeServer(okScript)
+	s, err := communication.NewSession(context.Background(), fs.Dial, login, time.Second, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	reconnected := make(chan int, 1)
+	policy := fastPolicy()
+	policy.OnReconnected = func(attempts int) {
+		reconnected <- attempts
+	}
+	s.SetReconnectPolicy(policy)
+	register := libts.Request{
+		ServerID: 3,
+		Command:  "servernotifyregister",
+		Args:     map[string]interface{}{"event": "server"},
+	}
+	for i := 0; i < 2; i++ { // renewed only once
+		_, err = s.Do(context.Background(), register)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs.lock.Lock()
+	fs.fail = 2 // the first two attempts fail
+	fs.lock.Unlock()
+
+	// when
+	fs.Kill()
+	attempts := <-reconnected
+
+	// then
+	if attempts != 3 {
+		LogTestError(attempts, 3, t)
+	}
+	want := []string{
+		"login client_login_name=test client_login_password=secret",
+		"use sid=3",
+		"servernotifyregister event=server",
+		"servernotifyregister event=server",
+		"login client_login_name=test client_login_password=secret",
+		"use sid=3",
+		"servernotifyregister event=server",
+	}
+	if have := fs.Sent(); strings.Join(have, ",") != strings.Join(want, ",") {
+		LogTestError(have, want, t)
+	}
+	if s.ServerID() != 3 {
+		LogTestError(s.ServerID(), 3, t)
+	}
+}
+
+func TestSessionNotificationsSurviveReconnect(t *testing.T) {
+	t.Parallel()
+	// given
+	fs := newFakeServer(okScript)
+	s, err := communication.NewSession(context.Background(), fs.Dial, nil, time.Second, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	reconnected := make(chan int, 1)
+	policy := fastPolicy()
+	policy.OnReconnected = func(attempts int) {
+		reconnected <- attempts
+	}
+	s.SetReconnectPolicy(policy)
+	fs.Notify("notifytest a=1")
+	if n := <-s.Notification(); string(n) != "notifytest a=1" {
+		LogTestError(string(n), "notifytest a=1", t)
+	}
+
+	// when
+	fs.Kill()
+	<-reconnected
+	fs.Notify("notifytest a=2")
+
+	// then
+	for _, want := range []string{communication.GapNotification + " dropped=0", "notifytest a=2"} { // the reconnect is reported as gap first
+		n, open := <-s.Notification()
+		if !open {
+			t.Fatal("notification channel closed by reconnect")
+		}
+		if string(n) != want {
+			LogTestError(string(n), want, t)
+		}
+	}
+}
+
+func TestSessionRequestsWaitForReconnect(t *testing.T) {
+	t.Parallel()
+	// given
+	fs := newFakeServer(okScript)
+	s, err := communication.NewSession(context.Background(), fs.Dial, nil, time.Second, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	policy := fastPolicy()
+	policy.InitialInterval = 20 * time.Millisecond
+	s.SetReconnectPolicy(policy)
+
+	// when
+	fs.Kill()
+	time.Sleep(5 * time.Millisecond) // let the session notice
+	have, err := s.Do(context.Background(), libts.Request{Command: "echo", Args: map[string]interface{}{"a": 1}})
+
+	// then
+	if err != nil {
+		LogTestError(err, nil, t)
+	}
+	if string(have) != "a=1" {
+		LogTestError(string(have), "a=1", t)
+	}
+}
+
+func TestSessionGiveUp(t *testing.T) {
+	t.Parallel()
+	// given
+	fs := newFakeServer(okScript)
+	s, err := communication.NewSession(context.Background(), fs.Dial, nil, time.Second, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	lock := sync.Mutex{}
+	events := []string{}
+	record := func(e string) {
+		lock.Lock()
+		defer lock.Unlock()
+		events = append(events, e)
+	}
+	gaveUp := make(chan error, 1)
+	policy := fastPolicy()
+	policy.MaxAttempts = 2
+	policy.OnDisconnected = func(err error) { record("disconnected") }
+	policy.OnReconnecting = func(attempt int) { record("reconnecting") }
+	policy.OnGiveUp = func(err error) { gaveUp <- err }
+	s.SetReconnectPolicy(policy)
+	fs.lock.Lock()
+	fs.fail = 5
+	fs.lock.Unlock()
+
+	// when
+	fs.Kill()
+	<-gaveUp
+	_, err = s.Do(context.Background(), libts.Request{Command: "version"})
+	notifications := []string{}
+	for n := range s.Notification() { // closed after the gap of the lost connection
+		notifications = append(notifications, string(n))
+	}
+
+	// then
+	if err == nil || err.Error() != "connection refused" {
+		LogTestError(err, "connection refused", t)
+	}
+	if strings.Join(notifications, ",") != communication.GapNotification+" dropped=0" {
+		LogTestError(notifications, communication.GapNotification+" dropped=0", t)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if strings.Join(events, ",") != "disconnected,reconnecting,reconnecting" {
+		LogTestError(events, "disconnected,reconnecting,reconnecting", t)
+	}
+}
+
+func TestSessionClose(t *testing.T) {
+	t.Parallel()
+	// given
+	fs := newFakeServer(okScript)
+	s, err := communication.NewSession(context.Background(), fs.Dial, nil, time.Second, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetReconnectPolicy(fastPolicy())
+
+	// when
+	s.Close(libts.Request{Command: "quit"})
+	_, open := <-s.Notification()
+	time.Sleep(10 * time.Millisecond)
+
+	// then
+	if open {
+		LogTestError(open, false, t, "expected notification channel to be closed")
+	}
+	if fs.Dials() != 1 {
+		LogTestError(fs.Dials(), 1, t, "closed session must not reconnect")
+	}
+	if sent := fs.Sent(); sent[len(sent)-1] != "quit" {
+		LogTestError(sent, "quit", t)
+	}
+}
+
+func TestReconnectPolicyBackoff(t *testing.T) {
+	t.Parallel()
+	// given
+	rp := communication.ReconnectPolicy{
+		InitialInterval: time.Second,
+		MaxInterval:     5 * time.Second,
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+
+	for i := range want {
+		// when
+		have := rp.Backoff(i + 1)
+
+		// then
+		if have != want[i] {
+			LogTestError(have, want[i], t)
+		}
+	}
+}
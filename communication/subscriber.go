@@ -2,6 +2,12 @@ package communication
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
 
 	"github.com/schoeppi5/libts"
 )
@@ -10,38 +16,170 @@ import (
 
 // SortEvents to the appropriate channels
 // exits when in is closed
-// either sends the event as event.Template or an error when failed to parse
+// every listener of an event either gets a new value of the type of its Template or an error when failed to parse (see newEvent)
+// Events the Filter of a listener returns false for are not sent to it
+// Slow listeners are handled according to their Backpressure. Missed events are reported with a libts.Gap
 // SortEvents returns if es is nil
 func SortEvents(in <-chan []byte, es *EventStore) {
+	RouteEvents(in, es, nil)
+}
+
+// RouteEvents is like SortEvents, but only sends the notifications to the listeners with a matching Route
+// Teamspeak doesn't send the virtual server with a notification, so it is attributed to the server returned by selected
+// (the one currently used by the query). If selected is nil or returns 0, it is attributed to the only server with a matching listener
+// or, if several servers match, delivered to all of them
+func RouteEvents(in <-chan []byte, es *EventStore, selected func() int) {
 	if es == nil {
 		return
 	}
 	for {
 		notify, open := <-in
 		if !open {
-			for _, v := range es.Keys() { // close all listening channels
-				e, _ := es.Get(v)
-				close(e.C)
+			listeners := es.all()
+			for _, l := range listeners {
+				l.box.stop()
+			}
+			closed := map[chan<- interface{}]bool{}
+			for _, l := range listeners { // close all listening channels, which might be shared by several listeners
+				if l.event != nil && !closed[l.event.C] {
+					closed[l.event.C] = true
+					close(l.event.C)
+				}
 			}
 			return
 		}
 		n := bytes.SplitN(notify, []byte(" "), 2) // 0 -> type | 1 -> notification data
-		if e, ok := es.Get(string(n[0])); ok {
-			err := UnmarshalResponse(ConvertResponse(n[1]), e.Template)
+		fields := Fields{}
+		if len(n) == 2 {
+			fields = tokenizeRecord(string(n[1]))
+		}
+		if string(n[0]) == GapNotification { // notifications were lost before reaching es
+			dropped, _ := fields.Get("dropped")
+			g := libts.Gap{}
+			g.Dropped, _ = strconv.ParseUint(dropped, 10, 64)
+			reported := map[chan<- interface{}]bool{}
+			for _, l := range es.all() { // once per channel
+				if l.event != nil && !reported[l.event.C] {
+					reported[l.event.C] = true
+					l.box.reportGap(g)
+				}
+			}
+			continue
+		}
+		listeners := es.listeners(string(n[0]))
+		if len(listeners) == 0 {
+			continue
+		}
+		listeners, sid := route(listeners, fields, selected)
+		if sid != 0 {
+			fields = append(fields, Field{Key: "sid", Value: strconv.Itoa(sid)})
+		}
+		for _, l := range listeners {
+			e := l.event
+			event, err := newEvent(e.Template, fields)
 			if err != nil { // If an error occures, discard event
-				e.C <- err
+				l.box.deliver(err)
 				continue
 			}
-			e.C <- e.Template
+			if e.Filter != nil && !e.Filter(event) {
+				continue
+			}
+			l.box.deliver(event)
+		}
+	}
+}
+
+// route returns the listeners matching the notification f and the virtual server it was sent by (0 if unknown)
+func route(listeners []listener, f Fields, selected func() int) ([]listener, int) {
+	matching := listeners[:0]
+	servers := map[int]bool{}
+	for _, l := range listeners {
+		if !l.route.matchesChannel(f) {
+			continue
+		}
+		matching = append(matching, l)
+		if l.route.ServerID != 0 {
+			servers[l.route.ServerID] = true
 		}
 	}
+	sid := 0
+	if selected != nil {
+		sid = selected()
+	}
+	if sid == 0 && len(servers) == 1 { // unknown origin, so attribute it to the only subscribed server
+		for s := range servers {
+			sid = s
+		}
+	}
+	if sid == 0 {
+		return matching, 0
+	}
+	routed := matching[:0]
+	for _, l := range matching {
+		if l.route.ServerID == 0 || l.route.ServerID == sid {
+			routed = append(routed, l)
+		}
+	}
+	return routed, sid
+}
+
+// newEvent decodes f to a new value of the type of template
+// For pointer templates (&ClientMovedEvent{}) a new pointer is returned, for other templates the value itself
+// template is never written to, so the events can be used while the next ones are decoded
+func newEvent(template interface{}, f Fields) (interface{}, error) {
+	t := reflect.TypeOf(template)
+	if t == nil {
+		return nil, errors.New("event without template")
+	}
+	pointer := t.Kind() == reflect.Ptr
+	if pointer {
+		t = t.Elem()
+	}
+	v := reflect.New(t)
+	err := unmarshal(1, func(_ int, v interface{}, u *unmapped) error {
+		return decodeFields(f, v, u)
+	}, v.Interface(), DecodeOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if pointer {
+		return v.Interface(), nil
+	}
+	return v.Elem().Interface(), nil
 }
 
 // BasicSubscriber implements the libts.Subscriber interface
+// Every subscription has its own listeners, so any number of subscriptions can receive the same event
 type BasicSubscriber struct {
 	query         libts.Query
 	subscriptions *EventStore
 	serverID      int
+	lock          sync.Mutex
+	lastID        libts.SubscriptionID
+	registrations map[registration]map[libts.SubscriptionID]bool // servernotifyregister calls and the subscriptions using them
+	subscribed    map[libts.SubscriptionID]registration
+}
+
+// registration is a single servernotifyregister call
+type registration struct {
+	serverID  int
+	name      string
+	channelID int
+}
+
+// request returns the servernotifyregister request of r
+func (r registration) request() libts.Request {
+	req := libts.Request{
+		ServerID: r.serverID,
+		Command:  "servernotifyregister",
+		Args: map[string]interface{}{
+			"event": r.name,
+		},
+	}
+	if r.name == "channel" {
+		req.Args["id"] = r.channelID
+	}
+	return req
 }
 
 // NewBasicSubscriber takes a Query and adds Subscriber capabilities
@@ -50,48 +188,116 @@ func NewBasicSubscriber(q libts.Query, serverID int) *BasicSubscriber {
 		query:         q,
 		subscriptions: NewEventStore(),
 		serverID:      serverID,
+		registrations: map[registration]map[libts.SubscriptionID]bool{},
+		subscribed:    map[libts.SubscriptionID]registration{},
+	}
+	var selected func() int
+	if q, ok := q.(interface{ ServerID() int }); ok {
+		selected = q.ServerID
 	}
-	go SortEvents(bs.query.Notification(), bs.subscriptions)
+	go RouteEvents(bs.query.Notification(), bs.subscriptions, selected)
 	return bs
 }
 
 // Subscribe to s and attempt to parse the responses
-func (bs *BasicSubscriber) Subscribe(s libts.Subscription) error {
-	return bs.register(s)
+// Returns the id of the new subscription
+func (bs *BasicSubscriber) Subscribe(s libts.Subscription) (libts.SubscriptionID, error) {
+	return bs.register(context.Background(), s)
+}
+
+// SubscribeContext to s and attempt to parse the responses
+// The registration is aborted once ctx is done
+func (bs *BasicSubscriber) SubscribeContext(ctx context.Context, s libts.Subscription) (libts.SubscriptionID, error) {
+	return bs.register(ctx, s)
 }
 
 // register sets up the subscription
-func (bs *BasicSubscriber) register(s libts.Subscription) error {
-	// create command for subscription
-	r := libts.Request{
-		ServerID: bs.serverID,
-		Command:  "servernotifyregister",
-		Args: map[string]interface{}{
-			"event": s.Name,
-		},
+// servernotifyregister is only sent, if no other subscription uses the same registration
+func (bs *BasicSubscriber) register(ctx context.Context, s libts.Subscription) (libts.SubscriptionID, error) {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	reg := registration{serverID: s.ServerID, name: s.Name}
+	if reg.serverID == 0 {
+		reg.serverID = bs.serverID
 	}
 	if s.Name == "channel" {
-		r.Args["id"] = s.ChannelID
+		reg.channelID = s.ChannelID
+	}
+	if _, ok := bs.registrations[reg]; !ok {
+		_, err := bs.query.DoRawContext(ctx, reg.request())
+		if err != nil {
+			return 0, err
+		}
+		bs.registrations[reg] = map[libts.SubscriptionID]bool{}
 	}
-	// run command
-	_, err := bs.query.DoRaw(r)
+	bs.lastID++
+	id := bs.lastID
+	bs.registrations[reg][id] = true
+	bs.subscribed[id] = reg
+	for name, e := range s.Events {
+		e := e
+		bs.subscriptions.AddRoute(id, name, Route{ServerID: reg.serverID, ChannelID: reg.channelID}, &e)
+	}
+	return id, nil
+}
+
+// Unsubscribe removes the subscription id
+func (bs *BasicSubscriber) Unsubscribe(id libts.SubscriptionID) error {
+	return bs.UnsubscribeContext(context.Background(), id)
+}
+
+// UnsubscribeContext removes the subscription id
+// servernotifyunregister is sent once no other subscription uses the same registration
+// It can't unregister single events, so the registrations still in use are renewed afterwards
+// The requests are aborted once ctx is done
+func (bs *BasicSubscriber) UnsubscribeContext(ctx context.Context, id libts.SubscriptionID) error {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	reg, ok := bs.subscribed[id]
+	if !ok {
+		return fmt.Errorf("unknown subscription %d", id)
+	}
+	bs.subscriptions.Remove(id)
+	delete(bs.subscribed, id)
+	delete(bs.registrations[reg], id)
+	if len(bs.registrations[reg]) != 0 { // still used by other subscriptions
+		return nil
+	}
+	delete(bs.registrations, reg)
+	_, err := bs.query.DoRawContext(ctx,
+		libts.Request{
+			ServerID: bs.serverID,
+			Command:  "servernotifyunregister",
+		},
+	)
 	if err != nil {
 		return err
 	}
-	for i, v := range s.Events {
-		bs.subscriptions.Add(i, &v) // override existing subscriptions and add new ones
+	for r := range bs.registrations {
+		_, err = bs.query.DoRawContext(ctx, r.request())
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-// Unsubscribe from e
-func (bs *BasicSubscriber) Unsubscribe(e string) {
-	bs.subscriptions.Del(e) // delete e from map
+// Dropped returns the number of events dropped because of the Backpressure of subscription id
+func (bs *BasicSubscriber) Dropped(id libts.SubscriptionID) uint64 {
+	return bs.subscriptions.Dropped(id)
 }
 
 // UnsubscribeAll removes all current subscriptions
 func (bs *BasicSubscriber) UnsubscribeAll() error {
-	_, err := bs.query.DoRaw(
+	return bs.UnsubscribeAllContext(context.Background())
+}
+
+// UnsubscribeAllContext removes all current subscriptions
+// The request is aborted once ctx is done
+func (bs *BasicSubscriber) UnsubscribeAllContext(ctx context.Context) error {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	_, err := bs.query.DoRawContext(ctx,
 		libts.Request{
 			ServerID: bs.serverID,
 			Command:  "servernotifyunregister",
@@ -99,5 +305,7 @@ func (bs *BasicSubscriber) UnsubscribeAll() error {
 	)
 	bs.serverID = 0
 	bs.subscriptions.Clean()
+	bs.registrations = map[registration]map[libts.SubscriptionID]bool{}
+	bs.subscribed = map[libts.SubscriptionID]registration{}
 	return err
 }
@@ -1,11 +1,19 @@
 package communication_test
 
 import (
+	"fmt"
+	"net"
 	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/schoeppi5/libts"
 	"github.com/schoeppi5/libts/communication"
+	"github.com/schoeppi5/libts/serverquery"
+	"github.com/schoeppi5/libts/tstest"
 )
 
 func TestSortEvents(t *testing.T) {
@@ -27,7 +35,7 @@ func TestSortEvents(t *testing.T) {
 		Template: &tmp{},
 	}
 	es := communication.NewEventStore()
-	es.Add("notifytest", event)
+	es.Add(1, "notifytest", event)
 
 	// when
 	go communication.SortEvents(in, es)
@@ -52,23 +60,271 @@ func TestSortEventsNonPointerTemplate(t *testing.T) {
 		Test1 int `mapstructure:"test1"`
 		Test2 int `mapstructure:"test2"`
 	}
+	want := tmp{
+		Test1: 1,
+		Test2: 2,
+	}
 	event := &libts.Event{
 		C:        c,
 		Template: tmp{}, // non pointer
 	}
 	es := communication.NewEventStore()
-	es.Add("notifytest", event)
+	es.Add(1, "notifytest", event)
 
 	// when
 	go communication.SortEvents(in, es)
 
 	// then
 	notify := <-c
-	if _, ok := notify.(error); !ok {
-		LogTestError(reflect.TypeOf(c), "error", t)
+	if e, ok := notify.(tmp); !ok || e != want {
+		LogTestError(notify, want, t)
+	}
+}
+
+func TestSortEventsNewValuePerEvent(t *testing.T) {
+	// given
+	const burst = 500
+	c := make(chan interface{})
+	in := make(chan []byte, burst)
+	defer close(in)
+	type moved struct {
+		ID     int `mapstructure:"clid"`
+		Target int `mapstructure:"ctid"`
+	}
+	template := &moved{}
+	es := communication.NewEventStore()
+	es.Add(1, "notifyclientmoved", &libts.Event{C: c, Template: template})
+	for i := 0; i < burst; i++ {
+		in <- []byte(fmt.Sprintf("notifyclientmoved ctid=%d reasonid=0 clid=%d", i%10, i))
+	}
+
+	// when
+	go communication.SortEvents(in, es)
+
+	// then
+	events := make([]*moved, 0, burst)
+	for i := 0; i < burst; i++ {
+		e := (<-c).(*moved)
+		if e.ID != i || e.Target != i%10 { // read while the next event is decoded
+			LogTestError(e, moved{ID: i, Target: i % 10}, t)
+		}
+		events = append(events, e)
+	}
+	for i, e := range events { // no event was overwritten later on
+		if e.ID != i || e == template {
+			LogTestError(e, moved{ID: i, Target: i % 10}, t)
+		}
+	}
+	if *template != (moved{}) {
+		LogTestError(template, moved{}, t)
+	}
+}
+
+func TestSortEventsConcurrentConsumers(t *testing.T) {
+	// given
+	const burst = 200
+	c := make(chan interface{}, burst)
+	in := make(chan []byte, burst)
+	type moved struct {
+		ID int `mapstructure:"clid"`
+	}
+	es := communication.NewEventStore()
+	es.Add(1, "notifyclientmoved", &libts.Event{C: c, Template: moved{}})
+	for i := 0; i < burst; i++ {
+		in <- []byte(fmt.Sprintf("notifyclientmoved ctid=1 reasonid=0 clid=%d", i))
+	}
+	close(in)
+	go communication.SortEvents(in, es)
+
+	// when
+	sum := int64(0)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range c {
+				atomic.AddInt64(&sum, int64(e.(moved).ID))
+			}
+		}()
+	}
+	wg.Wait()
+
+	// then
+	if want := int64(burst * (burst - 1) / 2); sum != want {
+		LogTestError(sum, want, t)
+	}
+}
+
+func TestSortEventsFanOut(t *testing.T) {
+	// given
+	first := make(chan interface{}, 1)
+	second := make(chan interface{}, 1)
+	in := make(chan []byte, 1)
+	type moved struct {
+		ID int `mapstructure:"clid"`
+	}
+	es := communication.NewEventStore()
+	es.Add(1, "notifyclientmoved", &libts.Event{C: first, Template: &moved{}})
+	es.Add(2, "notifyclientmoved", &libts.Event{C: second, Template: &moved{}})
+	in <- []byte("notifyclientmoved ctid=1 reasonid=0 clid=5")
+	close(in)
+
+	// when
+	communication.SortEvents(in, es)
+
+	// then
+	a, b := <-first, <-second
+	if e, ok := a.(*moved); !ok || e.ID != 5 {
+		LogTestError(a, &moved{ID: 5}, t)
 	}
-	if e := notify.(error); e.Error() != "expected pointer to value, not value" {
-		LogTestError(e, "expected pointer to value, not value", t)
+	if e, ok := b.(*moved); !ok || e.ID != 5 {
+		LogTestError(b, &moved{ID: 5}, t)
+	}
+	if a == b {
+		LogTestError(a, "a value per listener", t)
+	}
+}
+
+func TestSortEventsFilter(t *testing.T) {
+	// given
+	c := make(chan interface{}, 2)
+	in := make(chan []byte, 2)
+	type moved struct {
+		ID     int `mapstructure:"clid"`
+		Target int `mapstructure:"ctid"`
+	}
+	es := communication.NewEventStore()
+	es.Add(1, "notifyclientmoved", &libts.Event{
+		C:        c,
+		Template: moved{},
+		Filter: func(event interface{}) bool {
+			return event.(moved).Target == 2
+		},
+	})
+	in <- []byte("notifyclientmoved ctid=1 reasonid=0 clid=5")
+	in <- []byte("notifyclientmoved ctid=2 reasonid=0 clid=6")
+	close(in)
+
+	// when
+	communication.SortEvents(in, es)
+
+	// then
+	have := []interface{}{}
+	for e := range c {
+		have = append(have, e)
+	}
+	if want := []interface{}{moved{ID: 6, Target: 2}}; !reflect.DeepEqual(have, want) {
+		LogTestError(have, want, t)
+	}
+}
+
+func TestSortEventsSharedChannel(t *testing.T) {
+	// given
+	c := make(chan interface{}, 2)
+	in := make(chan []byte)
+	close(in)
+	es := communication.NewEventStore()
+	es.Add(1, "notifyclientmoved", &libts.Event{C: c, Template: ""})
+	es.Add(2, "notifyclientmoved", &libts.Event{C: c, Template: ""})
+	es.Add(2, "notifycliententerview", &libts.Event{C: c, Template: ""})
+
+	// when
+	communication.SortEvents(in, es)
+
+	// then
+	// passes when c isn't closed twice
+	if _, open := <-c; open {
+		LogTestError(open, false, t)
+	}
+}
+
+func TestRouteEventsChannel(t *testing.T) {
+	// given
+	five := make(chan interface{}, 1)
+	seven := make(chan interface{}, 1)
+	all := make(chan interface{}, 1)
+	in := make(chan []byte, 1)
+	type edited struct {
+		ID int `mapstructure:"cid"`
+	}
+	es := communication.NewEventStore()
+	es.AddRoute(1, "notifychanneledited", communication.Route{ChannelID: 5}, &libts.Event{C: five, Template: edited{}})
+	es.AddRoute(2, "notifychanneledited", communication.Route{ChannelID: 7}, &libts.Event{C: seven, Template: edited{}})
+	es.Add(3, "notifychanneledited", &libts.Event{C: all, Template: edited{}})
+	in <- []byte("notifychanneledited cid=5 reasonid=10 channel_name=test")
+	close(in)
+
+	// when
+	communication.SortEvents(in, es)
+
+	// then
+	if have := <-five; have != (edited{ID: 5}) {
+		LogTestError(have, edited{ID: 5}, t)
+	}
+	if have, open := <-seven; open {
+		LogTestError(have, nil, t, "event of another channel received")
+	}
+	if have := <-all; have != (edited{ID: 5}) {
+		LogTestError(have, edited{ID: 5}, t)
+	}
+}
+
+func TestRouteEventsServer(t *testing.T) {
+	// given
+	first := make(chan interface{}, 2)
+	second := make(chan interface{}, 2)
+	in := make(chan []byte, 2)
+	type joined struct {
+		ID       int `mapstructure:"clid"`
+		ServerID int `mapstructure:"sid"`
+	}
+	type message struct {
+		Message  string `mapstructure:"msg"`
+		ServerID int    `mapstructure:"sid"`
+	}
+	es := communication.NewEventStore()
+	es.AddRoute(1, "notifycliententerview", communication.Route{ServerID: 1}, &libts.Event{C: first, Template: joined{}})
+	es.AddRoute(2, "notifycliententerview", communication.Route{ServerID: 2}, &libts.Event{C: second, Template: joined{}})
+	es.AddRoute(2, "notifytextmessage", communication.Route{ServerID: 2}, &libts.Event{C: second, Template: message{}})
+	in <- []byte("notifycliententerview cfid=0 ctid=1 reasonid=0 clid=5")
+	in <- []byte("notifytextmessage targetmode=3 msg=hello") // sent by server 1, which only has listeners for other events
+	close(in)
+
+	// when
+	communication.RouteEvents(in, es, func() int { return 1 })
+
+	// then
+	if have := <-first; have != (joined{ID: 5, ServerID: 1}) {
+		LogTestError(have, joined{ID: 5, ServerID: 1}, t)
+	}
+	if have, open := <-first; open {
+		LogTestError(have, nil, t, "event of another server received")
+	}
+	if have, open := <-second; open {
+		LogTestError(have, nil, t, "event of another server received")
+	}
+}
+
+func TestRouteEventsUnknownServer(t *testing.T) {
+	// given
+	first := make(chan interface{}, 1)
+	in := make(chan []byte, 1)
+	type message struct {
+		Message  string `mapstructure:"msg"`
+		ServerID int    `mapstructure:"sid"`
+	}
+	es := communication.NewEventStore()
+	es.AddRoute(1, "notifytextmessage", communication.Route{ServerID: 1}, &libts.Event{C: first, Template: message{}})
+	in <- []byte("notifytextmessage targetmode=3 msg=hello")
+	close(in)
+
+	// when
+	communication.RouteEvents(in, es, func() int { return 0 }) // e.g. while reconnecting
+
+	// then
+	if have := <-first; have != (message{Message: "hello", ServerID: 1}) {
+		LogTestError(have, message{Message: "hello", ServerID: 1}, t)
 	}
 }
 
@@ -85,4 +341,445 @@ func TestSortEventsClosedChannel(t *testing.T) {
 	// passes when not killed by deadline
 }
 
-// TODO: BasicSubscriber test (needs query Mock)
+func TestBasicSubscriber(t *testing.T) {
+	// given
+	s := tstest.NewServer()
+	defer s.Close()
+	addr, err := s.ListenTelnet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, p, _ := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(p)
+	sq, err := serverquery.NewServerQuery(host, port, "serveradmin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sq.Close()
+	bs := communication.NewBasicSubscriber(sq, 1)
+	c := make(chan interface{}, 1)
+	type deleted struct {
+		ID int `mapstructure:"cid"`
+	}
+	_, err = bs.Subscribe(libts.Subscription{
+		Name:      "channel",
+		ChannelID: 0,
+		Events: map[string]libts.Event{
+			"notifychanneldeleted": {Template: &deleted{}, C: c},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// when
+	_, err = sq.DoRaw(libts.Request{ServerID: 1, Command: "channelcreate", Args: map[string]interface{}{"channel_name": "test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sq.DoRaw(libts.Request{ServerID: 1, Command: "channeldelete", Args: map[string]interface{}{"cid": 2, "force": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// then
+	select {
+	case have := <-c:
+		if e, ok := have.(*deleted); !ok || e.ID != 2 {
+			LogTestError(have, &deleted{ID: 2}, t)
+		}
+	case <-time.After(time.Second):
+		LogTestError(nil, &deleted{ID: 2}, t, "no event received")
+	}
+	if received := s.Received(); received[len(received)-3] != "servernotifyregister event=channel id=0" {
+		LogTestError(received, "servernotifyregister event=channel id=0", t)
+	}
+}
+
+func TestBasicSubscriberUnsubscribe(t *testing.T) {
+	// given
+	s := tstest.NewServer()
+	defer s.Close()
+	addr, err := s.ListenTelnet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, p, _ := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(p)
+	sq, err := serverquery.NewServerQuery(host, port, "serveradmin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sq.Close()
+	bs := communication.NewBasicSubscriber(sq, 1)
+	first := make(chan interface{}, 1)
+	second := make(chan interface{}, 1)
+	type created struct {
+		ID int `mapstructure:"cid"`
+	}
+	subscribe := func(c chan interface{}) libts.SubscriptionID {
+		id, err := bs.Subscribe(libts.Subscription{
+			Name: "channel",
+			Events: map[string]libts.Event{
+				"notifychannelcreated": {Template: &created{}, C: c},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	firstID, secondID := subscribe(first), subscribe(second)
+	registered := 0
+	for _, r := range s.Received() {
+		if r == "servernotifyregister event=channel id=0" {
+			registered++
+		}
+	}
+	if registered != 1 {
+		LogTestError(registered, 1, t, "servernotifyregister")
+	}
+
+	// when
+	err = bs.Unsubscribe(firstID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sq.DoRaw(libts.Request{ServerID: 1, Command: "channelcreate", Args: map[string]interface{}{"channel_name": "test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// then
+	select {
+	case have := <-second:
+		if e, ok := have.(*created); !ok || e.ID != 2 {
+			LogTestError(have, &created{ID: 2}, t)
+		}
+	case <-time.After(time.Second):
+		LogTestError(nil, &created{ID: 2}, t, "no event received")
+	}
+	select {
+	case have := <-first:
+		LogTestError(have, nil, t, "event received after unsubscribe")
+	default:
+	}
+	for _, r := range s.Received() {
+		if r == "servernotifyunregister" {
+			LogTestError(r, nil, t, "unregistered with a subscription left")
+		}
+	}
+	err = bs.Unsubscribe(secondID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received := s.Received(); received[len(received)-1] != "servernotifyunregister" {
+		LogTestError(received, "servernotifyunregister", t)
+	}
+	if err = bs.Unsubscribe(secondID); err == nil {
+		LogTestError(err, "unknown subscription 2", t)
+	}
+}
+
+func TestBasicSubscriberRenewsRegistrations(t *testing.T) {
+	// given
+	s := tstest.NewServer()
+	defer s.Close()
+	addr, err := s.ListenTelnet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, p, _ := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(p)
+	sq, err := serverquery.NewServerQuery(host, port, "serveradmin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sq.Close()
+	bs := communication.NewBasicSubscriber(sq, 1)
+	subscribe := func(name string) libts.SubscriptionID {
+		id, err := bs.Subscribe(libts.Subscription{
+			Name:   name,
+			Events: map[string]libts.Event{"notifytest": {Template: &struct{}{}, C: make(chan interface{}, 1)}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	channel := subscribe("channel")
+	subscribe("server")
+
+	// when
+	err = bs.Unsubscribe(channel)
+
+	// then
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := s.Received()
+	want := []string{"servernotifyunregister", "servernotifyregister event=server"}
+	if have := received[len(received)-2:]; !reflect.DeepEqual(have, want) {
+		LogTestError(have, want, t)
+	}
+}
+
+func TestBasicSubscriberServers(t *testing.T) {
+	// given
+	s := tstest.NewServer()
+	defer s.Close()
+	s.Update(func(m *tstest.Model) {
+		m.Servers = append(m.Servers, &tstest.VirtualServer{
+			ID:       2,
+			Port:     9988,
+			Name:     "Second Server",
+			Status:   "online",
+			Channels: []*tstest.Channel{{ID: 1, Name: "Default Channel"}},
+		})
+	})
+	addr, err := s.ListenTelnet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, p, _ := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(p)
+	sq, err := serverquery.NewServerQuery(host, port, "serveradmin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sq.Close()
+	bs := communication.NewBasicSubscriber(sq, 1)
+	joined := make(chan interface{}, 1)
+	messages := make(chan interface{}, 1)
+	type event struct {
+		ServerID int `mapstructure:"sid"`
+	}
+	_, err = bs.Subscribe(libts.Subscription{
+		Name:   "server",
+		Events: map[string]libts.Event{"notifycliententerview": {Template: event{}, C: joined}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = bs.Subscribe(libts.Subscription{
+		ServerID: 2,
+		Name:     "textserver",
+		Events:   map[string]libts.Event{"notifytextmessage": {Template: event{}, C: messages}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// when
+	events := []interface{}{}
+	for _, r := range []struct {
+		sid    int
+		action func() error
+		c      chan interface{}
+	}{
+		{1, func() error { s.Connect(1, &tstest.Client{Nickname: "Alice"}); return nil }, joined},
+		{2, func() error {
+			_, err := sq.DoRaw(libts.Request{ServerID: 2, Command: "sendtextmessage", Args: map[string]interface{}{"targetmode": 3, "msg": "hello"}})
+			return err
+		}, messages},
+	} {
+		if _, err := sq.DoRaw(libts.Request{ServerID: r.sid, Command: "whoami"}); err != nil { // the events are attributed to the selected server
+			t.Fatal(err)
+		}
+		if err := r.action(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case have := <-r.c:
+			events = append(events, have)
+		case <-time.After(time.Second):
+			events = append(events, nil)
+		}
+	}
+
+	// then
+	want := []interface{}{event{ServerID: 1}, event{ServerID: 2}}
+	if !reflect.DeepEqual(events, want) {
+		LogTestError(events, want, t)
+	}
+}
+
+// numbered is the event of the backpressure tests
+type numbered struct {
+	I int `mapstructure:"i"`
+}
+
+func TestSortEventsDropNewest(t *testing.T) {
+	// given
+	c := make(chan interface{}, 2)
+	in := make(chan []byte)
+	defer close(in)
+	es := communication.NewEventStore()
+	es.Add(1, "notifytest", &libts.Event{C: c, Template: numbered{}, Backpressure: libts.DropNewest})
+	go communication.SortEvents(in, es)
+
+	// when
+	for i := 1; i <= 4; i++ {
+		in <- []byte(fmt.Sprintf("notifytest i=%d", i))
+	}
+	in <- []byte("notifyother") // all events are sorted once this is received
+	have := []interface{}{<-c, <-c}
+	in <- []byte("notifytest i=5")
+	have = append(have, <-c, <-c)
+
+	// then
+	want := []interface{}{
+		numbered{I: 1},
+		numbered{I: 2},
+		libts.Gap{Dropped: 2},
+		numbered{I: 5},
+	}
+	if !reflect.DeepEqual(have, want) {
+		LogTestError(have, want, t)
+	}
+	if dropped := es.Dropped(1); dropped != 2 {
+		LogTestError(dropped, 2, t)
+	}
+}
+
+func TestSortEventsDropOldest(t *testing.T) {
+	// given
+	const events = 10
+	c := make(chan interface{})
+	in := make(chan []byte)
+	defer close(in)
+	es := communication.NewEventStore()
+	es.Add(1, "notifytest", &libts.Event{C: c, Template: numbered{}, Backpressure: libts.DropOldest, Buffer: 2})
+	go communication.SortEvents(in, es)
+
+	// when
+	for i := 1; i <= events; i++ {
+		in <- []byte(fmt.Sprintf("notifytest i=%d", i))
+	}
+	in <- []byte("notifyother")
+
+	// then
+	have := []interface{}{}
+	for len(have) == 0 || !reflect.DeepEqual(have[len(have)-1], numbered{I: 10}) {
+		select {
+		case e := <-c:
+			have = append(have, e)
+		case <-time.After(time.Second):
+			t.Fatalf("last event missing, received %v", have)
+		}
+	}
+	tail := []interface{}{numbered{I: 9}, numbered{I: 10}}
+	if len(have) < 3 || !reflect.DeepEqual(have[len(have)-2:], tail) {
+		LogTestError(have, tail, t)
+	}
+	if _, ok := have[len(have)-3].(libts.Gap); !ok {
+		LogTestError(have, "gap before the last events", t)
+	}
+	delivered, gaps := uint64(0), uint64(0)
+	for _, e := range have {
+		if g, ok := e.(libts.Gap); ok {
+			gaps += g.Dropped
+			continue
+		}
+		delivered++
+	}
+	if dropped := es.Dropped(1); gaps != dropped || delivered+dropped != events {
+		LogTestError([]uint64{delivered, dropped, gaps}, []uint64{events - dropped, dropped, dropped}, t, "delivered, dropped, reported")
+	}
+}
+
+func TestSortEventsUnbounded(t *testing.T) {
+	// given
+	const events = 5
+	c := make(chan interface{})
+	in := make(chan []byte)
+	defer close(in)
+	highWater := make(chan int, events)
+	es := communication.NewEventStore()
+	es.Add(1, "notifytest", &libts.Event{
+		C:            c,
+		Template:     numbered{},
+		Backpressure: libts.Unbounded,
+		HighWater:    3,
+		OnHighWater: func(queued int) {
+			highWater <- queued
+		},
+	})
+	go communication.SortEvents(in, es)
+
+	// when
+	for i := 1; i <= events; i++ {
+		in <- []byte(fmt.Sprintf("notifytest i=%d", i))
+	}
+	in <- []byte("notifyother")
+
+	// then
+	for i := 1; i <= events; i++ {
+		if have, want := <-c, (numbered{I: i}); !reflect.DeepEqual(have, want) {
+			LogTestError(have, want, t)
+		}
+	}
+	close(highWater)
+	have := []int{}
+	for queued := range highWater {
+		have = append(have, queued)
+	}
+	if len(have) != 1 || have[0] < 2 || have[0] > 3 { // the first event might be taken already
+		LogTestError(have, []int{3}, t)
+	}
+	if dropped := es.Dropped(1); dropped != 0 {
+		LogTestError(dropped, 0, t)
+	}
+}
+
+func TestSortEventsBlockUnsubscribed(t *testing.T) {
+	// given
+	abandoned := make(chan interface{}) // not read anymore, e.g. after Handlers.Close
+	c := make(chan interface{}, 1)
+	in := make(chan []byte)
+	defer close(in)
+	es := communication.NewEventStore()
+	es.Add(1, "notifytest", &libts.Event{C: abandoned, Template: numbered{}})
+	es.Add(2, "notifytest", &libts.Event{C: c, Template: numbered{}})
+	go communication.SortEvents(in, es)
+	in <- []byte("notifytest i=1") // blocks on abandoned
+
+	// when
+	es.Remove(1)
+	in <- []byte("notifytest i=2")
+
+	// then
+	for i := 1; i <= 2; i++ {
+		select {
+		case have := <-c:
+			if have != (numbered{I: i}) {
+				LogTestError(have, numbered{I: i}, t)
+			}
+		case <-time.After(time.Second):
+			LogTestError(nil, numbered{I: i}, t, "routing blocked by a removed listener")
+		}
+	}
+}
+
+func TestSortEventsGap(t *testing.T) {
+	// given
+	c := make(chan interface{}, 2)
+	in := make(chan []byte, 2)
+	es := communication.NewEventStore()
+	es.Add(1, "notifytest", &libts.Event{C: c, Template: ""})
+	es.Add(1, "notifyother", &libts.Event{C: c, Template: ""})
+	in <- []byte(communication.GapNotification + " dropped=4")
+	close(in)
+
+	// when
+	communication.SortEvents(in, es)
+
+	// then
+	have := []interface{}{}
+	for e := range c {
+		have = append(have, e)
+	}
+	if want := []interface{}{libts.Gap{Dropped: 4}}; !reflect.DeepEqual(have, want) {
+		LogTestError(have, want, t, "one gap per channel")
+	}
+}
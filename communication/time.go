@@ -0,0 +1,122 @@
+package communication
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This file contains the conversion of time.Time and time.Duration fields
+// Teamspeak sends points in time as unix timestamps (seconds, 0 for never) and durations as numbers in a unit depending on the field
+// The unit of a duration is set by the unit tag (`unit:"ms"`). Durations without unit tag are in seconds
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// unitOf returns the unit of a time.Duration field
+func unitOf(field reflect.StructField) time.Duration {
+	if field.Tag.Get("unit") == "ms" {
+		return time.Millisecond
+	}
+	return time.Second
+}
+
+// parseTime parses a unix timestamp. Empty and 0 are the zero time
+func parseTime(s string) (time.Time, error) {
+	if s == "" || s == "0" {
+		return time.Time{}, nil
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(i, 0), nil
+}
+
+// formatTime returns t as unix timestamp, the zero time as 0
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// parseDuration parses a number of unit
+func parseDuration(s string, unit time.Duration) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(i) * unit, nil
+}
+
+// formatDuration returns d as number of unit
+func formatDuration(d time.Duration, unit time.Duration) string {
+	return strconv.FormatInt(int64(d/unit), 10)
+}
+
+// timeHookFunc is the mapstructure decode hook for time.Time and time.Duration (in seconds)
+// The hook doesn't know the field, durations in other units are converted by withUnits beforehand
+func timeHookFunc(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	s, ok := data.(string)
+	if !ok {
+		return data, nil
+	}
+	switch to {
+	case timeType:
+		return parseTime(s)
+	case durationType:
+		return parseDuration(s, time.Second)
+	}
+	return data, nil
+}
+
+// withUnits returns m with the values of the time.Duration fields of struct t, which aren't in seconds, converted to time.Duration
+// m is copied, if any value is converted
+func withUnits(m map[string]interface{}, t reflect.Type) (map[string]interface{}, error) {
+	if t.Kind() != reflect.Struct {
+		return m, nil
+	}
+	converted := false
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		unit := unitOf(field)
+		if field.Type != durationType || unit == time.Second {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		for key, value := range m {
+			s, ok := value.(string)
+			if !ok || !strings.EqualFold(key, name) {
+				continue
+			}
+			d, err := parseDuration(s, unit)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", field.Name, err)
+			}
+			if !converted {
+				m, converted = copyMap(m), true
+			}
+			m[key] = d
+		}
+	}
+	return m, nil
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
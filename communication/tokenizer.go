@@ -0,0 +1,87 @@
+package communication
+
+import (
+	"strings"
+
+	"github.com/schoeppi5/libts"
+)
+
+// Field is a single key=value pair of a response
+type Field struct {
+	Key   string
+	Value string
+	// NoValue is true for keys sent without = (e.g. flags), which is not the same as an empty value (key=)
+	NoValue bool
+}
+
+// Fields are the fields of a single record (| separated entry) in the order they were sent
+// Duplicate keys are kept
+type Fields []Field
+
+// Get returns the value of the first field with key
+func (f Fields) Get(key string) (string, bool) {
+	for i := range f {
+		if f[i].Key == key {
+			return f[i].Value, true
+		}
+	}
+	return "", false
+}
+
+// All returns the values of all fields with key
+func (f Fields) All(key string) []string {
+	values := []string{}
+	for i := range f {
+		if f[i].Key == key {
+			values = append(values, f[i].Value)
+		}
+	}
+	return values
+}
+
+// Map returns f in the form used by UnmarshalResponse
+// For duplicate keys, the last value is used
+func (f Fields) Map() map[string]interface{} {
+	m := make(map[string]interface{}, len(f))
+	for i := range f {
+		m[f[i].Key] = f[i].Value
+	}
+	return m
+}
+
+// Tokenize splits r into its records (|) and fields (space) and decodes the values
+// Escaped spaces and pipes (\s, \p) are part of the values, so every raw space or pipe is a separator
+func Tokenize(r string) []Fields {
+	records := make([]Fields, 0, strings.Count(r, "|")+1)
+	for {
+		i := strings.IndexByte(r, '|')
+		if i < 0 {
+			return append(records, tokenizeRecord(r))
+		}
+		records = append(records, tokenizeRecord(r[:i]))
+		r = r[i+1:]
+	}
+}
+
+// tokenizeRecord splits a single record into its fields
+func tokenizeRecord(r string) Fields {
+	fields := make(Fields, 0, strings.Count(r, " ")+1)
+	for len(r) > 0 {
+		field := r
+		if i := strings.IndexByte(r, ' '); i >= 0 {
+			field, r = r[:i], r[i+1:]
+		} else {
+			r = ""
+		}
+		if field == "" {
+			continue
+		}
+		i := strings.IndexByte(field, '=')
+		if i < 0 {
+			fields = append(fields, Field{Key: field, NoValue: true})
+			continue
+		}
+		fields = append(fields, Field{Key: field[:i], Value: libts.Unescape(field[i+1:])})
+	}
+	return fields
+}
@@ -0,0 +1,33 @@
+//go:build go1.18
+// +build go1.18
+
+package communication_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/communication"
+)
+
+func FuzzTokenize(f *testing.F) {
+	f.Add("client_nickname", "hello world")
+	f.Add("msg", `C:\s|p`)
+	f.Add("empty", "")
+	f.Fuzz(func(t *testing.T, key, value string) {
+		for _, c := range key {
+			if c == ' ' || c == '|' || c == '=' || c == '\n' {
+				return // keys are never escaped
+			}
+		}
+		if key == "" {
+			return
+		}
+		want := []communication.Fields{{{Key: key, Value: value}, {Key: "flag", NoValue: true}}}
+		records := communication.Tokenize(key + "=" + libts.Escape(value) + " flag")
+		if !reflect.DeepEqual(records, want) {
+			t.Errorf("Test %s failed!\n\tHave: %+v\n\tWant: %+v", t.Name(), records, want)
+		}
+	})
+}
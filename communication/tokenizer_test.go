@@ -0,0 +1,70 @@
+package communication_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/schoeppi5/libts/communication"
+)
+
+func TestTokenize(t *testing.T) {
+	// given
+	r := `clid=1 client_nickname=a\sb\\s client_away client_away_message=|clid=2 client_servergroups=6 client_servergroups=8`
+	want := []communication.Fields{
+		{
+			{Key: "clid", Value: "1"},
+			{Key: "client_nickname", Value: `a b\s`},
+			{Key: "client_away", NoValue: true},
+			{Key: "client_away_message"},
+		},
+		{
+			{Key: "clid", Value: "2"},
+			{Key: "client_servergroups", Value: "6"},
+			{Key: "client_servergroups", Value: "8"},
+		},
+	}
+
+	// when
+	records := communication.Tokenize(r)
+
+	// then
+	if !reflect.DeepEqual(records, want) {
+		LogTestError(records, want, t)
+	}
+	if groups := records[1].All("client_servergroups"); !reflect.DeepEqual(groups, []string{"6", "8"}) {
+		LogTestError(groups, []string{"6", "8"}, t)
+	}
+}
+
+func TestConvertResponseEscaping(t *testing.T) {
+	// given
+	r := []byte(`client_default_channel=\/1 client_description=C:\\path\\s`)
+	want := []map[string]interface{}{{
+		"client_default_channel": "/1",
+		"client_description":     `C:\path\s`,
+	}}
+
+	// when
+	have := communication.ConvertResponse(r)
+
+	// then
+	if !reflect.DeepEqual(have, want) {
+		LogTestError(have, want, t)
+	}
+}
+
+func BenchmarkTokenize(b *testing.B) {
+	r := `clid=1 cid=2 client_database_id=3 client_nickname=serveradmin\sfrom\s127.0.0.1:1234 client_type=1|clid=4 cid=2 client_database_id=5 client_nickname=user client_type=0`
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		communication.Tokenize(r)
+	}
+}
+
+func BenchmarkConvertResponse(b *testing.B) {
+	r := []byte(`clid=1 cid=2 client_database_id=3 client_nickname=serveradmin\sfrom\s127.0.0.1:1234 client_type=1|clid=4 cid=2 client_database_id=5 client_nickname=user client_type=0`)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		communication.ConvertResponse(r)
+	}
+}
@@ -0,0 +1,154 @@
+package communication
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// UnmappedError reports the fields of a response, which weren't decoded exactly (see WithStrict)
+type UnmappedError struct {
+	// Type of the value, e.g. query.Client
+	Type string
+	// Unmapped are the keys without a matching field
+	Unmapped []string
+	// Lossy are the keys whose values lost information when converted (e.g. "" to 0 or 007 to 7)
+	Lossy []string
+}
+
+func (e UnmappedError) Error() string {
+	parts := []string{}
+	if len(e.Unmapped) != 0 {
+		parts = append(parts, "unmapped fields "+strings.Join(e.Unmapped, ", "))
+	}
+	if len(e.Lossy) != 0 {
+		parts = append(parts, "lossy fields "+strings.Join(e.Lossy, ", "))
+	}
+	return fmt.Sprintf("%s: %s", e.Type, strings.Join(parts, "; "))
+}
+
+// DecodeOptions of Unmarshal, UnmarshalResponse, Decode and DecodeFields
+type DecodeOptions struct {
+	// Strict fails decoding with an UnmappedError, if the response contains fields the value doesn't cover or values which lose information when converted
+	// The value is decoded nevertheless
+	Strict bool
+	// OnUnmapped is called with the unmapped and lossy fields of a response (without failing, unless Strict is set)
+	OnUnmapped func(UnmappedError)
+}
+
+// DecodeOption configures DecodeOptions
+type DecodeOption func(*DecodeOptions)
+
+// WithStrict reports unmapped and lossy fields as error
+func WithStrict() DecodeOption {
+	return func(o *DecodeOptions) {
+		o.Strict = true
+	}
+}
+
+// WithUnmappedHandler calls f with the unmapped and lossy fields of a response
+func WithUnmappedHandler(f func(UnmappedError)) DecodeOption {
+	return func(o *DecodeOptions) {
+		o.OnUnmapped = f
+	}
+}
+
+// Apply opts to a copy of o
+func (o DecodeOptions) Apply(opts ...DecodeOption) DecodeOptions {
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// report returns true, if unmapped fields have to be looked for
+func (o DecodeOptions) report() bool {
+	return o.Strict || o.OnUnmapped != nil
+}
+
+// unmapped collects the unmapped and lossy keys of all records of a response
+// A nil *unmapped collects nothing
+type unmapped struct {
+	typ      string
+	unmapped map[string]bool
+	lossy    map[string]bool
+}
+
+// newUnmapped returns nil, if o doesn't report unmapped fields
+func newUnmapped(o DecodeOptions) *unmapped {
+	if !o.report() {
+		return nil
+	}
+	return &unmapped{unmapped: map[string]bool{}, lossy: map[string]bool{}}
+}
+
+// of sets the type reported for v
+func (u *unmapped) of(v interface{}) {
+	if u != nil && u.typ == "" {
+		u.typ = reflect.Indirect(reflect.ValueOf(v)).Type().String()
+	}
+}
+
+func (u *unmapped) addUnmapped(key string) {
+	if u != nil {
+		u.unmapped[key] = true
+	}
+}
+
+func (u *unmapped) addLossy(key string) {
+	if u != nil {
+		u.lossy[key] = true
+	}
+}
+
+// finish reports the collected fields according to o, if err is nil
+func (u *unmapped) finish(o DecodeOptions, err error) error {
+	if err != nil || u == nil || len(u.unmapped)+len(u.lossy) == 0 {
+		return err
+	}
+	e := UnmappedError{
+		Type:     u.typ,
+		Unmapped: sortedKeys(u.unmapped),
+		Lossy:    sortedKeys(u.lossy),
+	}
+	if o.OnUnmapped != nil {
+		o.OnUnmapped(e)
+	}
+	if o.Strict {
+		return e
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// lossy returns true, if s can't be restored from the decoded value v (e.g. "" decoded to 0)
+func lossy(v reflect.Value, s string) bool {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return s == ""
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10) != s
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10) != s
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		return err != nil || f != v.Float()
+	}
+	return false
+}
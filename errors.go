@@ -0,0 +1,122 @@
+package libts
+
+import "fmt"
+
+// ErrorID is the id of an error sent by teamspeak
+// ErrorIDs can be used as target of errors.Is, e.g. errors.Is(err, libts.ErrInvalidChannelID)
+type ErrorID int
+
+// Documented error ids of teamspeak
+const (
+	ErrOK                 ErrorID = 0
+	ErrUndefined          ErrorID = 1
+	ErrNotImplemented     ErrorID = 2
+	ErrCommandNotFound    ErrorID = 256
+	ErrInvalidClientID    ErrorID = 512
+	ErrNicknameInUse      ErrorID = 513
+	ErrInvalidClientType  ErrorID = 516
+	ErrAlreadySubscribed  ErrorID = 517
+	ErrNotLoggedIn        ErrorID = 518
+	ErrInvalidLogin       ErrorID = 520
+	ErrClientFlooding     ErrorID = 524
+	ErrLoginNotPermitted  ErrorID = 527
+	ErrNotSubscribed      ErrorID = 528
+	ErrInvalidChannelID   ErrorID = 768
+	ErrAlreadyInChannel   ErrorID = 770
+	ErrChannelNameInUse   ErrorID = 771
+	ErrChannelNotEmpty    ErrorID = 772
+	ErrDeleteDefault      ErrorID = 773
+	ErrChannelFull        ErrorID = 777
+	ErrInvalidChannelPW   ErrorID = 781
+	ErrInvalidServerID    ErrorID = 1024
+	ErrServerRunning      ErrorID = 1025
+	ErrServerShuttingDown ErrorID = 1026
+	ErrServerFull         ErrorID = 1027
+	ErrServerNotRunning   ErrorID = 1033
+	ErrDatabase           ErrorID = 1280
+	ErrEmptyResult        ErrorID = 1281
+	ErrDuplicateEntry     ErrorID = 1282
+	ErrNoModifications    ErrorID = 1283
+	ErrInvalidParamCount  ErrorID = 1537
+	ErrInvalidParameter   ErrorID = 1538
+	ErrParameterNotFound  ErrorID = 1539
+	ErrConvertParameter   ErrorID = 1540
+	ErrParameterMissing   ErrorID = 1542
+	ErrInvalidFileName    ErrorID = 2048
+	ErrFilePermissions    ErrorID = 2049
+	ErrFileAlreadyExists  ErrorID = 2050
+	ErrFileNotFound       ErrorID = 2051
+	ErrFileIO             ErrorID = 2052
+	ErrInvalidTransferID  ErrorID = 2053
+	ErrInvalidFilePath    ErrorID = 2054
+	ErrInvalidGroupID     ErrorID = 2560
+	ErrPermDuplicateEntry ErrorID = 2561
+	ErrInvalidPermID      ErrorID = 2562
+	ErrPermEmptyResult    ErrorID = 2563
+	ErrGroupNotEmpty      ErrorID = 2567
+	ErrInsufficientPerms  ErrorID = 2568
+	ErrInsufficientPower  ErrorID = 2569
+	ErrBanned             ErrorID = 3329
+	ErrFloodBan           ErrorID = 3331
+)
+
+var errorMessages = map[ErrorID]string{
+	ErrOK:                 "ok",
+	ErrUndefined:          "undefined error",
+	ErrNotImplemented:     "not implemented",
+	ErrCommandNotFound:    "command not found",
+	ErrInvalidClientID:    "invalid clientID",
+	ErrNicknameInUse:      "nickname is already in use",
+	ErrInvalidClientType:  "invalid client type",
+	ErrAlreadySubscribed:  "client is already subscribed",
+	ErrNotLoggedIn:        "not logged in",
+	ErrInvalidLogin:       "invalid loginname or password",
+	ErrClientFlooding:     "client is flooding",
+	ErrLoginNotPermitted:  "client login not permitted",
+	ErrNotSubscribed:      "client is not subscribed",
+	ErrInvalidChannelID:   "invalid channelID",
+	ErrAlreadyInChannel:   "already member of channel",
+	ErrChannelNameInUse:   "channel name is already in use",
+	ErrChannelNotEmpty:    "channel not empty",
+	ErrDeleteDefault:      "can't delete default channel",
+	ErrChannelFull:        "channel maxclient reached",
+	ErrInvalidChannelPW:   "invalid channel password",
+	ErrInvalidServerID:    "invalid serverID",
+	ErrServerRunning:      "server is running",
+	ErrServerShuttingDown: "server is shutting down",
+	ErrServerFull:         "server maxclient reached",
+	ErrServerNotRunning:   "server is not running",
+	ErrDatabase:           "database error",
+	ErrEmptyResult:        "database empty result set",
+	ErrDuplicateEntry:     "database duplicate entry",
+	ErrNoModifications:    "database no modifications",
+	ErrInvalidParamCount:  "invalid parameter count",
+	ErrInvalidParameter:   "invalid parameter",
+	ErrParameterNotFound:  "parameter not found",
+	ErrConvertParameter:   "convert error",
+	ErrParameterMissing:   "missing required parameter",
+	ErrInvalidFileName:    "invalid file name",
+	ErrFilePermissions:    "invalid file permissions",
+	ErrFileAlreadyExists:  "file already exists",
+	ErrFileNotFound:       "file not found",
+	ErrFileIO:             "file input/output error",
+	ErrInvalidTransferID:  "invalid file transfer id",
+	ErrInvalidFilePath:    "invalid file path",
+	ErrInvalidGroupID:     "invalid group ID",
+	ErrPermDuplicateEntry: "duplicate entry",
+	ErrInvalidPermID:      "invalid permission ID",
+	ErrPermEmptyResult:    "empty result set",
+	ErrGroupNotEmpty:      "group is not empty",
+	ErrInsufficientPerms:  "insufficient client permissions",
+	ErrInsufficientPower:  "insufficient group modify power",
+	ErrBanned:             "connection failed, you are banned",
+	ErrFloodBan:           "flood ban",
+}
+
+// Error returns the message teamspeak sends along with id
+func (id ErrorID) Error() string {
+	if msg, ok := errorMessages[id]; ok {
+		return msg
+	}
+	return fmt.Sprintf("error %d", int(id))
+}
@@ -0,0 +1,84 @@
+package libts
+
+import "strings"
+
+// escapes maps the characters escaped by the serverquery to the character following the \
+var escapes = [256]byte{
+	'\\': '\\',
+	'/':  '/',
+	' ':  's',
+	'|':  'p',
+	'\a': 'a',
+	'\b': 'b',
+	'\f': 'f',
+	'\n': 'n',
+	'\r': 'r',
+	'\t': 't',
+	'\v': 'v',
+}
+
+// unescapes is the reverse of escapes
+var unescapes = [256]byte{
+	'\\': '\\',
+	'/':  '/',
+	's':  ' ',
+	'p':  '|',
+	'a':  '\a',
+	'b':  '\b',
+	'f':  '\f',
+	'n':  '\n',
+	'r':  '\r',
+	't':  '\t',
+	'v':  '\v',
+}
+
+// Escape escapes s to be sent to the serverquery (e.g. "hello world" -> hello\sworld)
+// s is returned without allocation, if it contains nothing to escape
+func Escape(s string) string {
+	i := 0
+	for i < len(s) && escapes[s[i]] == 0 {
+		i++
+	}
+	if i == len(s) {
+		return s
+	}
+	b := strings.Builder{}
+	b.Grow(len(s) + 8)
+	b.WriteString(s[:i])
+	for ; i < len(s); i++ {
+		if e := escapes[s[i]]; e != 0 {
+			b.WriteByte('\\')
+			b.WriteByte(e)
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// Unescape decodes s in a single pass (e.g. hello\sworld -> "hello world", \\s -> \s)
+// Unknown escape sequences and a trailing \ are kept as they are
+// s is returned without allocation, if it contains no \
+func Unescape(s string) string {
+	i := strings.IndexByte(s, '\\')
+	if i < 0 {
+		return s
+	}
+	b := strings.Builder{}
+	b.Grow(len(s))
+	b.WriteString(s[:i])
+	for ; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		u := unescapes[s[i+1]]
+		if u == 0 {
+			b.WriteByte(s[i])
+			continue
+		}
+		b.WriteByte(u)
+		i++
+	}
+	return b.String()
+}
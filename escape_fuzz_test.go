@@ -0,0 +1,26 @@
+//go:build go1.18
+// +build go1.18
+
+package libts_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/schoeppi5/libts"
+)
+
+func FuzzEscape(f *testing.F) {
+	for _, test := range escapeTests {
+		f.Add(test.decoded)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		encoded := libts.Escape(s)
+		if strings.ContainsAny(encoded, " |\n") {
+			t.Errorf("Test %s failed!\n\tHave: %q\n\tWant: no separators", t.Name(), encoded)
+		}
+		if decoded := libts.Unescape(encoded); decoded != s {
+			t.Errorf("Test %s failed!\n\tHave: %q\n\tWant: %q", t.Name(), decoded, s)
+		}
+	})
+}
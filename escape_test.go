@@ -0,0 +1,105 @@
+package libts_test
+
+import (
+	"testing"
+
+	"github.com/schoeppi5/libts"
+)
+
+var escapeTests = []struct {
+	decoded string
+	encoded string
+}{
+	{"", ""},
+	{"hello", "hello"},
+	{"hello world", `hello\sworld`},
+	{`C:\s`, `C:\\s`},
+	{`\`, `\\`},
+	{"a|b/c", `a\pb\/c`},
+	{"line\nbreak\ttab\r\a\b\f\v", `line\nbreak\ttab\r\a\b\f\v`},
+	{"ünïcödé ✓", `ünïcödé\s✓`},
+}
+
+func TestEscape(t *testing.T) {
+	t.Parallel()
+	for _, test := range escapeTests {
+		// when
+		have := libts.Escape(test.decoded)
+
+		// then
+		if have != test.encoded {
+			t.Errorf("Test %s failed!\n\tHave: %q\n\tWant: %q", t.Name(), have, test.encoded)
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	t.Parallel()
+	for _, test := range escapeTests {
+		// when
+		have := libts.Unescape(test.encoded)
+
+		// then
+		if have != test.decoded {
+			t.Errorf("Test %s failed!\n\tHave: %q\n\tWant: %q", t.Name(), have, test.decoded)
+		}
+	}
+}
+
+func TestUnescapeInvalid(t *testing.T) {
+	t.Parallel()
+	// given
+	tests := map[string]string{
+		`\x`:      `\x`,   // unknown sequence
+		`end\`:    `end\`, // trailing backslash
+		`\\\s`:    `\ `,
+		`\\\\s\s`: `\\s `,
+	}
+
+	for encoded, want := range tests {
+		// when
+		have := libts.Unescape(encoded)
+
+		// then
+		if have != want {
+			t.Errorf("Test %s failed!\n\tHave: %q\n\tWant: %q", t.Name(), have, want)
+		}
+	}
+}
+
+func TestEscapeDoesNotAllocate(t *testing.T) {
+	// when
+	allocs := testing.AllocsPerRun(100, func() {
+		libts.Escape("nothing_to_escape")
+		libts.Unescape("nothing_to_unescape")
+	})
+
+	// then
+	if allocs != 0 {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), allocs, 0)
+	}
+}
+
+func BenchmarkEscape(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		libts.Escape("client_nickname")
+		libts.Escape("Hello World | this/is a\ttest")
+	}
+}
+
+func BenchmarkUnescape(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		libts.Unescape("client_nickname")
+		libts.Unescape(`Hello\sWorld\s\p\sthis\/is\sa\ttest`)
+	}
+}
+
+func BenchmarkQueryDecoder(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		libts.QueryDecoder.Replace("client_nickname")
+		libts.QueryDecoder.Replace(`Hello\sWorld\s\p\sthis\/is\sa\ttest`)
+	}
+}
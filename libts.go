@@ -1,13 +1,14 @@
 package libts
 
 import (
-	"fmt"
-	"reflect"
+	"context"
 	"strings"
 )
 
 var (
 	// QueryEncoder escapes special characters as needed
+	//
+	// Deprecated: use Escape
 	QueryEncoder = strings.NewReplacer(
 		`\`, `\\`,
 		`/`, `\/`,
@@ -23,6 +24,8 @@ var (
 	)
 
 	// QueryDecoder replaces escaped characters with thier string representation
+	//
+	// Deprecated: use Unescape
 	QueryDecoder = strings.NewReplacer(
 		`\\`, "\\",
 		`\/`, "/",
@@ -40,58 +43,94 @@ var (
 
 // Request contains all necessary infos for a query request towards teamspeak
 // You need to know, what to expect as an answer
+// The arguments are either given as Params or as Args map (sorted by key, slices as records and keys starting with - as flags)
 type Request struct {
 	ServerID int
 	Command  string
 	Args     map[string]interface{}
+	// Params are used instead of Args, if set
+	Params *Params
 }
 
 // String returns the correct string representation for a serverquery
 func (r Request) String() string {
 	c := r.Command
-	for i, v := range r.Args {
-		vt := reflect.ValueOf(v)
-		if vt.Kind() == reflect.Array || vt.Kind() == reflect.Slice {
-			for j := 0; j < vt.Len(); j++ {
-				if j > 0 {
-					c += "|"
-				} else {
-					c += " "
-				}
-				c += printArg(i, vt.Index(j))
-			}
-		} else {
-			c += fmt.Sprintf(" %s", printArg(i, v))
-		}
+	if params := r.Ordered().String(); params != "" {
+		c += " " + params
 	}
-	c = c + "\n"
-	return c
+	return c + "\n"
 }
 
-func printArg(key string, value interface{}) string {
-	if strings.HasPrefix(key, "-") {
-		return key
+// Ordered returns the arguments of r in the order they are sent
+func (r Request) Ordered() *Params {
+	if r.Params != nil {
+		return r.Params
 	}
-	return fmt.Sprintf("%s=%s", key, QueryEncoder.Replace(fmt.Sprint(value)))
+	return paramsFromMap(r.Args)
+}
+
+// HasFlag returns true, if r is sent with flag
+func (r Request) HasFlag(flag Flag) bool {
+	return r.Ordered().HasFlag(flag)
 }
 
 // Subscription describes an event a subscriber can subscribe to
 // Name is the Name of the "Event" you are subscribing to (server, channel, etc.)
 // Events are the events with the type that represents them you want to recieve. All other are discarded
 // The subscriber will attempt to parse the event to the type of the channel
-// ChannelID is ignored if Subscription is not libts.ChannelEvents
+// ChannelID is ignored if Subscription is not libts.ChannelEvents. Only events of that channel are received (0 for all)
+// ServerID is the virtual server to subscribe to, 0 for the server of the subscriber
 type Subscription struct {
+	ServerID  int
 	ChannelID int
 	Name      string
 	Events    map[string]Event
 }
 
 // Event describes the structure and the channel for a single event (cliententerview, clientleftview, etc.)
+// Every event is decoded to a new value of the type of Template: a pointer template (&T{}) sends a new *T, other templates send a T
+// Filter is optional. Events it returns false for are not sent to C
+// A field of Template tagged sid (`mapstructure:"sid"`) is set to the virtual server the event was sent by
+// Backpressure decides what happens, if C is full. A Gap is sent to C, once events were dropped
 type Event struct {
 	Template interface{}
 	C        chan<- interface{}
+	Filter   func(event interface{}) bool
+	// Backpressure is Block by default
+	Backpressure Backpressure
+	// Buffer is the number of events queued by DropOldest, defaults to the capacity of C
+	Buffer int
+	// OnHighWater is called by Unbounded once HighWater events are queued. It is called again after the queue was empty
+	// It is called by the event loop, so it must not block
+	HighWater   int
+	OnHighWater func(queued int)
+}
+
+// Backpressure decides what happens to the events of a slow consumer
+type Backpressure int
+
+const (
+	// Block waits until the event fits into the channel. This delays all other events
+	Block Backpressure = iota
+	// DropNewest drops the events, which don't fit into the channel
+	DropNewest
+	// DropOldest queues up to Event.Buffer events and drops the oldest ones, once the queue is full
+	DropOldest
+	// Unbounded queues all events and calls Event.OnHighWater, if the queue gets too long
+	Unbounded
+)
+
+// Gap is sent instead of the events a listener missed, e.g. because of Backpressure or a lost connection
+// State built from the events (e.g. a cache of the connected clients) should be reloaded
+// Dropped is the number of missed events, 0 if unknown
+type Gap struct {
+	Dropped uint64
 }
 
+// SubscriptionID identifies a single subscription of a Subscriber
+// Any number of subscriptions can listen to the same event
+type SubscriptionID uint64
+
 // Query is the interface for all implementation (webquery, serverquery, sshquery)
 // Be aware, that different queries can do different things (e.g. serverquery can recieve notifications, webquery can't atm)
 type Query interface {
@@ -100,6 +139,12 @@ type Query interface {
 	Do(req Request, res interface{}) error
 	// DoRaw just returns the answer of teamspeak
 	DoRaw(req Request) ([]byte, error)
+	// DoContext is like Do, but the request is aborted once ctx is done
+	// A deadline of ctx is applied to the underlying connection
+	DoContext(ctx context.Context, req Request, res interface{}) error
+	// DoRawContext is like DoRaw, but the request is aborted once ctx is done
+	// A deadline of ctx is applied to the underlying connection
+	DoRawContext(ctx context.Context, req Request) ([]byte, error)
 	// Notifications provides a chan which includes only the notifications
 	Notification() <-chan []byte
 	// Connected returns true, if the query can still send and recieve on the connection
@@ -111,9 +156,18 @@ type Query interface {
 // Subscriber can subscribe to events
 type Subscriber interface {
 	// Subscribe to s and attempt to parse the response
-	Subscribe(s Subscription) error
-	// Unsubscribe from notification n
-	Unsubscribe(n string)
+	// Returns the id of the new subscription
+	Subscribe(s Subscription) (SubscriptionID, error)
+	// SubscribeContext is like Subscribe, but the registration is aborted once ctx is done
+	SubscribeContext(ctx context.Context, s Subscription) (SubscriptionID, error)
+	// Unsubscribe removes the subscription id. Other subscriptions of the same events are kept
+	Unsubscribe(id SubscriptionID) error
+	// UnsubscribeContext is like Unsubscribe, but the request is aborted once ctx is done
+	UnsubscribeContext(ctx context.Context, id SubscriptionID) error
+	// Dropped returns the number of events dropped because of the Backpressure of subscription id
+	Dropped(id SubscriptionID) uint64
 	// UnsubscribeAll form all subscriptions
 	UnsubscribeAll() error
+	// UnsubscribeAllContext is like UnsubscribeAll, but the request is aborted once ctx is done
+	UnsubscribeAllContext(ctx context.Context) error
 }
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/schoeppi5/libts"
+)
+
+// Logger is implemented by *log.Logger
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Sensitive arguments are replaced by *** when requests are logged or recorded
+var Sensitive = map[string]bool{
+	"client_login_password":  true,
+	"cpw":                    true,
+	"tcpw":                   true, // target channel of ftrenamefile
+	"channel_password":       true,
+	"virtualserver_password": true,
+	"password":               true, // of snapshots
+}
+
+// Logging logs every request with its duration and error
+func Logging(l Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, request libts.Request) ([]byte, error) {
+			start := time.Now()
+			data, err := next(ctx, request)
+			if err != nil {
+				l.Printf("%s failed after %s: %s", Redact(request), time.Since(start), err)
+				return data, err
+			}
+			l.Printf("%s took %s (%d bytes)", Redact(request), time.Since(start), len(data))
+			return data, err
+		}
+	}
+}
+
+// Redact returns request as command line with all Sensitive values replaced by ***
+func Redact(request libts.Request) string {
+	params := request.Ordered()
+	redacted := &libts.Params{
+		Pairs:   redact(params.Pairs),
+		Records: make([][]libts.Arg, len(params.Records)),
+		Flags:   params.Flags,
+	}
+	for i := range params.Records {
+		redacted.Records[i] = redact(params.Records[i])
+	}
+	line := strings.TrimSuffix(libts.Request{Command: request.Command, Params: redacted}.String(), "\n")
+	if request.ServerID != 0 {
+		return fmt.Sprintf("(sid %d) %s", request.ServerID, line)
+	}
+	return line
+}
+
+func redact(args []libts.Arg) []libts.Arg {
+	redacted := make([]libts.Arg, len(args))
+	for i, a := range args {
+		if Sensitive[a.Key] {
+			a.Value = "***"
+		}
+		redacted[i] = a
+	}
+	return redacted
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/communication"
+)
+
+// Handler executes request and returns the raw response
+type Handler func(ctx context.Context, request libts.Request) ([]byte, error)
+
+// Middleware wraps a Handler, e.g. to log, measure or retry requests
+// Errors sent by teamspeak are of type communication.QueryError
+type Middleware func(next Handler) Handler
+
+// Query runs all requests through a chain of middlewares before they reach the wrapped query
+// A Query implements libts.Query itself. Notifications are passed through
+type Query struct {
+	query   libts.Query
+	handler Handler
+}
+
+// Wrap q with middlewares. The first middleware is the outermost, so it sees the request first and the response last
+func Wrap(q libts.Query, middlewares ...Middleware) *Query {
+	h := Handler(q.DoRawContext)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return &Query{
+		query:   q,
+		handler: h,
+	}
+}
+
+// Unwrap returns the wrapped query
+func (q *Query) Unwrap() libts.Query {
+	return q.query
+}
+
+// Do runs request through the chain and attempts to parse the response in value
+func (q *Query) Do(request libts.Request, value interface{}) error {
+	return q.DoContext(context.Background(), request, value)
+}
+
+// DoRaw runs request through the chain and returns the raw response
+func (q *Query) DoRaw(request libts.Request) ([]byte, error) {
+	return q.DoRawContext(context.Background(), request)
+}
+
+// DoContext runs request through the chain and attempts to parse the response in value
+func (q *Query) DoContext(ctx context.Context, request libts.Request, value interface{}) error {
+	raw, err := q.DoRawContext(ctx, request)
+	if err != nil {
+		return err
+	}
+	return communication.Unmarshal(raw, value)
+}
+
+// DoRawContext runs request through the chain and returns the raw response
+func (q *Query) DoRawContext(ctx context.Context, request libts.Request) ([]byte, error) {
+	return q.handler(ctx, request)
+}
+
+// ServerID returns the virtual server selected by the wrapped query
+// Returns 0 (unknown), if the wrapped query doesn't report it
+func (q *Query) ServerID() int {
+	if s, ok := q.query.(interface{ ServerID() int }); ok {
+		return s.ServerID()
+	}
+	return 0
+}
+
+// Notification passes through the notifications of the wrapped query
+func (q *Query) Notification() <-chan []byte {
+	return q.query.Notification()
+}
+
+// Connected sends the version command through the chain
+func (q *Query) Connected() (bool, error) {
+	_, err := q.DoRaw(libts.Request{
+		Command: "version",
+	})
+	return err == nil, err
+}
@@ -0,0 +1,260 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/cassette"
+	"github.com/schoeppi5/libts/communication"
+	"github.com/schoeppi5/libts/middleware"
+)
+
+type recordingLogger struct {
+	lines []string
+}
+
+func (rl *recordingLogger) Printf(format string, v ...interface{}) {
+	rl.lines = append(rl.lines, fmt.Sprintf(format, v...))
+}
+
+func player(entries ...cassette.Entry) *cassette.Player {
+	return cassette.NewPlayer(entries, cassette.Lenient)
+}
+
+func TestChainOrder(t *testing.T) {
+	t.Parallel()
+	// given
+	order := []string{}
+	tag := func(name string) middleware.Middleware {
+		return func(next middleware.Handler) middleware.Handler {
+			return func(ctx context.Context, r libts.Request) ([]byte, error) {
+				order = append(order, name+" in")
+				data, err := next(ctx, r)
+				order = append(order, name+" out")
+				return data, err
+			}
+		}
+	}
+	q := middleware.Wrap(player(cassette.Entry{Request: &cassette.Request{Command: "version"}, Response: "version=3"}), tag("a"), tag("b"))
+
+	// when
+	have, err := q.DoRaw(libts.Request{Command: "version"})
+
+	// then
+	if err != nil || string(have) != "version=3" {
+		t.Errorf("Test %s failed!\n\tHave: %s (%v)\n\tWant: %s", t.Name(), have, err, "version=3")
+	}
+	if strings.Join(order, ",") != "a in,b in,b out,a out" {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %s", t.Name(), order, "a in,b in,b out,a out")
+	}
+}
+
+// serverPlayer is a player using virtual server id
+type serverPlayer struct {
+	*cassette.Player
+	id int
+}
+
+func (sp serverPlayer) ServerID() int {
+	return sp.id
+}
+
+func TestServerID(t *testing.T) {
+	t.Parallel()
+	// given
+	q := middleware.Wrap(serverPlayer{Player: player(), id: 3})
+
+	// when
+	have := q.ServerID()
+
+	// then
+	if have != 3 {
+		t.Errorf("Test %s failed!\n\tHave: %d\n\tWant: %d", t.Name(), have, 3)
+	}
+	if have := middleware.Wrap(player()).ServerID(); have != 0 {
+		t.Errorf("Test %s failed!\n\tHave: %d\n\tWant: %d", t.Name(), have, 0)
+	}
+}
+
+func TestLoggingRedacts(t *testing.T) {
+	t.Parallel()
+	// given
+	l := &recordingLogger{}
+	login := libts.Request{
+		Command: "login",
+		Args:    map[string]interface{}{"client_login_name": "serveradmin", "client_login_password": "secret"},
+	}
+	move := libts.Request{
+		ServerID: 1,
+		Command:  "clientmove",
+		Args:     map[string]interface{}{"clid": 5, "cid": 2, "cpw": "channel secret"},
+	}
+	q := middleware.Wrap(player(
+		cassette.Entry{Request: cassette.NewRequest(login)},
+		cassette.Entry{Request: cassette.NewRequest(move), Error: &communication.QueryError{ID: 781, Message: "invalid password"}},
+	), middleware.Logging(l))
+
+	// when
+	q.DoRaw(login)
+	q.DoRaw(move)
+
+	// then
+	log := strings.Join(l.lines, "\n")
+	if strings.Contains(log, "secret") {
+		t.Errorf("Test %s failed!\n\tSecret logged: %s", t.Name(), log)
+	}
+	if !strings.HasPrefix(l.lines[0], `login client_login_name=serveradmin client_login_password=***`) {
+		t.Errorf("Test %s failed!\n\tHave: %s", t.Name(), l.lines[0])
+	}
+	if !strings.HasPrefix(l.lines[1], `(sid 1) clientmove cid=2 clid=5 cpw=*** failed`) {
+		t.Errorf("Test %s failed!\n\tHave: %s", t.Name(), l.lines[1])
+	}
+}
+
+func TestRedactTargetChannelPassword(t *testing.T) {
+	t.Parallel()
+	// given
+	rename := libts.Request{
+		ServerID: 1,
+		Command:  "ftrenamefile",
+		Args:     map[string]interface{}{"cid": 2, "cpw": "", "tcid": 3, "tcpw": "target secret", "oldname": "/a", "newname": "/b"},
+	}
+
+	// when
+	have := middleware.Redact(rename)
+
+	// then
+	want := `(sid 1) ftrenamefile cid=2 cpw=*** newname=\/b oldname=\/a tcid=3 tcpw=***`
+	if have != want {
+		t.Errorf("Test %s failed!\n\tHave: %s\n\tWant: %s", t.Name(), have, want)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+	// given
+	version := &cassette.Request{Command: "version"}
+	flood := &communication.QueryError{ID: 524, Message: "client is flooding"}
+	attempts := 0
+	count := func(next middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, r libts.Request) ([]byte, error) {
+			attempts++
+			return next(ctx, r)
+		}
+	}
+	q := middleware.Wrap(player(
+		cassette.Entry{Request: version, Error: flood},
+		cassette.Entry{Request: version, Error: flood},
+		cassette.Entry{Request: version, Response: "version=3"},
+	), middleware.Retry(middleware.RetryPolicy{IDs: []libts.ErrorID{libts.ErrClientFlooding}, Backoff: time.Millisecond}), count)
+
+	// when
+	have, err := q.DoRaw(libts.Request{Command: "version"})
+
+	// then
+	if err != nil || string(have) != "version=3" {
+		t.Errorf("Test %s failed!\n\tHave: %s (%v)\n\tWant: %s", t.Name(), have, err, "version=3")
+	}
+	if attempts != 3 {
+		t.Errorf("Test %s failed!\n\tHave: %d\n\tWant: %d", t.Name(), attempts, 3)
+	}
+}
+
+func TestRetryOtherErrors(t *testing.T) {
+	t.Parallel()
+	// given
+	clientinfo := &cassette.Request{Command: "clientinfo"}
+	q := middleware.Wrap(player(
+		cassette.Entry{Request: clientinfo, Error: &communication.QueryError{ID: 512, Message: "invalid clientID"}},
+		cassette.Entry{Request: clientinfo, Response: "client_nickname=x"},
+	), middleware.Retry(middleware.RetryPolicy{IDs: []libts.ErrorID{libts.ErrClientFlooding}, Backoff: time.Millisecond}))
+
+	// when
+	_, err := q.DoRaw(libts.Request{Command: "clientinfo"})
+
+	// then
+	if e, ok := err.(communication.QueryError); !ok || e.ID != 512 {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %s", t.Name(), err, "invalid clientID")
+	}
+}
+
+func TestTimingAndNotifications(t *testing.T) {
+	t.Parallel()
+	// given
+	observed := []string{}
+	q := middleware.Wrap(player(
+		cassette.Entry{Notification: "notifytest a=1"},
+		cassette.Entry{Request: &cassette.Request{Command: "version"}, Response: "version=3"},
+	), middleware.Timing(func(r libts.Request, d time.Duration, err error) {
+		observed = append(observed, r.Command)
+	}))
+
+	// when
+	ok, err := q.Connected()
+	n := <-q.Notification()
+
+	// then
+	if !ok || err != nil {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), err, nil)
+	}
+	if strings.Join(observed, ",") != "version" {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %s", t.Name(), observed, "version")
+	}
+	if string(n) != "notifytest a=1" {
+		t.Errorf("Test %s failed!\n\tHave: %s\n\tWant: %s", t.Name(), n, "notifytest a=1")
+	}
+}
+
+func TestResolvePermissionsKeepsErrorType(t *testing.T) {
+	t.Parallel()
+	// given
+	perms := player(cassette.Entry{Request: &cassette.Request{Command: "permissionlist"}, Response: "permid=4 permname=b_serverinstance_info_view"})
+	denied := func(ctx context.Context, r libts.Request) ([]byte, error) {
+		return nil, communication.EmptyResultError{QueryError: communication.QueryError{ID: 2568, FailedPermID: 4}}
+	}
+	h := middleware.ResolvePermissions(perms)(denied)
+
+	// when
+	_, err := h(context.Background(), libts.Request{Command: "serverstop"})
+
+	// then
+	var e communication.EmptyResultError
+	if !errors.As(err, &e) || e.FailedPermission != "b_serverinstance_info_view" {
+		t.Errorf("Test %s failed!\n\tHave: %#v\n\tWant: %s", t.Name(), err, "EmptyResultError with b_serverinstance_info_view")
+	}
+}
+
+func TestResolvePermissionsCachesFailure(t *testing.T) {
+	t.Parallel()
+	// given
+	lookups := 0
+	count := func(next middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, r libts.Request) ([]byte, error) {
+			lookups++
+			return next(ctx, r)
+		}
+	}
+	perms := middleware.Wrap(player(cassette.Entry{Request: &cassette.Request{Command: "permissionlist"}, Error: &communication.QueryError{ID: 2568, FailedPermID: 19}}), count)
+	denied := func(ctx context.Context, r libts.Request) ([]byte, error) {
+		return nil, communication.QueryError{ID: 2568, FailedPermID: 4}
+	}
+	h := middleware.ResolvePermissions(perms)(denied)
+
+	// when
+	_, first := h(context.Background(), libts.Request{Command: "serverstop"})
+	_, second := h(context.Background(), libts.Request{Command: "serverstop"})
+
+	// then
+	if lookups != 1 {
+		t.Errorf("Test %s failed!\n\tHave: %d\n\tWant: %d", t.Name(), lookups, 1)
+	}
+	want := communication.QueryError{ID: 2568, FailedPermID: 4}
+	if first != want || second != want {
+		t.Errorf("Test %s failed!\n\tHave: %v, %v\n\tWant: %v", t.Name(), first, second, want)
+	}
+}
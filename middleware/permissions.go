@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/communication"
+	"github.com/schoeppi5/libts/query"
+)
+
+// permissionRetry is the time a failed permissionlist is not requested again
+const permissionRetry = time.Minute
+
+// ResolvePermissions fills the FailedPermission of query errors with the name of the failed permission
+// The names are requested once from q (using permissionlist) and cached afterwards. A failed request is retried after a minute
+// q is usually the query, that is wrapped
+func ResolvePermissions(q libts.Query) Middleware {
+	var (
+		lock   sync.Mutex
+		names  map[int]string
+		failed time.Time
+	)
+	lookup := func(ctx context.Context, permid int) string {
+		lock.Lock()
+		if names != nil || time.Since(failed) < permissionRetry {
+			name := names[permid]
+			lock.Unlock()
+			return name
+		}
+		lock.Unlock()
+		perms, err := query.Agent{Query: q}.WithContext(ctx).PermissionList()
+		lock.Lock()
+		defer lock.Unlock()
+		if err != nil {
+			failed = time.Now()
+			return ""
+		}
+		names = make(map[int]string, len(perms))
+		for _, p := range perms {
+			names[p.ID] = p.Name
+		}
+		return names[permid]
+	}
+	return func(next Handler) Handler {
+		return func(ctx context.Context, request libts.Request) ([]byte, error) {
+			data, err := next(ctx, request)
+			var qe communication.QueryError
+			if errors.As(err, &qe) && qe.FailedPermID != 0 && qe.FailedPermission == "" {
+				if name := lookup(ctx, qe.FailedPermID); name != "" {
+					err = withFailedPermission(err, name)
+				}
+			}
+			return data, err
+		}
+	}
+}
+
+// withFailedPermission returns err with its FailedPermission set to name
+// Errors of other types than QueryError and EmptyResultError are returned unchanged
+func withFailedPermission(err error, name string) error {
+	switch e := err.(type) {
+	case communication.QueryError:
+		e.FailedPermission = name
+		return e
+	case *communication.QueryError:
+		c := *e
+		c.FailedPermission = name
+		return &c
+	case communication.EmptyResultError:
+		e.FailedPermission = name
+		return e
+	}
+	return err
+}
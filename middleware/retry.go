@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/communication"
+)
+
+// RetryPolicy configures the Retry middleware
+type RetryPolicy struct {
+	// IDs of the query errors to retry (e.g. libts.ErrClientFlooding)
+	IDs []libts.ErrorID
+	// Other decides about errors not sent by teamspeak (e.g. lost connection). nil doesn't retry them
+	Other func(err error) bool
+	// MaxAttempts including the first one. Defaults to 3
+	MaxAttempts int
+	// Backoff between the attempts. Defaults to 1 second
+	Backoff time.Duration
+}
+
+// Retry repeats requests failing with one of the errors of p
+func Retry(p RetryPolicy) Middleware {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = time.Second
+	}
+	return func(next Handler) Handler {
+		return func(ctx context.Context, request libts.Request) ([]byte, error) {
+			for attempt := 1; ; attempt++ {
+				data, err := next(ctx, request)
+				if err == nil || attempt >= p.MaxAttempts || !p.retry(err) {
+					return data, err
+				}
+				timer := time.NewTimer(p.Backoff)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return nil, ctx.Err()
+				}
+			}
+		}
+	}
+}
+
+func (p RetryPolicy) retry(err error) bool {
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return false
+	}
+	var qe communication.QueryError
+	if !errors.As(err, &qe) {
+		return p.Other != nil && p.Other(err)
+	}
+	for _, id := range p.IDs {
+		if qe.Code() == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/schoeppi5/libts"
+)
+
+// Timing calls observe with the duration and error of every request, e.g. to export metrics
+func Timing(observe func(request libts.Request, d time.Duration, err error)) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, request libts.Request) ([]byte, error) {
+			start := time.Now()
+			data, err := next(ctx, request)
+			observe(request, time.Since(start), err)
+			return data, err
+		}
+	}
+}
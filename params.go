@@ -0,0 +1,146 @@
+package libts
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Flag is an option of a command without value (e.g. -continueonerror)
+type Flag string
+
+// Flags used by the serverquery commands
+const (
+	FlagContinueOnError Flag = "-continueonerror"
+	FlagKeepFiles       Flag = "-keepfiles"
+	FlagUID             Flag = "-uid"
+	FlagAway            Flag = "-away"
+	FlagVoice           Flag = "-voice"
+	FlagTimes           Flag = "-times"
+	FlagGroups          Flag = "-groups"
+	FlagInfo            Flag = "-info"
+	FlagIcon            Flag = "-icon"
+	FlagCountry         Flag = "-country"
+	FlagIP              Flag = "-ip"
+	FlagTopic           Flag = "-topic"
+	FlagFlags           Flag = "-flags"
+	FlagLimits          Flag = "-limits"
+	FlagSecondsEmpty    Flag = "-secondsempty"
+	FlagCount           Flag = "-count"
+	FlagNames           Flag = "-names"
+	FlagPermSID         Flag = "-permsid"
+	FlagShort           Flag = "-short"
+	FlagAll             Flag = "-all"
+	FlagOnlyOffline     Flag = "-onlyoffline"
+)
+
+// Arg is a single key=value pair of a request
+type Arg struct {
+	Key   string
+	Value interface{}
+}
+
+// Params are the ordered arguments of a request
+// Pairs are sent first, followed by the | separated Records (clid=1 cid=2|clid=3 cid=4) and the Flags
+type Params struct {
+	Pairs   []Arg
+	Records [][]Arg
+	Flags   []Flag
+}
+
+// NewParams returns empty Params to add arguments to
+func NewParams() *Params {
+	return &Params{}
+}
+
+// Add key=value to the pairs of p
+// Slices are added as multiple values of the same key (clid=1|clid=2), see Record for multiple keys per record
+func (p *Params) Add(key string, value interface{}) *Params {
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		for i := 0; i < v.Len(); i++ {
+			p.set(i, Arg{Key: key, Value: v.Index(i).Interface()})
+		}
+		return p
+	}
+	p.Pairs = append(p.Pairs, Arg{Key: key, Value: value})
+	return p
+}
+
+// Record appends a record containing args
+func (p *Params) Record(args ...Arg) *Params {
+	p.Records = append(p.Records, args)
+	return p
+}
+
+// Flag adds flags to p
+func (p *Params) Flag(flags ...Flag) *Params {
+	p.Flags = append(p.Flags, flags...)
+	return p
+}
+
+// HasFlag returns true, if p contains flag
+func (p *Params) HasFlag(flag Flag) bool {
+	for _, f := range p.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns p as it is sent to teamspeak (without the command)
+func (p *Params) String() string {
+	parts := []string{}
+	for _, a := range p.Pairs {
+		parts = append(parts, a.String())
+	}
+	records := make([]string, 0, len(p.Records))
+	for _, r := range p.Records {
+		args := make([]string, len(r))
+		for i, a := range r {
+			args[i] = a.String()
+		}
+		records = append(records, strings.Join(args, " "))
+	}
+	if len(records) != 0 {
+		parts = append(parts, strings.Join(records, "|"))
+	}
+	for _, f := range p.Flags {
+		parts = append(parts, string(f))
+	}
+	return strings.Join(parts, " ")
+}
+
+// String returns a as key=value with escaped value
+func (a Arg) String() string {
+	return fmt.Sprintf("%s=%s", a.Key, Escape(fmt.Sprint(a.Value)))
+}
+
+// set adds a to the record i
+func (p *Params) set(i int, a Arg) {
+	for len(p.Records) <= i {
+		p.Records = append(p.Records, nil)
+	}
+	p.Records[i] = append(p.Records[i], a)
+}
+
+// paramsFromMap converts the map form of the arguments
+// Keys are sorted, slices are zipped into records and keys starting with - are flags
+func paramsFromMap(args map[string]interface{}) *Params {
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	p := NewParams()
+	for _, k := range keys {
+		if strings.HasPrefix(k, "-") {
+			p.Flag(Flag(k))
+			continue
+		}
+		p.Add(k, args[k])
+	}
+	return p
+}
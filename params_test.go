@@ -0,0 +1,73 @@
+package libts_test
+
+import (
+	"testing"
+
+	"github.com/schoeppi5/libts"
+)
+
+func TestRequestStringIsSorted(t *testing.T) {
+	t.Parallel()
+	// given
+	r := libts.Request{
+		Command: "clientkick",
+		Args: map[string]interface{}{
+			"-continueonerror": "",
+			"reasonmsg":        "bye bye",
+			"clid":             []int{1, 2},
+			"reasonid":         5,
+		},
+	}
+	want := "clientkick reasonid=5 reasonmsg=bye\\sbye clid=1|clid=2 -continueonerror\n"
+
+	for i := 0; i < 10; i++ { // map iteration is random
+		// when
+		have := r.String()
+
+		// then
+		if have != want {
+			t.Fatalf("Test %s failed!\n\tHave: %q\n\tWant: %q", t.Name(), have, want)
+		}
+	}
+}
+
+func TestRequestStringParams(t *testing.T) {
+	t.Parallel()
+	// given
+	r := libts.Request{
+		Command: "clientmove",
+		Params: libts.NewParams().
+			Add("cpw", "secret").
+			Record(libts.Arg{Key: "clid", Value: 1}, libts.Arg{Key: "cid", Value: 2}).
+			Record(libts.Arg{Key: "clid", Value: 3}, libts.Arg{Key: "cid", Value: 4}).
+			Flag(libts.FlagContinueOnError),
+		Args: map[string]interface{}{"ignored": true},
+	}
+	want := "clientmove cpw=secret clid=1 cid=2|clid=3 cid=4 -continueonerror\n"
+
+	// when
+	have := r.String()
+
+	// then
+	if have != want {
+		t.Errorf("Test %s failed!\n\tHave: %q\n\tWant: %q", t.Name(), have, want)
+	}
+	if !r.HasFlag(libts.FlagContinueOnError) || r.HasFlag(libts.FlagKeepFiles) {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), r.Ordered().Flags, []libts.Flag{libts.FlagContinueOnError})
+	}
+}
+
+func TestParamsAddSlice(t *testing.T) {
+	t.Parallel()
+	// given
+	p := libts.NewParams().Add("sgid", 6).Add("cldbid", []int{4, 5}).Add("name", "a/b")
+
+	// when
+	have := p.String()
+
+	// then
+	want := "sgid=6 name=a\\/b cldbid=4|cldbid=5"
+	if have != want {
+		t.Errorf("Test %s failed!\n\tHave: %q\n\tWant: %q", t.Name(), have, want)
+	}
+}
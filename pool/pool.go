@@ -0,0 +1,416 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/communication"
+)
+
+// ErrClosed is returned for requests to a closed Pool
+var ErrClosed = errors.New("pool closed")
+
+// ErrSessionCommand is returned for commands changing the state of a session (e.g. login or use)
+// They would only apply to a single pooled session. Run them in the Factory instead
+var ErrSessionCommand = errors.New("session command not supported by pool")
+
+// sessionCommands change the state of the session running them
+var sessionCommands = map[string]bool{
+	"login":        true,
+	"logout":       true,
+	"use":          true,
+	"quit":         true,
+	"clientupdate": true,
+}
+
+// Session is a single logged in query session (e.g. *serverquery.ServerQuery or *sshquery.SSHQuery)
+type Session interface {
+	libts.Query
+	// ServerID returns the currently selected virtual server
+	ServerID() int
+	// Close the session
+	Close()
+}
+
+// Factory opens a new logged in Session
+type Factory func(ctx context.Context) (Session, error)
+
+// Config of a Pool
+type Config struct {
+	// Factory is used to open new sessions - required
+	Factory Factory
+	// MinSize is the number of sessions opened right away and kept open by the health check
+	MinSize int
+	// MaxSize is the maximum number of sessions used for requests. Defaults to 4
+	// The dedicated notification session is not counted
+	MaxSize int
+	// HealthCheckInterval in which idle sessions are checked using Connected(). 0 disables the health check
+	HealthCheckInterval time.Duration
+	// ServerID is used for requests without ServerID, as every pooled session may use another virtual server
+	// Defaults to the virtual server selected by the sessions of the Factory
+	ServerID int
+}
+
+// Stats of a Pool
+type Stats struct {
+	Open    int // sessions opened for requests
+	Idle    int // sessions waiting for requests
+	InUse   int // sessions running a request
+	Evicted int // broken sessions closed so far
+}
+
+// Pool implements libts.Query on top of multiple sessions
+// Every request is routed to an idle session, preferring one that already uses the virtual server of the request
+// Notifications and event registrations (servernotifyregister/servernotifyunregister) are handled by a dedicated session
+// Commands changing the state of a session (login, logout, use, quit and clientupdate) are rejected with ErrSessionCommand
+type Pool struct {
+	config Config
+	slots  chan struct{} // one slot per session in use
+	done   chan struct{}
+
+	lock     sync.Mutex
+	serverID int // for requests without ServerID
+	idle     []Session
+	open     int
+	evicted  int
+	closed   bool
+
+	notifyLock sync.Mutex // only one notification session is opened
+	notify     Session    // dedicated session for notifications
+}
+
+// New opens config.MinSize sessions and returns the Pool
+func New(ctx context.Context, config Config) (*Pool, error) {
+	if config.Factory == nil {
+		return nil, errors.New("pool needs a factory")
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = 4
+	}
+	if config.MinSize > config.MaxSize {
+		config.MinSize = config.MaxSize
+	}
+	p := &Pool{
+		config:   config,
+		serverID: config.ServerID,
+		slots:    make(chan struct{}, config.MaxSize),
+		done:     make(chan struct{}),
+	}
+	for i := 0; i < config.MinSize; i++ {
+		s, err := config.Factory(ctx)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.pin(s)
+		p.idle = append(p.idle, s)
+		p.open++
+	}
+	if config.HealthCheckInterval > 0 {
+		go p.healthCheck()
+	}
+	return p, nil
+}
+
+// Do executes request on a pooled session and attempts to parse the response in value
+func (p *Pool) Do(request libts.Request, value interface{}) error {
+	return p.DoContext(context.Background(), request, value)
+}
+
+// DoRaw executes request on a pooled session and returns the raw response
+func (p *Pool) DoRaw(request libts.Request) ([]byte, error) {
+	return p.DoRawContext(context.Background(), request)
+}
+
+// DoContext executes request on a pooled session and attempts to parse the response in value
+// ctx also limits the time waiting for an idle session
+func (p *Pool) DoContext(ctx context.Context, request libts.Request, value interface{}) error {
+	raw, err := p.DoRawContext(ctx, request)
+	if err != nil {
+		return err
+	}
+	return communication.Unmarshal(raw, value)
+}
+
+// DoRawContext executes request on a pooled session and returns the raw response
+// ctx also limits the time waiting for an idle session
+func (p *Pool) DoRawContext(ctx context.Context, request libts.Request) ([]byte, error) {
+	if sessionCommands[request.Command] {
+		return nil, ErrSessionCommand
+	}
+	if request.ServerID == 0 {
+		p.lock.Lock()
+		request.ServerID = p.serverID
+		p.lock.Unlock()
+	}
+	if strings.HasPrefix(request.Command, "servernotify") { // registrations are bound to the connection receiving the notifications
+		s, err := p.notification(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return s.DoRawContext(ctx, request)
+	}
+	s, err := p.acquire(ctx, request.ServerID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.DoRawContext(ctx, request)
+	p.release(s, err)
+	return data, err
+}
+
+// Notification returns the notifications of the dedicated notification session
+// The session is opened on first use. Returns a closed channel, if that fails
+func (p *Pool) Notification() <-chan []byte {
+	s, err := p.notification(context.Background())
+	if err != nil {
+		c := make(chan []byte)
+		close(c)
+		return c
+	}
+	return s.Notification()
+}
+
+// Connected checks a pooled session using Connected()
+func (p *Pool) Connected() (bool, error) {
+	s, err := p.acquire(context.Background(), 0)
+	if err != nil {
+		return false, err
+	}
+	ok, err := s.Connected()
+	p.release(s, err)
+	return ok, err
+}
+
+// Stats returns the current usage of p
+func (p *Pool) Stats() Stats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return Stats{
+		Open:    p.open,
+		Idle:    len(p.idle),
+		InUse:   p.open - len(p.idle),
+		Evicted: p.evicted,
+	}
+}
+
+// Close all sessions of p
+// Sessions currently in use are closed once their request finished
+func (p *Pool) Close() {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.done)
+	idle, notify := p.idle, p.notify
+	p.idle, p.notify = nil, nil
+	p.open -= len(idle)
+	p.lock.Unlock()
+	for _, s := range idle {
+		s.Close()
+	}
+	if notify != nil {
+		notify.Close()
+	}
+}
+
+// acquire an idle session or open a new one
+func (p *Pool) acquire(ctx context.Context, sid int) (Session, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-p.done:
+		return nil, ErrClosed
+	}
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		<-p.slots
+		return nil, ErrClosed
+	}
+	if len(p.idle) > 0 {
+		s := p.take(sid)
+		p.lock.Unlock()
+		return s, nil
+	}
+	p.open++ // holding a slot without an idle session means there is room for another one
+	p.lock.Unlock()
+	s, err := p.config.Factory(ctx)
+	if err != nil {
+		p.lock.Lock()
+		p.open--
+		p.lock.Unlock()
+		<-p.slots
+		return nil, err
+	}
+	p.lock.Lock()
+	p.pin(s)
+	p.lock.Unlock()
+	return s, nil
+}
+
+// pin requests without ServerID to the virtual server of s, if none is pinned yet. p.lock must be held
+func (p *Pool) pin(s Session) {
+	if p.serverID == 0 {
+		p.serverID = s.ServerID()
+	}
+}
+
+// take the best matching idle session. p.lock must be held
+func (p *Pool) take(sid int) Session {
+	best := len(p.idle) - 1 // most recently used
+	if sid != 0 {
+		for i := len(p.idle) - 1; i >= 0; i-- {
+			if p.idle[i].ServerID() == sid {
+				best = i
+				break
+			}
+		}
+	}
+	s := p.idle[best]
+	p.idle = append(p.idle[:best], p.idle[best+1:]...)
+	return s
+}
+
+// release s after a request returned err. Broken sessions are evicted
+func (p *Pool) release(s Session, err error) {
+	defer func() {
+		<-p.slots
+	}()
+	if err != nil && !isHealthy(err) {
+		if ok, _ := s.Connected(); !ok {
+			p.evict(s)
+			return
+		}
+	}
+	p.lock.Lock()
+	if p.closed {
+		p.open--
+		p.lock.Unlock()
+		s.Close()
+		return
+	}
+	p.idle = append(p.idle, s)
+	p.lock.Unlock()
+}
+
+func (p *Pool) evict(s Session) {
+	p.lock.Lock()
+	p.open--
+	p.evicted++
+	p.lock.Unlock()
+	s.Close()
+}
+
+// notification returns the dedicated notification session
+func (p *Pool) notification(ctx context.Context) (Session, error) {
+	p.notifyLock.Lock()
+	defer p.notifyLock.Unlock()
+	p.lock.Lock()
+	closed, notify := p.closed, p.notify
+	p.lock.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+	if notify != nil {
+		return notify, nil
+	}
+	s, err := p.config.Factory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.closed {
+		s.Close()
+		return nil, ErrClosed
+	}
+	p.notify = s
+	return s, nil
+}
+
+// healthCheck checks all idle sessions every HealthCheckInterval and refills the pool to MinSize
+func (p *Pool) healthCheck() {
+	ticker := time.NewTicker(p.config.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.done:
+			return
+		}
+		p.checkIdle()
+		p.fill()
+	}
+}
+
+func (p *Pool) checkIdle() {
+	p.lock.Lock()
+	n := len(p.idle)
+	p.lock.Unlock()
+	for i := 0; i < n; i++ {
+		select {
+		case p.slots <- struct{}{}: // don't exceed MaxSize while checking
+		default:
+			return
+		}
+		p.lock.Lock()
+		if p.closed || len(p.idle) == 0 {
+			p.lock.Unlock()
+			<-p.slots
+			return
+		}
+		s := p.idle[0] // least recently used
+		p.idle = p.idle[1:]
+		p.lock.Unlock()
+		ok, err := s.Connected()
+		if !ok {
+			p.evict(s)
+			<-p.slots
+			continue
+		}
+		p.release(s, err)
+	}
+}
+
+func (p *Pool) fill() {
+	for {
+		p.lock.Lock()
+		if p.closed || p.open >= p.config.MinSize {
+			p.lock.Unlock()
+			return
+		}
+		p.open++
+		p.lock.Unlock()
+		s, err := p.config.Factory(context.Background())
+		p.lock.Lock()
+		if err != nil {
+			p.open--
+			p.lock.Unlock()
+			return
+		}
+		if p.closed {
+			p.open--
+			p.lock.Unlock()
+			s.Close()
+			return
+		}
+		p.pin(s)
+		p.idle = append(p.idle, s)
+		p.lock.Unlock()
+	}
+}
+
+// isHealthy returns true, if err doesn't indicate a broken session
+// Canceled requests aren't, as they interrupt the connection
+func isHealthy(err error) bool {
+	var qe communication.QueryError
+	return errors.As(err, &qe)
+}
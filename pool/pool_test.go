@@ -0,0 +1,398 @@
+package pool_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/communication"
+	"github.com/schoeppi5/libts/pool"
+)
+
+// fakeSession answers every request with its id and the requested server
+type fakeSession struct {
+	id     int
+	lock   sync.Mutex
+	sid    int
+	broken bool
+	closed bool
+	busy   chan struct{} // blocks requests while set
+}
+
+func (fs *fakeSession) Do(req libts.Request, v interface{}) error {
+	return fs.DoContext(context.Background(), req, v)
+}
+
+func (fs *fakeSession) DoRaw(req libts.Request) ([]byte, error) {
+	return fs.DoRawContext(context.Background(), req)
+}
+
+func (fs *fakeSession) DoContext(ctx context.Context, req libts.Request, v interface{}) error {
+	raw, err := fs.DoRawContext(ctx, req)
+	if err != nil {
+		return err
+	}
+	return communication.UnmarshalResponse(communication.ConvertResponse(raw), v)
+}
+
+func (fs *fakeSession) DoRawContext(ctx context.Context, req libts.Request) ([]byte, error) {
+	if fs.busy != nil {
+		select {
+		case <-fs.busy:
+		case <-ctx.Done(): // interrupts the connection, like communication.WatchContext
+			fs.lock.Lock()
+			defer fs.lock.Unlock()
+			fs.broken = true
+			return nil, ctx.Err()
+		}
+	}
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	if fs.broken {
+		return nil, errors.New("connection closed")
+	}
+	if req.Command == "fail" {
+		return nil, communication.QueryError{ID: 1538, Message: "invalid parameter"}
+	}
+	if req.ServerID != 0 {
+		fs.sid = req.ServerID
+	}
+	return []byte(fmt.Sprintf("id=%d sid=%d", fs.id, fs.sid)), nil
+}
+
+func (fs *fakeSession) Notification() <-chan []byte {
+	return nil
+}
+
+func (fs *fakeSession) Connected() (bool, error) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	if fs.broken {
+		return false, errors.New("connection closed")
+	}
+	return true, nil
+}
+
+func (fs *fakeSession) ServerID() int {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	return fs.sid
+}
+
+func (fs *fakeSession) Close() {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	fs.closed = true
+}
+
+type factory struct {
+	lock     sync.Mutex
+	sessions []*fakeSession
+}
+
+func (f *factory) New(ctx context.Context) (pool.Session, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	s := &fakeSession{id: len(f.sessions) + 1}
+	f.sessions = append(f.sessions, s)
+	return s, nil
+}
+
+type response struct {
+	ID  int `mapstructure:"id"`
+	SID int `mapstructure:"sid"`
+}
+
+func TestPoolPrefersSessionOnServer(t *testing.T) {
+	t.Parallel()
+	// given
+	f := &factory{}
+	p, err := pool.New(context.Background(), pool.Config{Factory: f.New, MinSize: 3, MaxSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	f.sessions[0].sid = 5
+	f.sessions[1].sid = 7
+
+	// when
+	have := response{}
+	err = p.Do(libts.Request{ServerID: 5, Command: "test"}, &have)
+
+	// then
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have.ID != 1 {
+		t.Errorf("Test %s failed!\n\tHave: %d\n\tWant: %d", t.Name(), have.ID, 1)
+	}
+}
+
+func TestPoolMaxSize(t *testing.T) {
+	t.Parallel()
+	// given
+	f := &factory{}
+	p, err := pool.New(context.Background(), pool.Config{Factory: f.New, MaxSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	wg := sync.WaitGroup{}
+
+	// when
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := p.DoRaw(libts.Request{Command: "test"})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// then
+	if len(f.sessions) > 2 {
+		t.Errorf("Test %s failed!\n\tOpened %d sessions, want at most %d", t.Name(), len(f.sessions), 2)
+	}
+	if stats := p.Stats(); stats.InUse != 0 || stats.Open != stats.Idle {
+		t.Errorf("Test %s failed!\n\tUnexpected stats: %+v", t.Name(), stats)
+	}
+}
+
+func TestPoolWaitsForIdleSession(t *testing.T) {
+	t.Parallel()
+	// given
+	f := &factory{}
+	p, err := pool.New(context.Background(), pool.Config{Factory: f.New, MinSize: 1, MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	f.sessions[0].busy = make(chan struct{})
+	go p.DoRaw(libts.Request{Command: "test"})
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// when
+	_, err = p.DoRawContext(ctx, libts.Request{Command: "test"})
+	close(f.sessions[0].busy)
+
+	// then
+	if err != context.DeadlineExceeded {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), err, context.DeadlineExceeded)
+	}
+}
+
+func TestPoolEvictsBrokenSession(t *testing.T) {
+	t.Parallel()
+	// given
+	f := &factory{}
+	p, err := pool.New(context.Background(), pool.Config{Factory: f.New, MinSize: 1, MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	f.sessions[0].broken = true
+
+	// when
+	_, err = p.DoRaw(libts.Request{Command: "test"})
+	have := response{}
+	err2 := p.Do(libts.Request{Command: "test"}, &have)
+
+	// then
+	if err == nil {
+		t.Errorf("Test %s failed!\n\tExpected error from broken session", t.Name())
+	}
+	if !f.sessions[0].closed {
+		t.Errorf("Test %s failed!\n\tBroken session was not closed", t.Name())
+	}
+	if err2 != nil || have.ID != 2 {
+		t.Errorf("Test %s failed!\n\tHave: %d (%v)\n\tWant: %d", t.Name(), have.ID, err2, 2)
+	}
+	if stats := p.Stats(); stats.Evicted != 1 {
+		t.Errorf("Test %s failed!\n\tHave: %d\n\tWant: %d", t.Name(), stats.Evicted, 1)
+	}
+}
+
+func TestPoolEvictsCanceledSession(t *testing.T) {
+	t.Parallel()
+	// given
+	f := &factory{}
+	p, err := pool.New(context.Background(), pool.Config{Factory: f.New, MinSize: 1, MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	f.sessions[0].busy = make(chan struct{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// when
+	_, err = p.DoRawContext(ctx, libts.Request{Command: "test"})
+	have := response{}
+	err2 := p.Do(libts.Request{Command: "test"}, &have)
+
+	// then
+	if err != context.DeadlineExceeded {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), err, context.DeadlineExceeded)
+	}
+	if err2 != nil || have.ID != 2 {
+		t.Errorf("Test %s failed!\n\tHave: %d (%v)\n\tWant: %d", t.Name(), have.ID, err2, 2)
+	}
+	if stats := p.Stats(); stats.Evicted != 1 {
+		t.Errorf("Test %s failed!\n\tHave: %d\n\tWant: %d", t.Name(), stats.Evicted, 1)
+	}
+}
+
+func TestPoolKeepsSessionOnQueryError(t *testing.T) {
+	t.Parallel()
+	// given
+	f := &factory{}
+	p, err := pool.New(context.Background(), pool.Config{Factory: f.New, MinSize: 1, MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// when
+	_, err = p.DoRaw(libts.Request{Command: "fail"})
+
+	// then
+	if _, ok := err.(communication.QueryError); !ok {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %s", t.Name(), err, "communication.QueryError")
+	}
+	if stats := p.Stats(); stats.Evicted != 0 || stats.Idle != 1 {
+		t.Errorf("Test %s failed!\n\tUnexpected stats: %+v", t.Name(), stats)
+	}
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	t.Parallel()
+	// given
+	f := &factory{}
+	p, err := pool.New(context.Background(), pool.Config{
+		Factory:             f.New,
+		MinSize:             2,
+		MaxSize:             2,
+		HealthCheckInterval: 5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// when
+	f.sessions[1].Close()
+	f.sessions[1].lock.Lock()
+	f.sessions[1].broken = true
+	f.sessions[1].lock.Unlock()
+	time.Sleep(50 * time.Millisecond)
+
+	// then
+	stats := p.Stats()
+	if stats.Evicted != 1 || stats.Open != 2 {
+		t.Errorf("Test %s failed!\n\tUnexpected stats: %+v", t.Name(), stats)
+	}
+}
+
+func TestPoolNotificationSession(t *testing.T) {
+	t.Parallel()
+	// given
+	f := &factory{}
+	p, err := pool.New(context.Background(), pool.Config{Factory: f.New, MinSize: 1, MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// when
+	have := response{}
+	err = p.Do(libts.Request{Command: "servernotifyregister"}, &have)
+	p.Notification()
+
+	// then
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have.ID != 2 {
+		t.Errorf("Test %s failed!\n\tHave: %d\n\tWant: %d", t.Name(), have.ID, 2)
+	}
+	if len(f.sessions) != 2 {
+		t.Errorf("Test %s failed!\n\tHave: %d\n\tWant: %d", t.Name(), len(f.sessions), 2)
+	}
+}
+
+func TestPoolRejectsSessionCommands(t *testing.T) {
+	t.Parallel()
+	// given
+	f := &factory{}
+	p, err := pool.New(context.Background(), pool.Config{Factory: f.New, MinSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	for _, command := range []string{"login", "logout", "use", "quit", "clientupdate"} {
+		// when
+		_, err := p.DoRaw(libts.Request{Command: command})
+
+		// then
+		if err != pool.ErrSessionCommand {
+			t.Errorf("Test %s/%s failed!\n\tHave: %v\n\tWant: %v", t.Name(), command, err, pool.ErrSessionCommand)
+		}
+	}
+}
+
+func TestPoolPinsServerID(t *testing.T) {
+	t.Parallel()
+	// given
+	f := &factory{}
+	p, err := pool.New(context.Background(), pool.Config{Factory: f.New, MinSize: 2, MaxSize: 2, ServerID: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	f.sessions[0].sid = 7
+	f.sessions[1].sid = 7
+
+	// when
+	have := response{}
+	err = p.Do(libts.Request{Command: "test"}, &have)
+
+	// then
+	if err != nil || have.SID != 5 {
+		t.Errorf("Test %s failed!\n\tHave: %d (%v)\n\tWant: %d", t.Name(), have.SID, err, 5)
+	}
+}
+
+func TestPoolNotificationFactoryError(t *testing.T) {
+	t.Parallel()
+	// given
+	p, err := pool.New(context.Background(), pool.Config{Factory: func(ctx context.Context) (pool.Session, error) {
+		return nil, errors.New("connection refused")
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// when
+	c := p.Notification()
+
+	// then
+	select {
+	case _, open := <-c:
+		if open {
+			t.Errorf("Test %s failed!\n\tNotification channel is open", t.Name())
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Test %s failed!\n\tNotification channel blocks", t.Name())
+	}
+}
@@ -14,7 +14,7 @@ func (a Agent) Login(username, password string) error {
 			"client_login_password": password,
 		},
 	}
-	return a.Query.Do(login, nil)
+	return a.Query.DoContext(a.Context(), login, nil)
 }
 
 // Logout from a server
@@ -23,5 +23,5 @@ func (a Agent) Logout() error {
 	logout := libts.Request{
 		Command: "logout",
 	}
-	return a.Query.Do(logout, nil)
+	return a.Query.DoContext(a.Context(), logout, nil)
 }
@@ -29,13 +29,13 @@ const (
 // APIKey represents the output of ever APIKeyAdd or APIKeyList
 // If this is a result of APIKeyList Key is empty
 type APIKey struct {
-	Key        string `mapstructure:"apikey"`
-	ID         int    `mapstructure:"id"`
-	ServerID   int    `mapstructure:"sid"`
-	ClientDBID int    `mapstructure:"cldbid"`
-	Scope      Scope  `mapstructure:"scope"`
-	Created    int64  `mapstructure:"created_at"`
-	Expires    int64  `mapstructure:"expires_at"`
+	Key        string    `mapstructure:"apikey"`
+	ID         int       `mapstructure:"id"`
+	ServerID   int       `mapstructure:"sid"`
+	ClientDBID int       `mapstructure:"cldbid"`
+	Scope      Scope     `mapstructure:"scope"`
+	Created    time.Time `mapstructure:"created_at"`
+	Expires    time.Time `mapstructure:"expires_at"`
 }
 
 // APIKeyAdd a new key on server sid for user cldbid with the scope s and lifetime in days
@@ -59,13 +59,13 @@ func (a Agent) APIKeyAdd(sid int, s Scope, lifetime int, cldbid int) (*APIKey, e
 		req.Args["cldbid"] = cldbid
 	}
 	apiKey := &APIKey{}
-	err := a.Query.Do(req, apiKey)
+	err := a.Query.DoContext(a.Context(), req, apiKey)
 	if err != nil {
 		return nil, err
 	}
 	now := time.Now()
-	apiKey.Created = now.Unix()
-	apiKey.Expires = now.Add((24 * time.Hour) * time.Duration(lifetime)).Unix()
+	apiKey.Created = now.Truncate(time.Second)
+	apiKey.Expires = apiKey.Created.Add((24 * time.Hour) * time.Duration(lifetime))
 	return apiKey, nil
 }
 
@@ -80,7 +80,7 @@ func (a Agent) APIKeyDel(sid int, id int) error {
 			"id": id,
 		},
 	}
-	return a.Query.Do(req, nil)
+	return a.Query.DoContext(a.Context(), req, nil)
 }
 
 // APIKeyList all keys on server sid for client cldbid. Start at offset and return count keys total
@@ -104,10 +104,9 @@ func (a Agent) APIKeyList(sid int, cldbid int, offset int, count int) ([]APIKey,
 	if count != 0 {
 		req.Args["duration"] = count
 	}
-	println(req.String())
 	apiKeys := []APIKey{}
-	err := a.Query.Do(req, &apiKeys)
-	if err != nil {
+	err := a.Query.DoContext(a.Context(), req, &apiKeys)
+	if err != nil && !emptyResult(err) {
 		return nil, err
 	}
 	return apiKeys, nil
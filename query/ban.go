@@ -8,14 +8,18 @@ import (
 
 // Ban is a single ban on a virtualserver obtained by BanList
 type Ban struct {
-	ID           int    `mapstructure:"banid"`
-	IP           string `mapstructure:"ip"`
-	Created      int64  `mapstructure:"created"`
-	InvokerName  string `mapstructure:"ivokername"`
-	InvokerDBID  int    `mapstructure:"invokercldbid"`
-	InvokerUID   string `mapstructure:"invokeruid"`
-	Reason       string `mapstructure:"reason"`
-	Enforcements int    `mapstructure:"enforcements"`
+	ID           int           `mapstructure:"banid"`
+	IP           string        `mapstructure:"ip"`
+	Name         string        `mapstructure:"name"`
+	UID          string        `mapstructure:"uid"`
+	LastNickname string        `mapstructure:"lastnickname"`
+	Created      time.Time     `mapstructure:"created"`
+	Duration     time.Duration `mapstructure:"duration" unit:"s"`
+	InvokerName  string        `mapstructure:"invokername"`
+	InvokerDBID  int           `mapstructure:"invokercldbid"`
+	InvokerUID   string        `mapstructure:"invokeruid"`
+	Reason       string        `mapstructure:"reason"`
+	Enforcements int           `mapstructure:"enforcements"`
 }
 
 // BanAdd a ban to server sid. Client to ban can be specified using ip, name, uid or myTeamSpeakId (I don't know what the lastnickname does, since the docs didn't bother to mention it)
@@ -50,39 +54,59 @@ func (a Agent) BanAdd(sid int, ip string, name string, uid string, mytsid string
 	id := struct {
 		ID int `mapstructure:"banid"`
 	}{}
-	err := a.Query.Do(req, &id)
+	err := a.Query.DoContext(a.Context(), req, &id)
 	if err != nil {
 		return 0, err
 	}
 	return id.ID, nil
 }
 
+// BanResult is the outcome of banning a single client
+type BanResult struct {
+	// Index of the client in clid
+	Index int
+	// BanIDs of the bans created for the client
+	BanIDs []int
+	// Err is the error for the client, nil if it was banned
+	Err error
+}
+
 // BanClients clid on server sid for time time for reason reason
+// Returns one result per client in the order of clid
 // sid - required
 // time - optional
 // reason - optional
 // clid - required
-func (a Agent) BanClients(sid int, time time.Duration, reason string, clid ...int) ([]int, error) {
+func (a Agent) BanClients(sid int, time time.Duration, reason string, clid ...int) ([]BanResult, error) {
 	req := libts.Request{
 		Command:  "banclient",
 		ServerID: sid,
 		Args: map[string]interface{}{
-			"time":             int(time.Seconds()),
-			"reason":           reason,
-			"clid":             clid,
-			"-continueonerror": "",
+			"time":   int(time.Seconds()),
+			"reason": reason,
+			"clid":   clid,
 		},
 	}
-	ids := []struct {
-		ID int `mapstructure:"banid"`
-	}{}
-	err := a.Query.Do(req, &ids)
+	rs, err := a.bulk(req)
 	if err != nil {
 		return nil, err
 	}
-	bans := []int{}
-	for i := range ids {
-		bans = append(bans, ids[i].ID)
+	bans := make([]BanResult, len(rs))
+	for i := range rs {
+		bans[i].Index, bans[i].Err = rs[i].Index, rs[i].Err
+		if rs[i].Err != nil {
+			continue
+		}
+		ids := []struct {
+			ID int `mapstructure:"banid"`
+		}{}
+		err = rs[i].Decode(&ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			bans[i].BanIDs = append(bans[i].BanIDs, id.ID)
+		}
 	}
 	return bans, nil
 }
@@ -98,7 +122,7 @@ func (a Agent) BanDel(sid int, banid int) error {
 			"banid": banid,
 		},
 	}
-	_, err := a.Query.DoRaw(req)
+	_, err := a.Query.DoRawContext(a.Context(), req)
 	return err
 }
 
@@ -109,7 +133,7 @@ func (a Agent) BanDelAll(sid int) error {
 		Command:  "bandelall",
 		ServerID: sid,
 	}
-	_, err := a.Query.DoRaw(req)
+	_, err := a.Query.DoRawContext(a.Context(), req)
 	return err
 }
 
@@ -117,7 +141,7 @@ func (a Agent) BanDelAll(sid int) error {
 // sid - required
 // offset - optional - Default 0 - skip the first 'offset' bans
 // count - optional - Default 0
-func (a Agent) BanList(sid int, offset int, count int) error {
+func (a Agent) BanList(sid int, offset int, count int) ([]Ban, error) {
 	req := libts.Request{
 		Command:  "banlist",
 		ServerID: sid,
@@ -128,6 +152,10 @@ func (a Agent) BanList(sid int, offset int, count int) error {
 	if count != 0 {
 		req.Args["duration"] = count
 	}
-	_, err := a.Query.DoRaw(req)
-	return err
+	bans := []Ban{}
+	err := a.Query.DoContext(a.Context(), req, &bans)
+	if err != nil && !emptyResult(err) {
+		return nil, err
+	}
+	return bans, nil
 }
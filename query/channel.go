@@ -29,12 +29,12 @@ func (a Agent) ChannelIDList(sid int) ([]int, error) {
 	cList := []struct {
 		ID int `mapstructure:"cid"`
 	}{}
-	err := a.Query.Do(
+	err := a.Query.DoContext(a.Context(),
 		libts.Request{
 			ServerID: sid,
 			Command:  "channellist",
 		}, &cList)
-	if err != nil {
+	if err != nil && !emptyResult(err) {
 		return nil, err
 	}
 	list := make([]int, len(cList))
@@ -47,7 +47,7 @@ func (a Agent) ChannelIDList(sid int) ([]int, error) {
 // Channel returns detailed info about a channel specified by cid on a server specified by sid
 func (a Agent) Channel(sid int, cid int) (*Channel, error) {
 	channel := Channel{}
-	err := a.Query.Do(
+	err := a.Query.DoContext(a.Context(),
 		libts.Request{
 			ServerID: sid,
 			Command:  "channelinfo",
@@ -62,3 +62,18 @@ func (a Agent) Channel(sid int, cid int) (*Channel, error) {
 	channel.ID = cid
 	return &channel, nil
 }
+
+// ChannelEdit changes the fields of channel cid, which differ between before and after
+// sid - required
+// cid - required
+// before - required - usually the result of Channel()
+// after - required - a copy of before with the changes applied
+func (a Agent) ChannelEdit(sid, cid int, before, after Channel) error {
+	return a.edit(libts.Request{
+		ServerID: sid,
+		Command:  "channeledit",
+		Args: map[string]interface{}{
+			"cid": cid,
+		},
+	}, before, after)
+}
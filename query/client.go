@@ -1,72 +1,74 @@
 package query
 
 import (
+	"time"
+
 	"github.com/schoeppi5/libts"
 )
 
 // Client is a single logged in client on a virtual server
 type Client struct {
 	ID                         int
-	Away                       int       `mapstructure:"client_away"`
-	AwayMessage                string    `mapstructure:"client_away_message"`
-	Base64Hash                 string    `mapstructure:"client_base64HashClientUID"`
-	ChannelGroups              GroupList `mapstructure:"client_channel_group_id"`
-	ChannelID                  int       `mapstructure:"cid"`
-	ConnectedTime              int       `mapstructure:"connection_connected_time"`
-	Country                    string    `mapstructure:"client_country"`
-	DBID                       int       `mapstructure:"client_database_id"`
-	DefaultChannel             string    `mapstructure:"client_default_channel"`
-	DefaultToken               string    `mapstructure:"client_default_token"`
-	Description                string    `mapstructure:"client_description"`
-	EstimatedLocation          string    `mapstructure:"client_estimated_location"`
-	FirstConnect               int64     `mapstructure:"client_created"`
-	FlagAvatar                 string    `mapstructure:"client_flag_avatar"`
-	IP                         string    `mapstructure:"connection_client_ip"`
-	IconID                     uint32    `mapstructure:"client_icon_id"`
-	IdleTime                   int       `mapstructure:"client_idle_time"`
-	InputHardware              bool      `mapstructure:"client_input_hardware"`
-	InputMuted                 bool      `mapstructure:"client_input_muted"`
-	Integrations               string    `mapstructure:"client_integrations"`
-	IsChannelCommander         bool      `mapstructure:"client_is_channel_commander"`
-	IsPrioritySpeaker          bool      `mapstructure:"client_is_priority_speaker"`
-	IsRecording                bool      `mapstructure:"client_is_recording"`
-	IsServerQuery              bool      `mapstructure:"client_type"`
-	IsTalker                   bool      `mapstructure:"client_is_talker"`
-	LastConnect                int64     `mapstructure:"client_lastconnected"`
-	LoginName                  string    `mapstructure:"client_login_name"`
-	Metadata                   string    `mapstructure:"client_meta_data"`
-	MyTeamspeakAvatar          string    `mapstructure:"client_myteamspeak_avatar"`
-	MyTeamspeakID              string    `mapstructure:"client_myteamspeak_id"`
-	NeededServerQueryViewPower int       `mapstructure:"client_needed_serverquery_view_power"`
-	Nickname                   string    `mapstructure:"client_nickname"`
-	NicknamePhonetic           string    `mapstructure:"client_nickname_phonetic"`
-	OutputHardware             bool      `mapstructure:"client_output_hardware"`
-	OutputMuted                bool      `mapstructure:"client_output_muted"`
-	OutputOnlyMuted            bool      `mapstructure:"client_outputonly_muted"`
-	Platform                   string    `mapstructure:"client_platform"`
-	SecurityHash               string    `mapstructure:"client_security_hash"`
-	ServerGroups               GroupList `mapstructure:"client_servergroups"`
-	TalkRequest                bool      `mapstructure:"client_talk_request"`
-	TalkRequestMessage         string    `mapstructure:"client_talk_request_msg"`
-	Talkpower                  int       `mapstructure:"client_talk_power"`
-	TotalConnections           int       `mapstructure:"client_totalconnections"`
-	UID                        string    `mapstructure:"client_unique_identifier"`
-	Version                    string    `mapstructure:"client_version"`
-	VersionSign                string    `mapstructure:"client_version_sign"`
+	Away                       int           `mapstructure:"client_away"`
+	AwayMessage                string        `mapstructure:"client_away_message"`
+	Base64Hash                 string        `mapstructure:"client_base64HashClientUID"`
+	ChannelGroups              GroupList     `mapstructure:"client_channel_group_id"`
+	ChannelID                  int           `mapstructure:"cid"`
+	ConnectedTime              time.Duration `mapstructure:"connection_connected_time" unit:"ms"`
+	Country                    string        `mapstructure:"client_country"`
+	DBID                       int           `mapstructure:"client_database_id"`
+	DefaultChannel             string        `mapstructure:"client_default_channel"`
+	DefaultToken               string        `mapstructure:"client_default_token"`
+	Description                string        `mapstructure:"client_description"`
+	EstimatedLocation          string        `mapstructure:"client_estimated_location"`
+	FirstConnect               time.Time     `mapstructure:"client_created"`
+	FlagAvatar                 string        `mapstructure:"client_flag_avatar"`
+	IP                         string        `mapstructure:"connection_client_ip"`
+	IconID                     uint32        `mapstructure:"client_icon_id"`
+	IdleTime                   time.Duration `mapstructure:"client_idle_time" unit:"ms"`
+	InputHardware              bool          `mapstructure:"client_input_hardware"`
+	InputMuted                 bool          `mapstructure:"client_input_muted"`
+	Integrations               string        `mapstructure:"client_integrations"`
+	IsChannelCommander         bool          `mapstructure:"client_is_channel_commander"`
+	IsPrioritySpeaker          bool          `mapstructure:"client_is_priority_speaker"`
+	IsRecording                bool          `mapstructure:"client_is_recording"`
+	IsServerQuery              bool          `mapstructure:"client_type"`
+	IsTalker                   bool          `mapstructure:"client_is_talker"`
+	LastConnect                time.Time     `mapstructure:"client_lastconnected"`
+	LoginName                  string        `mapstructure:"client_login_name"`
+	Metadata                   string        `mapstructure:"client_meta_data"`
+	MyTeamspeakAvatar          string        `mapstructure:"client_myteamspeak_avatar"`
+	MyTeamspeakID              string        `mapstructure:"client_myteamspeak_id"`
+	NeededServerQueryViewPower int           `mapstructure:"client_needed_serverquery_view_power"`
+	Nickname                   string        `mapstructure:"client_nickname"`
+	NicknamePhonetic           string        `mapstructure:"client_nickname_phonetic"`
+	OutputHardware             bool          `mapstructure:"client_output_hardware"`
+	OutputMuted                bool          `mapstructure:"client_output_muted"`
+	OutputOnlyMuted            bool          `mapstructure:"client_outputonly_muted"`
+	Platform                   string        `mapstructure:"client_platform"`
+	SecurityHash               string        `mapstructure:"client_security_hash"`
+	ServerGroups               GroupList     `mapstructure:"client_servergroups"`
+	TalkRequest                bool          `mapstructure:"client_talk_request"`
+	TalkRequestMessage         string        `mapstructure:"client_talk_request_msg"`
+	Talkpower                  int           `mapstructure:"client_talk_power"`
+	TotalConnections           int           `mapstructure:"client_totalconnections"`
+	UID                        string        `mapstructure:"client_unique_identifier"`
+	Version                    string        `mapstructure:"client_version"`
+	VersionSign                string        `mapstructure:"client_version_sign"`
 }
 
 // DBClient is a single client in the database of a virtualserver
 type DBClient struct {
-	FlagAvatar       string `mapstructure:"client_flag_avatar"`
-	Base64Hash       string `mapstructure:"client_base64HashClientUID"`
-	DBID             int    `mapstructure:"client_database_id"`
-	LastIP           string `mapstructure:"client_lastip"`
-	Created          int64  `mapstructure:"client_created"`
-	TotalConnections int    `mapstructure:"client_totalconnections"`
-	UID              string `mapstructure:"client_unique_identifier"`
-	Nickname         string `mapstructure:"client_nickname"`
-	LastConnected    int64  `mapstructure:"client_lastconnected"`
-	Description      string `mapstructure:"client_description"`
+	FlagAvatar       string    `mapstructure:"client_flag_avatar"`
+	Base64Hash       string    `mapstructure:"client_base64HashClientUID"`
+	DBID             int       `mapstructure:"client_database_id"`
+	LastIP           string    `mapstructure:"client_lastip"`
+	Created          time.Time `mapstructure:"client_created"`
+	TotalConnections int       `mapstructure:"client_totalconnections"`
+	UID              string    `mapstructure:"client_unique_identifier"`
+	Nickname         string    `mapstructure:"client_nickname"`
+	LastConnected    time.Time `mapstructure:"client_lastconnected"`
+	Description      string    `mapstructure:"client_description"`
 }
 
 // ClientList returns all currently logged in clients
@@ -87,12 +89,12 @@ func (a Agent) ClientIDList(sid int) ([]int, error) {
 	cList := []struct {
 		ID int `mapstructure:"clid"`
 	}{}
-	err := a.Query.Do(
+	err := a.Query.DoContext(a.Context(),
 		libts.Request{
 			ServerID: sid,
 			Command:  "clientlist",
 		}, &cList)
-	if err != nil {
+	if err != nil && !emptyResult(err) {
 		return nil, err
 	}
 	list := make([]int, len(cList))
@@ -120,10 +122,10 @@ func (a Agent) Client(sid int, clid int) (*Client, error) {
 // clids - required (returns when len(clids) == 0)
 func (a Agent) Clients(sid int, clids ...int) ([]Client, error) {
 	if len(clids) == 0 { // Don't panic if there isn't anything to do
-		return nil, nil
+		return []Client{}, nil
 	}
 	clients := []Client{}
-	err := a.Query.Do(
+	err := a.Query.DoContext(a.Context(),
 		libts.Request{
 			ServerID: sid,
 			Command:  "clientinfo",
@@ -151,7 +153,7 @@ func (a Agent) MoveClient(sid, clid, from, to int, cpw string) error {
 	if from == to { // Don't have to move the client
 		return nil
 	}
-	_, err := a.Query.DoRaw(libts.Request{
+	_, err := a.Query.DoRawContext(a.Context(), libts.Request{
 		ServerID: sid,
 		Command:  "clientmove",
 		Args: map[string]interface{}{
@@ -166,15 +168,83 @@ func (a Agent) MoveClient(sid, clid, from, to int, cpw string) error {
 	return nil
 }
 
+// MoveClients clid to channel cid with channelpassword cpw
+// Returns one result per client in the order of clid
+// sid - required
+// cid - required
+// cpw - optional
+// clid - required
+func (a Agent) MoveClients(sid, cid int, cpw string, clid ...int) ([]Result, error) {
+	req := libts.Request{
+		ServerID: sid,
+		Command:  "clientmove",
+		Args: map[string]interface{}{
+			"cid":  cid,
+			"clid": clid,
+		},
+	}
+	if cpw != "" {
+		req.Args["cpw"] = cpw
+	}
+	rs, err := a.bulk(req)
+	if err != nil {
+		return nil, err
+	}
+	return results(rs), nil
+}
+
+// KickClients clid from their channel (or from the server) with message msg
+// Returns one result per client in the order of clid
+// sid - required
+// server - required - false kicks from the channel, true from the server
+// msg - optional
+// clid - required
+func (a Agent) KickClients(sid int, server bool, msg string, clid ...int) ([]Result, error) {
+	req := libts.Request{
+		ServerID: sid,
+		Command:  "clientkick",
+		Args: map[string]interface{}{
+			"reasonid": 4,
+			"clid":     clid,
+		},
+	}
+	if server {
+		req.Args["reasonid"] = 5
+	}
+	if msg != "" {
+		req.Args["reasonmsg"] = msg
+	}
+	rs, err := a.bulk(req)
+	if err != nil {
+		return nil, err
+	}
+	return results(rs), nil
+}
+
+// ClientEdit changes the fields of client clid, which differ between before and after
+// sid - required
+// clid - required
+// before - required - usually the result of Client()
+// after - required - a copy of before with the changes applied
+func (a Agent) ClientEdit(sid, clid int, before, after Client) error {
+	return a.edit(libts.Request{
+		ServerID: sid,
+		Command:  "clientedit",
+		Args: map[string]interface{}{
+			"clid": clid,
+		},
+	}, before, after)
+}
+
 // DBClients returns clients from database of server sid
 // sid - required
 // cldbids - required (returns when len(cldbids) == 0)
 func (a Agent) DBClients(sid int, cldbids ...int) (*[]DBClient, error) {
 	if len(cldbids) == 0 {
-		return nil, nil
+		return &[]DBClient{}, nil
 	}
 	dbclient := &[]DBClient{}
-	err := a.Query.Do(libts.Request{
+	err := a.Query.DoContext(a.Context(), libts.Request{
 		Command:  "clientdbinfo",
 		ServerID: sid,
 		Args: map[string]interface{}{
@@ -186,3 +256,18 @@ func (a Agent) DBClients(sid int, cldbids ...int) (*[]DBClient, error) {
 	}
 	return dbclient, nil
 }
+
+// ClientDBEdit changes the fields of database client cldbid, which differ between before and after
+// sid - required
+// cldbid - required
+// before - required - usually the result of DBClients()
+// after - required - a copy of before with the changes applied
+func (a Agent) ClientDBEdit(sid, cldbid int, before, after DBClient) error {
+	return a.edit(libts.Request{
+		ServerID: sid,
+		Command:  "clientdbedit",
+		Args: map[string]interface{}{
+			"cldbid": cldbid,
+		},
+	}, before, after)
+}
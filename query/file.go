@@ -3,17 +3,18 @@ package query
 import (
 	"fmt"
 	"math/rand"
+	"time"
 
 	"github.com/schoeppi5/libts"
 )
 
 // File represents a file on a virtual server
 type File struct {
-	ChannelID int    `mapstructure:"cid"`
-	Name      string `mapstructure:"name"`
-	Size      int64  `mapstructure:"size"`
-	Timestamp int64  `mapstructure:"datetime"`
-	IsFile    bool   `mapstructure:"type"`
+	ChannelID int       `mapstructure:"cid"`
+	Name      string    `mapstructure:"name"`
+	Size      int64     `mapstructure:"size"`
+	Timestamp time.Time `mapstructure:"datetime"`
+	IsFile    bool      `mapstructure:"type"`
 }
 
 // FileTransfer represents an ongoing filetransfer to or from teamspeak
@@ -43,7 +44,7 @@ func (a Agent) FileInfo(sid int, cid int, cpw string, name ...string) ([]File, e
 			"name": name,
 		},
 	}
-	err := a.Query.Do(req, &f)
+	err := a.Query.DoContext(a.Context(), req, &f)
 	if err != nil {
 		return nil, err
 	}
@@ -64,7 +65,7 @@ func (a Agent) FileList(sid int, cid int, cpw string, path string) ([]File, erro
 		return f, nil
 	}
 	files := []File{}
-	err = a.Query.Do(
+	err = a.Query.DoContext(a.Context(),
 		libts.Request{
 			ServerID: sid,
 			Command:  "ftgetfilelist",
@@ -74,10 +75,10 @@ func (a Agent) FileList(sid int, cid int, cpw string, path string) ([]File, erro
 				"path": path,
 			},
 		}, &files)
-	if err != nil {
+	if err != nil && !emptyResult(err) {
 		return nil, err
 	}
-	return files, err
+	return files, nil
 }
 
 // CreateDirectory on server sid in channel cid with channelpassword cpw and name name
@@ -96,15 +97,16 @@ func (a Agent) CreateDirectory(sid int, cid int, cpw string, name string) error
 			"name": name,
 		},
 	}
-	return a.Query.Do(req, nil)
+	return a.Query.DoContext(a.Context(), req, nil)
 }
 
 // DeleteFile deletes one or more files on server sid in channel cid with channelpassword cpw and names name
+// Returns one result per file in the order of name
 // sid - required
 // cid - required
 // cpw - optional
 // name - required
-func (a Agent) DeleteFile(sid int, cid int, cpw string, name ...string) error {
+func (a Agent) DeleteFile(sid int, cid int, cpw string, name ...string) ([]Result, error) {
 	req := libts.Request{
 		Command:  "ftdeletefile",
 		ServerID: sid,
@@ -114,7 +116,11 @@ func (a Agent) DeleteFile(sid int, cid int, cpw string, name ...string) error {
 			"name": name,
 		},
 	}
-	return a.Query.Do(req, nil)
+	rs, err := a.bulk(req)
+	if err != nil {
+		return nil, err
+	}
+	return results(rs), nil
 }
 
 // MoveFile on server sid from channel cid with channelpassword cpw to channel tcid with channelpassword tcpw and rename from name to newname
@@ -140,7 +146,7 @@ func (a Agent) MoveFile(sid int, cid int, cpw string, tcid int, tcpw string, nam
 		req.Args["tcid"] = tcid
 		req.Args["tcpw"] = tcpw
 	}
-	return a.Query.Do(req, nil)
+	return a.Query.DoContext(a.Context(), req, nil)
 }
 
 // TODO: look into ftstop
@@ -153,7 +159,7 @@ func (a Agent) MoveFile(sid int, cid int, cpw string, tcid int, tcpw string, nam
 func (a Agent) InitDownload(sid int, f File, cpw string) (*FileTransfer, error) {
 	clientftfid := rand.Int31n(1234) // random, unique id
 	ft := FileTransfer{}
-	err := a.Query.Do(
+	err := a.Query.DoContext(a.Context(),
 		libts.Request{
 			ServerID: sid,
 			Command:  "ftinitdownload",
@@ -182,7 +188,7 @@ func (a Agent) InitDownload(sid int, f File, cpw string) (*FileTransfer, error)
 func (a Agent) InitUpload(sid, cid int, cpw string, name string, overwrite bool, size int) (*FileTransfer, error) {
 	clientftfid := rand.Int31n(1234) // random, unique id
 	ft := FileTransfer{}
-	err := a.Query.Do(
+	err := a.Query.DoContext(a.Context(),
 		libts.Request{
 			ServerID: sid,
 			Command:  "ftinitupload",
@@ -8,12 +8,12 @@ import "github.com/schoeppi5/libts"
 // Type Servergroups -> 2 = Server Query Group | 0 = Template | 1 = Normal (I think)
 func (a Agent) ServerGroupList(sid int) ([]Group, error) {
 	groups := []Group{}
-	err := a.Query.Do(
+	err := a.Query.DoContext(a.Context(),
 		libts.Request{
 			ServerID: sid,
 			Command:  "servergrouplist",
 		}, &groups)
-	if err != nil {
+	if err != nil && !emptyResult(err) {
 		return nil, err
 	}
 	return groups, nil
@@ -23,13 +23,53 @@ func (a Agent) ServerGroupList(sid int) ([]Group, error) {
 // Type Channelgroups -> 0 = Template | 1 = Normal
 func (a Agent) ChannelGroupList(sid int) ([]Group, error) {
 	groups := []Group{}
-	err := a.Query.Do(
+	err := a.Query.DoContext(a.Context(),
 		libts.Request{
 			ServerID: sid,
 			Command:  "channelgrouplist",
 		}, &groups)
-	if err != nil {
+	if err != nil && !emptyResult(err) {
 		return nil, err
 	}
 	return groups, nil
 }
+
+// ServerGroupAddClients adds the clients cldbid to the servergroup sgid
+// Returns one result per client in the order of cldbid
+// sid - required
+// sgid - required
+// cldbid - required
+func (a Agent) ServerGroupAddClients(sid int, sgid int, cldbid ...int) ([]Result, error) {
+	rs, err := a.bulk(libts.Request{
+		ServerID: sid,
+		Command:  "servergroupaddclient",
+		Args: map[string]interface{}{
+			"sgid":   sgid,
+			"cldbid": cldbid,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results(rs), nil
+}
+
+// ServerGroupDelClients removes the clients cldbid from the servergroup sgid
+// Returns one result per client in the order of cldbid
+// sid - required
+// sgid - required
+// cldbid - required
+func (a Agent) ServerGroupDelClients(sid int, sgid int, cldbid ...int) ([]Result, error) {
+	rs, err := a.bulk(libts.Request{
+		ServerID: sid,
+		Command:  "servergroupdelclient",
+		Args: map[string]interface{}{
+			"sgid":   sgid,
+			"cldbid": cldbid,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results(rs), nil
+}
@@ -89,7 +89,10 @@ func (a Agent) LogView(sid int) ([]LogEntry, error) {
 		if beginPos > 1 { // beginPos needed to start somewhere
 			req.Args["begin_pos"] = beginPos
 		}
-		logs, err := a.Query.DoRaw(req)
+		logs, err := a.Query.DoRawContext(a.Context(), req)
+		if emptyResult(err) {
+			break
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -98,7 +101,7 @@ func (a Agent) LogView(sid int) ([]LogEntry, error) {
 			FileSize int64 `mapstructure:"file_size"`
 		}{}
 		firstLog := bytes.Index(logs, []byte("l="))
-		err = communication.UnmarshalResponse(communication.ConvertResponse(logs[:firstLog]), &meta)
+		err = communication.Unmarshal(logs[:firstLog], &meta)
 		if err != nil {
 			return nil, err
 		}
@@ -106,7 +109,7 @@ func (a Agent) LogView(sid int) ([]LogEntry, error) {
 		entries := []struct {
 			L string `mapstructure:"l"`
 		}{}
-		err = communication.UnmarshalResponse(communication.ConvertResponse(logs[firstLog:]), &entries)
+		err = communication.Unmarshal(logs[firstLog:], &entries)
 		if err != nil {
 			return nil, err
 		}
@@ -137,7 +140,7 @@ func (a Agent) LogAdd(sid int, level LogLevel, message string) error {
 			"loglevel": int(level),
 		},
 	}
-	return a.Query.Do(req, nil)
+	return a.Query.DoContext(a.Context(), req, nil)
 }
 
 func parseLogEntry(l string) (*LogEntry, error) {
@@ -17,7 +17,7 @@ func (a Agent) SendOfflineMessage(sid int, cluid, subject, message string) error
 			"message": message,
 		},
 	}
-	return a.Query.Do(req, nil)
+	return a.Query.DoContext(a.Context(), req, nil)
 }
 
 // DeleteOfflineMessage on server sid with message id id from your inbox
@@ -32,7 +32,7 @@ func (a Agent) DeleteOfflineMessage(sid int, id int) error {
 			"msgid": id,
 		},
 	}
-	return a.Query.Do(req, nil)
+	return a.Query.DoContext(a.Context(), req, nil)
 }
 
 // GetOfflineMessage on server sid with message id id from your inbox
@@ -47,7 +47,7 @@ func (a Agent) GetOfflineMessage(sid, id int) error {
 			"msgid": id,
 		},
 	}
-	return a.Query.Do(req, nil)
+	return a.Query.DoContext(a.Context(), req, nil)
 }
 
 // Not implemented
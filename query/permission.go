@@ -0,0 +1,42 @@
+package query
+
+import (
+	"fmt"
+
+	"github.com/schoeppi5/libts"
+)
+
+// Permission is a permission of the instance
+type Permission struct {
+	ID          int    `mapstructure:"permid"`
+	Name        string `mapstructure:"permname"`
+	Description string `mapstructure:"permdesc"`
+}
+
+// PermissionList returns all permissions of the instance
+func (a Agent) PermissionList() ([]Permission, error) {
+	perms := []Permission{}
+	err := a.Query.DoContext(a.Context(),
+		libts.Request{
+			Command: "permissionlist",
+		}, &perms)
+	if err != nil && !emptyResult(err) {
+		return nil, err
+	}
+	return perms, nil
+}
+
+// PermissionName returns the name of the permission permid
+// Useful to explain the FailedPermID of an error
+func (a Agent) PermissionName(permid int) (string, error) {
+	perms, err := a.PermissionList()
+	if err != nil {
+		return "", err
+	}
+	for _, p := range perms {
+		if p.ID == permid {
+			return p.Name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown permission %d", permid)
+}
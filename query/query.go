@@ -1,8 +1,85 @@
 package query
 
-import "github.com/schoeppi5/libts"
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/communication"
+)
 
 // Agent is a collection of prepared commands for querying teamspeak
 type Agent struct {
 	Query libts.Query
+	ctx   context.Context
+}
+
+// WithContext returns a copy of a, which runs all commands with ctx
+// Cancelling ctx aborts running commands
+func (a Agent) WithContext(ctx context.Context) Agent {
+	if ctx == nil {
+		panic("nil context")
+	}
+	a.ctx = ctx
+	return a
+}
+
+// Context returns the context of a. Defaults to context.Background()
+func (a Agent) Context() context.Context {
+	if a.ctx != nil {
+		return a.ctx
+	}
+	return context.Background()
+}
+
+// emptyResult returns true, if teamspeak had nothing to list
+// List methods return an empty slice instead of the error
+func emptyResult(err error) bool {
+	var e communication.EmptyResultError
+	return errors.As(err, &e)
+}
+
+// Result is the outcome for a single item of a bulk command (e.g. one client of KickClients)
+// Bulk commands return one result per item, in the order of the items
+type Result struct {
+	// Index of the item (e.g. clid[Index] of KickClients)
+	Index int
+	// Err is the error for the item, nil if it succeeded
+	Err error
+}
+
+// bulk sends every item of req on its own and returns their results (see communication.Each)
+// It only fails, if a request failed for another reason than a QueryError
+func (a Agent) bulk(req libts.Request) ([]communication.Result, error) {
+	return communication.Each(a.Context(), a.Query, req)
+}
+
+// results strips the data of rs
+func results(rs []communication.Result) []Result {
+	results := make([]Result, len(rs))
+	for i := range rs {
+		results[i] = Result{Index: rs[i].Index, Err: rs[i].Err}
+	}
+	return results
+}
+
+// edit sends req with the fields, which differ between before and after
+// Nothing is sent, if nothing changed
+func (a Agent) edit(req libts.Request, before, after interface{}) error {
+	changes, err := communication.MarshalChanges(before, after)
+	if err != nil || len(changes) == 0 {
+		return err
+	}
+	keys := make([]string, 0, len(changes))
+	for k := range changes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := req.Ordered()
+	for _, k := range keys {
+		params.Add(k, changes[k])
+	}
+	req.Params = params
+	return a.Query.DoContext(a.Context(), req, nil)
 }
@@ -0,0 +1,143 @@
+package query_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/cassette"
+	"github.com/schoeppi5/libts/query"
+)
+
+func TestListsWithEmptyResult(t *testing.T) {
+	t.Parallel()
+	// given
+	player, err := cassette.Load("testdata/empty_result.jsonl", cassette.Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := query.Agent{Query: player}
+	lists := []struct {
+		name string
+		list func() (interface{}, error)
+	}{
+		{"ChannelList", func() (interface{}, error) { return a.ChannelList(1) }},
+		{"ClientList", func() (interface{}, error) { return a.ClientList(1) }},
+		{"ServerGroupList", func() (interface{}, error) { return a.ServerGroupList(1) }},
+		{"ChannelGroupList", func() (interface{}, error) { return a.ChannelGroupList(1) }},
+		{"VirtualServerList", func() (interface{}, error) { return a.VirtualServerList() }},
+		{"BindingList", func() (interface{}, error) { return a.BindingList(1, "") }},
+		{"PermissionList", func() (interface{}, error) { return a.PermissionList() }},
+		{"APIKeyList", func() (interface{}, error) { return a.APIKeyList(1, 0, 0, 0) }},
+		{"BanList", func() (interface{}, error) { return a.BanList(1, 0, 0) }},
+		{"FileList", func() (interface{}, error) { return a.FileList(1, 1, "", "/") }},
+		{"LogView", func() (interface{}, error) { return a.LogView(1) }},
+	}
+
+	for _, l := range lists {
+		// when
+		have, err := l.list()
+
+		// then
+		if err != nil {
+			t.Errorf("Test %s/%s failed!\n\tUnexpected error: %s", t.Name(), l.name, err)
+			continue
+		}
+		if v := reflect.ValueOf(have); v.IsNil() || v.Len() != 0 {
+			t.Errorf("Test %s/%s failed!\n\tHave: %#v\n\tWant: empty slice", t.Name(), l.name, have)
+		}
+	}
+	if unplayed := player.Unplayed(); len(unplayed) != 0 {
+		t.Errorf("Test %s failed!\n\tHave: %d unplayed entries\n\tWant: %d", t.Name(), len(unplayed), 0)
+	}
+}
+
+func TestBanClients(t *testing.T) {
+	t.Parallel()
+	// given
+	player, err := cassette.Load("testdata/banclient.jsonl", cassette.Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := query.Agent{Query: player}
+
+	// when
+	bans, err := a.BanClients(1, time.Minute, "spam", 5, 6, 7)
+
+	// then
+	if err != nil || len(bans) != 3 {
+		t.Fatalf("Test %s failed!\n\tHave: %v (%v)\n\tWant: %d results", t.Name(), bans, err, 3)
+	}
+	for i := range bans {
+		if bans[i].Index != i {
+			t.Errorf("Test %s failed!\n\tHave: %d\n\tWant: %d", t.Name(), bans[i].Index, i)
+		}
+	}
+	if bans[0].Err != nil || !reflect.DeepEqual(bans[0].BanIDs, []int{1, 2}) {
+		t.Errorf("Test %s failed!\n\tHave: %+v\n\tWant: %v", t.Name(), bans[0], []int{1, 2})
+	}
+	if !errors.Is(bans[1].Err, libts.ErrInvalidClientID) || len(bans[1].BanIDs) != 0 {
+		t.Errorf("Test %s failed!\n\tHave: %+v\n\tWant: %v", t.Name(), bans[1], libts.ErrInvalidClientID)
+	}
+	if bans[2].Err != nil || !reflect.DeepEqual(bans[2].BanIDs, []int{3}) {
+		t.Errorf("Test %s failed!\n\tHave: %+v\n\tWant: %v", t.Name(), bans[2], []int{3})
+	}
+}
+
+func TestChannelSecondsEmpty(t *testing.T) {
+	t.Parallel()
+	// given
+	channelinfo := func(cid int) *cassette.Request {
+		return cassette.NewRequest(libts.Request{ServerID: 1, Command: "channelinfo", Args: map[string]interface{}{"cid": cid}})
+	}
+	a := query.Agent{Query: cassette.NewPlayer([]cassette.Entry{
+		{Request: channelinfo(1), Response: "channel_name=Lobby seconds_empty=-1"},
+		{Request: channelinfo(2), Response: "channel_name=AFK seconds_empty=90"},
+	}, cassette.Strict)}
+
+	// when
+	lobby, err1 := a.Channel(1, 1)
+	afk, err2 := a.Channel(1, 2)
+
+	// then
+	if err1 != nil || lobby.SecondsEmpty != -time.Second {
+		t.Errorf("Test %s failed!\n\tHave: %+v (%v)\n\tWant: %v", t.Name(), lobby, err1, -time.Second)
+	}
+	if err2 != nil || afk.SecondsEmpty != 90*time.Second {
+		t.Errorf("Test %s failed!\n\tHave: %+v (%v)\n\tWant: %v", t.Name(), afk, err2, 90*time.Second)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	t.Parallel()
+	// given
+	player, err := cassette.Load("testdata/edit.jsonl", cassette.Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := query.Agent{Query: player}
+	channel := query.Channel{ID: 2, Name: "lobby", Codec: "Opus Music", Topic: "welcome"}
+	changed := channel
+	changed.Name = "Lobby"
+	changed.Codec = "Opus Voice"
+	changed.Permanent = true
+	client := query.Client{ID: 5, Nickname: "user", ServerGroups: query.GroupList{6, 8}}
+	changedClient := client
+	changedClient.Description = "afk"
+
+	// when
+	errs := []error{
+		a.ChannelEdit(1, 2, channel, changed),
+		a.ChannelEdit(1, 2, channel, channel), // nothing changed, nothing is sent
+		a.ClientEdit(1, 5, client, changedClient),
+	}
+
+	// then
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v (edit %d)", t.Name(), err, nil, i)
+		}
+	}
+}
@@ -30,7 +30,7 @@ func (a Agent) WhoAmI(sid int) (*Me, error) {
 		whoami.ServerID = sid
 	}
 	me := &Me{}
-	err := a.Query.Do(whoami, me)
+	err := a.Query.DoContext(a.Context(), whoami, me)
 	if err != nil {
 		return nil, err
 	}
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"math/big"
 	"strings"
+	"time"
 
 	"github.com/DataDog/zstd"
 	"github.com/schoeppi5/libts"
@@ -46,60 +47,60 @@ type RawSnapshot struct {
 // Snapshot contains a decoded and decompressed snapshot
 type Snapshot struct {
 	VirtualServer struct {
-		MaxClients                       int     `mapstructure:"virtualserver_maxclients"`
-		SecurityLevel                    int     `mapstructure:"virtualserver_needed_identity_security_level"`
-		Weblist                          bool    `mapstructure:"virtualserver_weblist_enabled"`
-		HostbannerGFXURL                 string  `mapstructure:"virtualserver_hostbanner_gfx_url"`
-		ComplainAutobanCount             int     `mapstructure:"virtualserver_complain_autoban_count"`
-		IconID                           int     `mapstructure:"virtualserver_icon_id"`
-		Password                         string  `mapstructure:"virtualserver_password"`
-		DefaultChannelGroup              int     `mapstructure:"virtualserver_default_channel_group"`
-		HostbannerURL                    string  `mapstructure:"virtualserver_hostbanner_url"`
-		PrioritySpeakerMod               float32 `mapstructure:"virtualserver_priority_speaker_dimm_modificator"`
-		FileStorageClass                 string  `mapstructure:"virtualserver_file_storage_class"`
-		LogChannel                       bool    `mapstructure:"virtualserver_log_channel"`
-		LogServer                        bool    `mapstructure:"virtualserver_log_server"`
-		CodecEncryption                  int     `mapstructure:"virtualserver_codec_encryption_mode"`
-		HostbuttonToolTip                string  `mapstructure:"virtualserver_hostbutton_tooltip"`
-		DefaultServerGroup               int     `mapstructure:"virtualserver_default_server_group"`
-		LogPermissions                   bool    `mapstructure:"virtualserver_log_permissions"`
-		HostMessage                      string  `mapstructure:"virtualserver_hostmessage"`
-		HostMessageMode                  int     `mapstructure:"virtualserver_hostmessage_mode"`
-		HasPassword                      bool    `mapstructure:"virtualserver_flag_password"`
-		LogQuery                         bool    `mapstructure:"virtualserver_log_query"`
-		MaxDownloadTotal                 big.Int `mapstructure:"virtualserver_max_download_total_bandwidth"`
-		UploadQuota                      big.Int `mapstructure:"virtualserver_upload_quota"`
-		ReservedSlots                    int     `mapstructure:"virtualserver_reserved_slots"`
-		AntifloodPluginBlock             int     `mapstructure:"virtualserver_antiflood_points_needed_plugin_block"`
-		LogClient                        bool    `mapstructure:"virtualserver_log_client"`
-		Keypair                          string  `mapstructure:"virtualserver_keypair"`
-		DefaultChannelAdminGroup         int     `mapstructure:"virtualserver_default_channel_admin_group"`
-		AntifloodPointsTickReduce        int     `mapstructure:"virtualserver_antiflood_points_tick_reduce"`
-		AntifloodIPBlock                 int     `mapstructure:"virtualserver_antiflood_points_needed_ip_block"`
-		HostbannerMode                   int     `mapstructure:"virtualserver_hostbanner_mode"`
-		MinIOSVersion                    string  `mapstructure:"virtualserver_min_ios_version"`
-		ProtocolVerifyKeypair            string  `mapstructure:"virtualserver_protocol_verify_keypair"`
-		Name                             string  `mapstructure:"virtualserver_name"`
-		LogFileTransfer                  bool    `mapstructure:"virtualserver_log_filetransfer"`
-		Nickname                         string  `mapstructure:"virtualserver_nickname"`
-		Filebase                         string  `mapstructure:"virtualserver_filebase"`
-		HostbannerGFXInterval            string  `mapstructure:"virtualserver_hostbanner_gfx_interval"`
-		AccountingToken                  string  `mapstructure:"virtualserver_accounting_token"`
-		Created                          int64   `mapstructure:"virtualserver_created"`
-		MinClientsInChannelForcedSilence int     `mapstructure:"virtualserver_min_clients_in_channel_before_forced_silence"`
-		HostbuttonURL                    string  `mapstructure:"virtualserver_hostbutton_url"`
-		HostbuttonGFXURL                 string  `mapstructure:"virtualserver_hostbutton_gfx_url"`
-		TempChannelDeleteDelayDefault    int     `mapstructure:"virtualserver_channel_temp_delete_delay_default"`
-		WelcomeMessage                   string  `mapstructure:"virtualserver_welcomemessage"`
-		MinAndroidVersion                string  `mapstructure:"virtualserver_min_android_version"`
-		AntifloodCommandBlock            int     `mapstructure:"virtualserver_antiflood_points_needed_command_block"`
-		MinClientVersion                 string  `mapstructure:"virtualserver_min_client_version"`
-		UID                              string  `mapstructure:"virtualserver_unique_identifier"`
-		MaxUploadTotalBandwidth          big.Int `mapstructure:"virtualserver_max_upload_total_bandwidth"`
-		DownloadQuota                    big.Int `mapstructure:"virtualserver_download_quota"`
-		ComplainAutobanTime              int64   `mapstructure:"virtualserver_complain_autoban_time"`
-		ComplainRemoveTime               int64   `mapstructure:"virtualserver_complain_remove_time"`
-		NamePhonetic                     string  `mapstructure:"virtualserver_name_phonetic"`
+		MaxClients                       int           `mapstructure:"virtualserver_maxclients"`
+		SecurityLevel                    int           `mapstructure:"virtualserver_needed_identity_security_level"`
+		Weblist                          bool          `mapstructure:"virtualserver_weblist_enabled"`
+		HostbannerGFXURL                 string        `mapstructure:"virtualserver_hostbanner_gfx_url"`
+		ComplainAutobanCount             int           `mapstructure:"virtualserver_complain_autoban_count"`
+		IconID                           int           `mapstructure:"virtualserver_icon_id"`
+		Password                         string        `mapstructure:"virtualserver_password"`
+		DefaultChannelGroup              int           `mapstructure:"virtualserver_default_channel_group"`
+		HostbannerURL                    string        `mapstructure:"virtualserver_hostbanner_url"`
+		PrioritySpeakerMod               float32       `mapstructure:"virtualserver_priority_speaker_dimm_modificator"`
+		FileStorageClass                 string        `mapstructure:"virtualserver_file_storage_class"`
+		LogChannel                       bool          `mapstructure:"virtualserver_log_channel"`
+		LogServer                        bool          `mapstructure:"virtualserver_log_server"`
+		CodecEncryption                  int           `mapstructure:"virtualserver_codec_encryption_mode"`
+		HostbuttonToolTip                string        `mapstructure:"virtualserver_hostbutton_tooltip"`
+		DefaultServerGroup               int           `mapstructure:"virtualserver_default_server_group"`
+		LogPermissions                   bool          `mapstructure:"virtualserver_log_permissions"`
+		HostMessage                      string        `mapstructure:"virtualserver_hostmessage"`
+		HostMessageMode                  int           `mapstructure:"virtualserver_hostmessage_mode"`
+		HasPassword                      bool          `mapstructure:"virtualserver_flag_password"`
+		LogQuery                         bool          `mapstructure:"virtualserver_log_query"`
+		MaxDownloadTotal                 big.Int       `mapstructure:"virtualserver_max_download_total_bandwidth"`
+		UploadQuota                      big.Int       `mapstructure:"virtualserver_upload_quota"`
+		ReservedSlots                    int           `mapstructure:"virtualserver_reserved_slots"`
+		AntifloodPluginBlock             int           `mapstructure:"virtualserver_antiflood_points_needed_plugin_block"`
+		LogClient                        bool          `mapstructure:"virtualserver_log_client"`
+		Keypair                          string        `mapstructure:"virtualserver_keypair"`
+		DefaultChannelAdminGroup         int           `mapstructure:"virtualserver_default_channel_admin_group"`
+		AntifloodPointsTickReduce        int           `mapstructure:"virtualserver_antiflood_points_tick_reduce"`
+		AntifloodIPBlock                 int           `mapstructure:"virtualserver_antiflood_points_needed_ip_block"`
+		HostbannerMode                   int           `mapstructure:"virtualserver_hostbanner_mode"`
+		MinIOSVersion                    string        `mapstructure:"virtualserver_min_ios_version"`
+		ProtocolVerifyKeypair            string        `mapstructure:"virtualserver_protocol_verify_keypair"`
+		Name                             string        `mapstructure:"virtualserver_name"`
+		LogFileTransfer                  bool          `mapstructure:"virtualserver_log_filetransfer"`
+		Nickname                         string        `mapstructure:"virtualserver_nickname"`
+		Filebase                         string        `mapstructure:"virtualserver_filebase"`
+		HostbannerGFXInterval            time.Duration `mapstructure:"virtualserver_hostbanner_gfx_interval" unit:"s"`
+		AccountingToken                  string        `mapstructure:"virtualserver_accounting_token"`
+		Created                          time.Time     `mapstructure:"virtualserver_created"`
+		MinClientsInChannelForcedSilence int           `mapstructure:"virtualserver_min_clients_in_channel_before_forced_silence"`
+		HostbuttonURL                    string        `mapstructure:"virtualserver_hostbutton_url"`
+		HostbuttonGFXURL                 string        `mapstructure:"virtualserver_hostbutton_gfx_url"`
+		TempChannelDeleteDelayDefault    time.Duration `mapstructure:"virtualserver_channel_temp_delete_delay_default" unit:"s"`
+		WelcomeMessage                   string        `mapstructure:"virtualserver_welcomemessage"`
+		MinAndroidVersion                string        `mapstructure:"virtualserver_min_android_version"`
+		AntifloodCommandBlock            int           `mapstructure:"virtualserver_antiflood_points_needed_command_block"`
+		MinClientVersion                 string        `mapstructure:"virtualserver_min_client_version"`
+		UID                              string        `mapstructure:"virtualserver_unique_identifier"`
+		MaxUploadTotalBandwidth          big.Int       `mapstructure:"virtualserver_max_upload_total_bandwidth"`
+		DownloadQuota                    big.Int       `mapstructure:"virtualserver_download_quota"`
+		ComplainAutobanTime              time.Duration `mapstructure:"virtualserver_complain_autoban_time" unit:"s"`
+		ComplainRemoveTime               time.Duration `mapstructure:"virtualserver_complain_remove_time" unit:"s"`
+		NamePhonetic                     string        `mapstructure:"virtualserver_name_phonetic"`
 	}
 	Channels []struct {
 		PID                         int    `mapstructure:"channel_pid"`
@@ -130,13 +131,13 @@ type Snapshot struct {
 		MaxClientsIsUnlimited       bool   `mapstructure:"channel_flag_maxclients_unlimited"`
 	}
 	Clients []struct {
-		UID              string `mapstructure:"client_unique_id"`
-		Nickname         string `mapstructure:"client_nickname"`
-		LastConnected    int64  `mapstructure:"client_lastconnected"`
-		TotalConnections int    `mapstructure:"client_totalconnections"`
-		Created          int64  `mapstructure:"client_created"`
-		Description      string `mapstructure:"client_description"`
-		ID               int    `mapstructure:"client_id"`
+		UID              string    `mapstructure:"client_unique_id"`
+		Nickname         string    `mapstructure:"client_nickname"`
+		LastConnected    time.Time `mapstructure:"client_lastconnected"`
+		TotalConnections int       `mapstructure:"client_totalconnections"`
+		Created          time.Time `mapstructure:"client_created"`
+		Description      string    `mapstructure:"client_description"`
+		ID               int       `mapstructure:"client_id"`
 	}
 	ServerGroups         []snapshotGroup
 	ChannelGroups        []snapshotGroup
@@ -172,11 +173,11 @@ type Snapshot struct {
 		PermissionNegated bool   `mapstructure:"permnegated"`
 	}
 	APIKeys []struct {
-		Hash      string `mapstructure:"hash"`
-		ClientUID string `mapstructure:"cluid"`
-		Scope     Scope  `mapstructure:"scope"`
-		Created   int64  `mapstructure:"created_at"`
-		Expires   int64  `mapstructure:"expires_at"`
+		Hash      string    `mapstructure:"hash"`
+		ClientUID string    `mapstructure:"cluid"`
+		Scope     Scope     `mapstructure:"scope"`
+		Created   time.Time `mapstructure:"created_at"`
+		Expires   time.Time `mapstructure:"expires_at"`
 	}
 }
 
@@ -203,7 +204,7 @@ func (a Agent) SnapshotCreate(sid int, password string) (*RawSnapshot, error) {
 		},
 	}
 	snapshot := &RawSnapshot{}
-	err := a.Query.Do(req, snapshot)
+	err := a.Query.DoContext(a.Context(), req, snapshot)
 	if err != nil {
 		return nil, err
 	}
@@ -216,20 +217,20 @@ func (a Agent) SnapshotCreate(sid int, password string) (*RawSnapshot, error) {
 // password - optional
 // snapshot - required
 func (a Agent) SnapshotDeploy(sid int, keepFiles bool, password string, snapshot RawSnapshot) error {
+	params := libts.NewParams().
+		Add("password", password).
+		Add("version", snapshot.Version).
+		Add("salt", snapshot.Salt).
+		Add("data", snapshot.Data) // in the order of the documentation
+	if keepFiles {
+		params.Flag(libts.FlagKeepFiles)
+	}
 	req := libts.Request{
 		Command:  "serversnapshotdeploy",
 		ServerID: sid,
-		Args: map[string]interface{}{
-			"password": password,
-		},
-	}
-	if keepFiles {
-		req.Args["-keepfiles"] = ""
+		Params:   params,
 	}
-	req.Args["version"] = snapshot.Version
-	req.Args["salt"] = snapshot.Salt
-	req.Args["data"] = snapshot.Data
-	return a.Query.Do(req, nil)
+	return a.Query.DoContext(a.Context(), req, nil)
 }
 
 // DecodeToString decodes to snapshot to a string
@@ -333,11 +334,7 @@ func parseSection(section []byte, i interface{}) error {
 	if len(section) == 0 {
 		return nil
 	}
-	m := communication.ConvertResponse(section)
-	if len(m) != 0 {
-		return communication.UnmarshalResponse(m, i)
-	}
-	return nil
+	return communication.Unmarshal(section, i)
 }
 
 func parseGroups(start int, raw string) ([]snapshotGroup, error) {
@@ -4,109 +4,110 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Server represents the actual server instance
 // Can contain multiple virtual servers
 // This is the combined result of "hostinfo" and "instanceinfo"
 type Server struct {
-	Uptime                         int64 `mapstructure:"instance_uptime"`
-	ServerTime                     int64 `mapstructure:"host_timestamp_utc"`
-	VirtualServerCount             int   `mapstructure:"virtualservers_running_total"`
-	MaxClients                     int   `mapstructure:"virtualservers_total_maxclients"`
-	TotalClients                   int   `mapstructure:"virtualservers_total_clients_online"`
-	TotalChannels                  int   `mapstructure:"virtualservers_total_channels_online"`
-	FTPPort                        int   `mapstructure:"serverinstance_filetransfer_port"`
-	DefaultServerQueryGroup        int   `mapstructure:"serverinstance_guest_serverquery_group"`
-	MaxServerQueryCommands         int   `mapstructure:"serverinstance_serverquery_flood_commands"`
-	ServerQueryFloodTime           int   `mapstructure:"serverinstance_serverquery_flood_time"` //seconds
-	ServerQueryFloodBanTime        int   `mapstructure:"serverinstance_serverquery_ban_time"`   //seconds
-	DatabaseVersion                int   `mapstructure:"serverinstance_database_version"`
-	PendingConnectionsPerIP        int   `mapstructure:"serverinstance_pending_connections_per_ip"`
-	PermissionsVersion             int   `mapstructure:"serverinstance_permissions_version"`
-	ServerQueryMaxConnectionsPerIP int   `mapstructure:"serverinstance_serverquery_max_connections_per_ip"`
-	TemplateChannelAdminGroup      int   `mapstructure:"serverinstance_template_channeladmin_group"`
-	TemplateChannelDefaultGroup    int   `mapstructure:"serverinstance_template_channeldefault_group"`
-	TemplateServerAdminGroup       int   `mapstructure:"serverinstance_template_serveradmin_group"`
-	TemplateServerDefaultGroup     int   `mapstructure:"serverinstance_template_serverdefault_group"`
+	Uptime                         time.Duration `mapstructure:"instance_uptime" unit:"s"`
+	ServerTime                     time.Time     `mapstructure:"host_timestamp_utc"`
+	VirtualServerCount             int           `mapstructure:"virtualservers_running_total"`
+	MaxClients                     int           `mapstructure:"virtualservers_total_maxclients"`
+	TotalClients                   int           `mapstructure:"virtualservers_total_clients_online"`
+	TotalChannels                  int           `mapstructure:"virtualservers_total_channels_online"`
+	FTPPort                        int           `mapstructure:"serverinstance_filetransfer_port"`
+	DefaultServerQueryGroup        int           `mapstructure:"serverinstance_guest_serverquery_group"`
+	MaxServerQueryCommands         int           `mapstructure:"serverinstance_serverquery_flood_commands"`
+	ServerQueryFloodTime           time.Duration `mapstructure:"serverinstance_serverquery_flood_time" unit:"s"`
+	ServerQueryFloodBanTime        time.Duration `mapstructure:"serverinstance_serverquery_ban_time" unit:"s"`
+	DatabaseVersion                int           `mapstructure:"serverinstance_database_version"`
+	PendingConnectionsPerIP        int           `mapstructure:"serverinstance_pending_connections_per_ip"`
+	PermissionsVersion             int           `mapstructure:"serverinstance_permissions_version"`
+	ServerQueryMaxConnectionsPerIP int           `mapstructure:"serverinstance_serverquery_max_connections_per_ip"`
+	TemplateChannelAdminGroup      int           `mapstructure:"serverinstance_template_channeladmin_group"`
+	TemplateChannelDefaultGroup    int           `mapstructure:"serverinstance_template_channeldefault_group"`
+	TemplateServerAdminGroup       int           `mapstructure:"serverinstance_template_serveradmin_group"`
+	TemplateServerDefaultGroup     int           `mapstructure:"serverinstance_template_serverdefault_group"`
 }
 
 // VirtualServer represents a single virtual server instance
 type VirtualServer struct {
-	UID                              string  `mapstructure:"virtualserver_unique_identifier"`
-	Name                             string  `mapstructure:"virtualserver_name"`
-	WelcomeMessage                   string  `mapstructure:"virtualserver_welcomemessage"`
-	Platform                         string  `mapstructure:"virtualserver_platform"`
-	Version                          string  `mapstructure:"virtualserver_version"`
-	MaxClients                       int     `mapstructure:"virtualserver_maxclients"`
-	TotalClients                     int     `mapstructure:"virtualserver_clientsonline"`
-	ChannelCount                     int     `mapstructure:"virtualserver_channelsonline"`
-	Created                          int64   `mapstructure:"virtualserver_created"`
-	Uptime                           int64   `mapstructure:"virtualserver_uptime"`
-	CodecEncryption                  int     `mapstructure:"virtualserver_codec_encryption_mod"`
-	HostMessage                      string  `mapstructure:"virtualserver_hostmessage"`
-	HostMessageMode                  int     `mapstructure:"virtualserver_hostmessage_mode"`
-	FileBase                         string  `mapstructure:"virtualserver_filebase"`
-	DefaultServerGroup               int     `mapstructure:"virtualserver_default_server_group"`
-	DefaultChannelGroup              int     `mapstructure:"virtualserver_default_channel_group"`
-	Password                         bool    `mapstructure:"virtualserver_flag_password"`
-	DefaultChannelAdminGroup         int     `mapstructure:"virtualserver_default_channel_admin_group"`
-	HostbannerURL                    string  `mapstructure:"virtualserver_hostbanner_url"`
-	HostbannerGFXURL                 string  `mapstructure:"virtualserver_hostbanner_gfx_url"`
-	HostbannerGFXInterval            string  `mapstructure:"virtualserver_hostbanner_gfx_interval"`
-	ComplainAutobanCount             int     `mapstructure:"virtualserver_complain_autoban_count"`
-	ComplainAutobanTime              int     `mapstructure:"virtualserver_complain_autoban_time"`
-	ComplainRemoveTime               int     `mapstructure:"virtualserver_complain_remove_time"`
-	MinClientsInChannelForcedSilence int     `mapstructure:"virtualserver_min_clients_in_channel_before_forced_silence"`
-	PrioritySpeakerMod               float32 `mapstructure:"virtualserver_priority_speaker_dimm_modificator"`
-	ID                               int     `mapstructure:"virtualserver_id"`
-	AntifloodPointsTickReduce        int     `mapstructure:"virtualserver_antiflood_points_tick_reduce"`
-	AntifloodCommandBlock            int     `mapstructure:"virtualserver_antiflood_points_needed_command_block"`
-	AntifloodIPBlock                 int     `mapstructure:"virtualserver_antiflood_points_needed_ip_block"`
-	TotalClientConnections           int     `mapstructure:"virtualserver_client_connections"`       // I think thats all connections since startup (not creation)
-	TotalQueryConnections            int     `mapstructure:"virtualserver_query_client_connections"` // Same here
-	HostbuttonToolTip                string  `mapstructure:"virtualserver_hostbutton_tooltip"`
-	HostbuttonURL                    string  `mapstructure:"virtualserver_hostbutton_url"`
-	HostbuttonGFXURL                 string  `mapstructure:"virtualserver_hostbutton_gfx_url"`
-	QueryClientCount                 int     `mapstructure:"virtualserver_queryclientsonline"`
-	Port                             int     `mapstructure:"virtualserver_port"`
-	Autostart                        bool    `mapstructure:"virtualserver_autostart"`
-	SecurityLevel                    int     `mapstructure:"virtualserver_needed_identity_security_level"`
-	NamePhonetic                     string  `mapstructure:"virtualserver_name_phonetic"`
-	IconID                           int     `mapstructure:"virtualserver_icon_id"`
-	ReservedSlots                    int     `mapstructure:"virtualserver_reserved_slots"`
-	Ping                             float32 `mapstructure:"virtualserver_total_ping"`
-	Weblist                          bool    `mapstructure:"virtualserver_weblist_enabled"`
-	HostbannerMode                   int     `mapstructure:"virtualserver_hostbanner_mode"`
-	TempChannelDeleteDelayDefault    int     `mapstructure:"virtualserver_channel_temp_delete_delay_default"`
-	Nickname                         string  `mapstructure:"virtualserver_nickname"`
-	AntifloodPluginBlock             int     `mapstructure:"virtualserver_antiflood_points_needed_plugin_block"`
-	Status                           string  `mapstructure:"virtualserver_status"`
+	UID                              string        `mapstructure:"virtualserver_unique_identifier"`
+	Name                             string        `mapstructure:"virtualserver_name"`
+	WelcomeMessage                   string        `mapstructure:"virtualserver_welcomemessage"`
+	Platform                         string        `mapstructure:"virtualserver_platform"`
+	Version                          string        `mapstructure:"virtualserver_version"`
+	MaxClients                       int           `mapstructure:"virtualserver_maxclients"`
+	TotalClients                     int           `mapstructure:"virtualserver_clientsonline"`
+	ChannelCount                     int           `mapstructure:"virtualserver_channelsonline"`
+	Created                          time.Time     `mapstructure:"virtualserver_created"`
+	Uptime                           time.Duration `mapstructure:"virtualserver_uptime" unit:"s"`
+	CodecEncryption                  int           `mapstructure:"virtualserver_codec_encryption_mod"`
+	HostMessage                      string        `mapstructure:"virtualserver_hostmessage"`
+	HostMessageMode                  int           `mapstructure:"virtualserver_hostmessage_mode"`
+	FileBase                         string        `mapstructure:"virtualserver_filebase"`
+	DefaultServerGroup               int           `mapstructure:"virtualserver_default_server_group"`
+	DefaultChannelGroup              int           `mapstructure:"virtualserver_default_channel_group"`
+	Password                         bool          `mapstructure:"virtualserver_flag_password"`
+	DefaultChannelAdminGroup         int           `mapstructure:"virtualserver_default_channel_admin_group"`
+	HostbannerURL                    string        `mapstructure:"virtualserver_hostbanner_url"`
+	HostbannerGFXURL                 string        `mapstructure:"virtualserver_hostbanner_gfx_url"`
+	HostbannerGFXInterval            time.Duration `mapstructure:"virtualserver_hostbanner_gfx_interval" unit:"s"`
+	ComplainAutobanCount             int           `mapstructure:"virtualserver_complain_autoban_count"`
+	ComplainAutobanTime              time.Duration `mapstructure:"virtualserver_complain_autoban_time" unit:"s"`
+	ComplainRemoveTime               time.Duration `mapstructure:"virtualserver_complain_remove_time" unit:"s"`
+	MinClientsInChannelForcedSilence int           `mapstructure:"virtualserver_min_clients_in_channel_before_forced_silence"`
+	PrioritySpeakerMod               float32       `mapstructure:"virtualserver_priority_speaker_dimm_modificator"`
+	ID                               int           `mapstructure:"virtualserver_id"`
+	AntifloodPointsTickReduce        int           `mapstructure:"virtualserver_antiflood_points_tick_reduce"`
+	AntifloodCommandBlock            int           `mapstructure:"virtualserver_antiflood_points_needed_command_block"`
+	AntifloodIPBlock                 int           `mapstructure:"virtualserver_antiflood_points_needed_ip_block"`
+	TotalClientConnections           int           `mapstructure:"virtualserver_client_connections"`       // I think thats all connections since startup (not creation)
+	TotalQueryConnections            int           `mapstructure:"virtualserver_query_client_connections"` // Same here
+	HostbuttonToolTip                string        `mapstructure:"virtualserver_hostbutton_tooltip"`
+	HostbuttonURL                    string        `mapstructure:"virtualserver_hostbutton_url"`
+	HostbuttonGFXURL                 string        `mapstructure:"virtualserver_hostbutton_gfx_url"`
+	QueryClientCount                 int           `mapstructure:"virtualserver_queryclientsonline"`
+	Port                             int           `mapstructure:"virtualserver_port"`
+	Autostart                        bool          `mapstructure:"virtualserver_autostart"`
+	SecurityLevel                    int           `mapstructure:"virtualserver_needed_identity_security_level"`
+	NamePhonetic                     string        `mapstructure:"virtualserver_name_phonetic"`
+	IconID                           int           `mapstructure:"virtualserver_icon_id"`
+	ReservedSlots                    int           `mapstructure:"virtualserver_reserved_slots"`
+	Ping                             float32       `mapstructure:"virtualserver_total_ping"`
+	Weblist                          bool          `mapstructure:"virtualserver_weblist_enabled"`
+	HostbannerMode                   int           `mapstructure:"virtualserver_hostbanner_mode"`
+	TempChannelDeleteDelayDefault    time.Duration `mapstructure:"virtualserver_channel_temp_delete_delay_default" unit:"s"`
+	Nickname                         string        `mapstructure:"virtualserver_nickname"`
+	AntifloodPluginBlock             int           `mapstructure:"virtualserver_antiflood_points_needed_plugin_block"`
+	Status                           string        `mapstructure:"virtualserver_status"`
 }
 
 // Channel is a single Channel on a virtual server
 type Channel struct {
-	ID               int    `mapstructure:"id"`
-	ParentID         int    `mapstructure:"pid"`
-	IconID           int    `mapstructure:"channel_icon_id"`
-	Name             string `mapstructure:"channel_name"`
-	Topic            string `mapstructure:"channel_topic"`
-	Description      string `mapstructure:"channel_description"`
-	Password         bool   `mapstructure:"channel_flag_password"`
-	Codec            Codec  `mapstructure:"channel_codec"`
-	CodecQuality     int    `mapstructure:"channel_codec_quality"`
-	MaxClients       int    `mapstructure:"channel_maxclients"`
-	MaxFamilyClients int    `mapstructure:"channel_maxfamilyclients"`
-	Order            int    `mapstructure:"channel_order"`
-	Permanent        bool   `mapstructure:"channel_flag_permanent"`
-	SemiPermanent    bool   `mapstructure:"channel_flag_semi_permanent"`
-	Temporary        bool   `mapstructure:"channel_flag_temporary"`
-	DefaultChannel   bool   `mapstructure:"channel_flag_default"`
-	TalkPower        int    `mapstructure:"channel_needed_talk_power"`
-	NamePhonetic     string `mapstructure:"channel_name_phonetic"`
-	FilePath         string `mapstructure:"channel_filepath"`
-	Silenced         bool   `mapstructure:"channel_forced_silence"`
-	SecondsEmpty     int64  `mapstructure:"seconds_empty"`
+	ID               int           `mapstructure:"id"`
+	ParentID         int           `mapstructure:"pid"`
+	IconID           int           `mapstructure:"channel_icon_id"`
+	Name             string        `mapstructure:"channel_name"`
+	Topic            string        `mapstructure:"channel_topic"`
+	Description      string        `mapstructure:"channel_description"`
+	Password         bool          `mapstructure:"channel_flag_password"`
+	Codec            Codec         `mapstructure:"channel_codec"`
+	CodecQuality     int           `mapstructure:"channel_codec_quality"`
+	MaxClients       int           `mapstructure:"channel_maxclients"`
+	MaxFamilyClients int           `mapstructure:"channel_maxfamilyclients"`
+	Order            int           `mapstructure:"channel_order"`
+	Permanent        bool          `mapstructure:"channel_flag_permanent"`
+	SemiPermanent    bool          `mapstructure:"channel_flag_semi_permanent"`
+	Temporary        bool          `mapstructure:"channel_flag_temporary"`
+	DefaultChannel   bool          `mapstructure:"channel_flag_default"`
+	TalkPower        int           `mapstructure:"channel_needed_talk_power"`
+	NamePhonetic     string        `mapstructure:"channel_name_phonetic"`
+	FilePath         string        `mapstructure:"channel_filepath"`
+	Silenced         bool          `mapstructure:"channel_forced_silence"`
+	SecondsEmpty     time.Duration `mapstructure:"seconds_empty" unit:"s"` // -1s while the channel isn't empty
 }
 
 // Group represents a group on a virtual server (server|channel)
@@ -142,6 +143,21 @@ func (c *Codec) UnmarshalText(text []byte) error {
 	return nil
 }
 
+// MarshalText turns Codec to its number
+func (c Codec) MarshalText() ([]byte, error) {
+	if c == "" {
+		return nil, nil
+	}
+	for i, name := range codecs {
+		if string(c) == name {
+			return []byte(strconv.Itoa(i)), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown codec %s", string(c))
+}
+
+var codecs = []string{"Speex Narrowband", "Speex Wideband", "Speex Ultrawideband", "Celt Mono", "Opus Voice", "Opus Music"}
+
 // GroupList represents a list of group ids
 type GroupList []int
 
@@ -159,3 +175,12 @@ func (gl *GroupList) UnmarshalText(text []byte) error {
 	*gl = GroupList(list)
 	return nil
 }
+
+// MarshalText joins the group ids with ,
+func (gl GroupList) MarshalText() ([]byte, error) {
+	groups := make([]string, len(gl))
+	for i := range gl {
+		groups[i] = strconv.Itoa(gl[i])
+	}
+	return []byte(strings.Join(groups, ",")), nil
+}
@@ -24,11 +24,11 @@ func (a Agent) VirtualServerIDList() ([]int, error) {
 	vsList := []struct {
 		ID int `mapstructure:"virtualserver_id"`
 	}{}
-	err := a.Query.Do(
+	err := a.Query.DoContext(a.Context(),
 		libts.Request{
 			Command: "serverlist",
 		}, &vsList)
-	if err != nil {
+	if err != nil && !emptyResult(err) {
 		return nil, err
 	}
 	list := make([]int, len(vsList))
@@ -41,7 +41,7 @@ func (a Agent) VirtualServerIDList() ([]int, error) {
 // VirtualServer returns the virtual server represented by id
 func (a Agent) VirtualServer(sid int) (*VirtualServer, error) {
 	virtualServer := VirtualServer{}
-	err := a.Query.Do(
+	err := a.Query.DoContext(a.Context(),
 		libts.Request{
 			ServerID: sid,
 			Command:  "serverinfo",
@@ -51,3 +51,14 @@ func (a Agent) VirtualServer(sid int) (*VirtualServer, error) {
 	}
 	return &virtualServer, nil
 }
+
+// ServerEdit changes the fields of virtual server sid, which differ between before and after
+// sid - required
+// before - required - usually the result of VirtualServer()
+// after - required - a copy of before with the changes applied
+func (a Agent) ServerEdit(sid int, before, after VirtualServer) error {
+	return a.edit(libts.Request{
+		ServerID: sid,
+		Command:  "serveredit",
+	}, before, after)
+}
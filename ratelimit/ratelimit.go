@@ -0,0 +1,200 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/communication"
+	"github.com/schoeppi5/libts/query"
+)
+
+// Limits of the serverquery flood protection
+type Limits struct {
+	// Commands allowed per Period (serverinstance_serverquery_flood_commands)
+	Commands int
+	// Period in which Commands are allowed (serverinstance_serverquery_flood_time)
+	Period time.Duration
+	// BanTime of the query, if it floods anyway (serverinstance_serverquery_ban_time)
+	BanTime time.Duration
+}
+
+// LimitsFromInstance reads the flood protection of the instance using a
+func LimitsFromInstance(a query.Agent) (Limits, error) {
+	instance, err := a.Instance()
+	if err != nil {
+		return Limits{}, err
+	}
+	return Limits{
+		Commands: instance.ServerQueryFloodCommands,
+		Period:   instance.ServerQueryFloodTime,
+		BanTime:  instance.ServerQueryBanTime,
+	}, nil
+}
+
+// Config of a Limiter
+type Config struct {
+	// Limits to enforce. A zero value disables limiting, but still retries on flood errors
+	Limits Limits
+	// Whitelisted queries (query_ip_allowlist.txt) are not limited by teamspeak, so the Limiter just passes requests through
+	Whitelisted bool
+	// MaxRetries after teamspeak answered with the flood error (524). Defaults to 3, -1 disables retrying
+	MaxRetries int
+	// OnWait is called every time a request has to wait, either because of Limits or because of a flood error
+	OnWait func(request libts.Request, wait time.Duration)
+}
+
+// Limiter wraps a libts.Query and keeps it from exceeding the flood protection of teamspeak
+// A Limiter implements libts.Query itself and is safe for concurrent use
+type Limiter struct {
+	query  libts.Query
+	config Config
+
+	lock sync.Mutex
+	sent []time.Time // send times of the commands in the current period, oldest first
+}
+
+// New limits q according to config
+func New(q libts.Query, config Config) *Limiter {
+	if config.MaxRetries == 0 {
+		config.MaxRetries = 3
+	}
+	return &Limiter{
+		query:  q,
+		config: config,
+	}
+}
+
+// NewFromInstance limits q according to the flood protection configured on the instance
+// config.Limits is overwritten
+func NewFromInstance(ctx context.Context, q libts.Query, config Config) (*Limiter, error) {
+	limits, err := LimitsFromInstance(query.Agent{Query: q}.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	config.Limits = limits
+	return New(q, config), nil
+}
+
+// Do executes request once the limits allow it and attempts to parse the response in value
+func (l *Limiter) Do(request libts.Request, value interface{}) error {
+	return l.DoContext(context.Background(), request, value)
+}
+
+// DoRaw executes request once the limits allow it and returns the raw response
+func (l *Limiter) DoRaw(request libts.Request) ([]byte, error) {
+	return l.DoRawContext(context.Background(), request)
+}
+
+// DoContext executes request once the limits allow it and attempts to parse the response in value
+func (l *Limiter) DoContext(ctx context.Context, request libts.Request, value interface{}) error {
+	raw, err := l.DoRawContext(ctx, request)
+	if err != nil {
+		return err
+	}
+	return communication.Unmarshal(raw, value)
+}
+
+// DoRawContext executes request once the limits allow it and returns the raw response
+// If teamspeak answers with the flood error, the request is retried after waiting one period
+func (l *Limiter) DoRawContext(ctx context.Context, request libts.Request) ([]byte, error) {
+	if l.config.Whitelisted {
+		return l.query.DoRawContext(ctx, request)
+	}
+	for retry := 0; ; retry++ {
+		err := l.wait(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		data, err := l.query.DoRawContext(ctx, request)
+		if !errors.Is(err, libts.ErrClientFlooding) || retry >= l.config.MaxRetries {
+			return data, err
+		}
+		err = l.sleep(ctx, request, l.backoff())
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Notification passes through the notifications of the wrapped query
+func (l *Limiter) Notification() <-chan []byte {
+	return l.query.Notification()
+}
+
+// Connected sends the version command once the limits allow it
+func (l *Limiter) Connected() (bool, error) {
+	_, err := l.DoRaw(libts.Request{
+		Command: "version",
+	})
+	return err == nil, err
+}
+
+// wait until the limits allow sending request and reserve its commands
+func (l *Limiter) wait(ctx context.Context, request libts.Request) error {
+	limits := l.config.Limits
+	if limits.Commands <= 0 || limits.Period <= 0 {
+		return nil
+	}
+	cost := l.cost(request)
+	for {
+		l.lock.Lock()
+		now := time.Now()
+		for len(l.sent) > 0 && now.Sub(l.sent[0]) >= limits.Period { // forget commands outside of the current period
+			l.sent = l.sent[1:]
+		}
+		if len(l.sent)+cost <= limits.Commands || len(l.sent) == 0 {
+			for i := 0; i < cost; i++ {
+				l.sent = append(l.sent, now)
+			}
+			l.lock.Unlock()
+			return nil
+		}
+		oldest := len(l.sent) + cost - limits.Commands - 1
+		if oldest >= len(l.sent) { // request costs more than the limit, wait for an empty period
+			oldest = len(l.sent) - 1
+		}
+		wait := l.sent[oldest].Add(limits.Period).Sub(now)
+		l.lock.Unlock()
+		err := l.sleep(ctx, request, wait)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// cost returns the number of commands needed for request
+// Selecting another virtual server costs an extra command
+func (l *Limiter) cost(request libts.Request) int {
+	if request.ServerID == 0 {
+		return 1
+	}
+	if s, ok := l.query.(interface{ ServerID() int }); ok && s.ServerID() == request.ServerID {
+		return 1
+	}
+	return 2
+}
+
+// backoff returns the time to wait after a flood error
+func (l *Limiter) backoff() time.Duration {
+	if l.config.Limits.Period > 0 {
+		return l.config.Limits.Period
+	}
+	return time.Second
+}
+
+func (l *Limiter) sleep(ctx context.Context, request libts.Request, wait time.Duration) error {
+	if l.config.OnWait != nil {
+		l.config.OnWait(request, wait)
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
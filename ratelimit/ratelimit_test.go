@@ -0,0 +1,272 @@
+package ratelimit_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/communication"
+	"github.com/schoeppi5/libts/ratelimit"
+)
+
+// countingQuery records the time of every request and answers with the flood error for the first floods requests
+type countingQuery struct {
+	lock   sync.Mutex
+	times  []time.Time
+	floods int
+	raw    []byte
+}
+
+func (cq *countingQuery) Do(req libts.Request, v interface{}) error {
+	return cq.DoContext(context.Background(), req, v)
+}
+
+func (cq *countingQuery) DoRaw(req libts.Request) ([]byte, error) {
+	return cq.DoRawContext(context.Background(), req)
+}
+
+func (cq *countingQuery) DoContext(ctx context.Context, req libts.Request, v interface{}) error {
+	raw, err := cq.DoRawContext(ctx, req)
+	if err != nil {
+		return err
+	}
+	return communication.UnmarshalResponse(communication.ConvertResponse(raw), v)
+}
+
+func (cq *countingQuery) DoRawContext(ctx context.Context, req libts.Request) ([]byte, error) {
+	cq.lock.Lock()
+	defer cq.lock.Unlock()
+	cq.times = append(cq.times, time.Now())
+	if cq.floods > 0 {
+		cq.floods--
+		return nil, communication.QueryError{ID: 524, Message: "client is flooding"}
+	}
+	return cq.raw, nil
+}
+
+func (cq *countingQuery) Notification() <-chan []byte {
+	return nil
+}
+
+func (cq *countingQuery) Connected() (bool, error) {
+	return true, nil
+}
+
+func TestLimiterWaitsForPeriod(t *testing.T) {
+	t.Parallel()
+	// given
+	cq := &countingQuery{}
+	waits := 0
+	l := ratelimit.New(cq, ratelimit.Config{
+		Limits: ratelimit.Limits{
+			Commands: 3,
+			Period:   50 * time.Millisecond,
+		},
+		OnWait: func(r libts.Request, wait time.Duration) {
+			waits++
+		},
+	})
+
+	// when
+	for i := 0; i < 5; i++ {
+		_, err := l.DoRaw(libts.Request{Command: "version"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// then
+	if len(cq.times) != 5 {
+		t.Fatalf("Test %s failed!\n\tHave: %d\n\tWant: %d", t.Name(), len(cq.times), 5)
+	}
+	if d := cq.times[3].Sub(cq.times[0]); d < 50*time.Millisecond {
+		t.Errorf("Test %s failed!\n\tFourth command was sent after %s, expected at least %s", t.Name(), d, 50*time.Millisecond)
+	}
+	if waits == 0 {
+		t.Errorf("Test %s failed!\n\tOnWait was not called", t.Name())
+	}
+}
+
+func TestLimiterCountsUse(t *testing.T) {
+	t.Parallel()
+	// given
+	cq := &countingQuery{}
+	l := ratelimit.New(cq, ratelimit.Config{
+		Limits: ratelimit.Limits{
+			Commands: 2,
+			Period:   50 * time.Millisecond,
+		},
+	})
+	start := time.Now()
+
+	// when
+	l.DoRaw(libts.Request{ServerID: 1, Command: "serverinfo"}) // use + serverinfo
+	l.DoRaw(libts.Request{Command: "version"})
+
+	// then
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("Test %s failed!\n\tSecond request was sent after %s, expected at least %s", t.Name(), d, 50*time.Millisecond)
+	}
+}
+
+// serverQuery is a countingQuery using virtual server id
+type serverQuery struct {
+	countingQuery
+	id int
+}
+
+func (sq *serverQuery) ServerID() int {
+	return sq.id
+}
+
+func TestLimiterCostAboveLimit(t *testing.T) {
+	t.Parallel()
+	// given
+	sq := &serverQuery{id: 1}
+	l := ratelimit.New(sq, ratelimit.Config{
+		Limits: ratelimit.Limits{
+			Commands: 1,
+			Period:   50 * time.Millisecond,
+		},
+	})
+	l.DoRaw(libts.Request{ServerID: 1, Command: "serverinfo"})
+	start := time.Now()
+
+	// when
+	_, err := l.DoRaw(libts.Request{ServerID: 2, Command: "serverinfo"}) // use + serverinfo
+
+	// then
+	if err != nil {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), err, nil)
+	}
+	if d := time.Since(start); d < 40*time.Millisecond {
+		t.Errorf("Test %s failed!\n\tSecond request was sent after %s, expected the end of the period", t.Name(), d)
+	}
+}
+
+func TestLimiterRetriesFloodError(t *testing.T) {
+	t.Parallel()
+	// given
+	cq := &countingQuery{floods: 2, raw: []byte("ok=1")}
+	l := ratelimit.New(cq, ratelimit.Config{
+		Limits: ratelimit.Limits{
+			Period: time.Millisecond,
+		},
+	})
+
+	// when
+	have, err := l.DoRaw(libts.Request{Command: "version"})
+
+	// then
+	if err != nil {
+		t.Fatalf("Test %s failed!\n\tUnexpected error: %s", t.Name(), err)
+	}
+	if string(have) != "ok=1" {
+		t.Errorf("Test %s failed!\n\tHave: %s\n\tWant: %s", t.Name(), have, "ok=1")
+	}
+	if len(cq.times) != 3 {
+		t.Errorf("Test %s failed!\n\tHave: %d\n\tWant: %d", t.Name(), len(cq.times), 3)
+	}
+}
+
+func TestLimiterGivesUpOnFloodError(t *testing.T) {
+	t.Parallel()
+	// given
+	cq := &countingQuery{floods: 10}
+	l := ratelimit.New(cq, ratelimit.Config{
+		Limits: ratelimit.Limits{
+			Period: time.Millisecond,
+		},
+		MaxRetries: 2,
+	})
+
+	// when
+	_, err := l.DoRaw(libts.Request{Command: "version"})
+
+	// then
+	if e, ok := err.(communication.QueryError); !ok || e.ID != 524 {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %s", t.Name(), err, "Query error(524)")
+	}
+	if len(cq.times) != 3 {
+		t.Errorf("Test %s failed!\n\tHave: %d\n\tWant: %d", t.Name(), len(cq.times), 3)
+	}
+}
+
+func TestLimiterWhitelisted(t *testing.T) {
+	t.Parallel()
+	// given
+	cq := &countingQuery{}
+	l := ratelimit.New(cq, ratelimit.Config{
+		Limits: ratelimit.Limits{
+			Commands: 1,
+			Period:   time.Hour,
+		},
+		Whitelisted: true,
+	})
+
+	// when
+	for i := 0; i < 10; i++ {
+		l.DoRaw(libts.Request{Command: "version"})
+	}
+
+	// then
+	if len(cq.times) != 10 {
+		t.Errorf("Test %s failed!\n\tHave: %d\n\tWant: %d", t.Name(), len(cq.times), 10)
+	}
+}
+
+func TestLimiterContext(t *testing.T) {
+	t.Parallel()
+	// given
+	cq := &countingQuery{}
+	l := ratelimit.New(cq, ratelimit.Config{
+		Limits: ratelimit.Limits{
+			Commands: 1,
+			Period:   time.Hour,
+		},
+	})
+	l.DoRaw(libts.Request{Command: "version"})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// when
+	_, err := l.DoRawContext(ctx, libts.Request{Command: "version"})
+
+	// then
+	if err != context.DeadlineExceeded {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), err, context.DeadlineExceeded)
+	}
+}
+
+func TestNewFromInstance(t *testing.T) {
+	t.Parallel()
+	// given
+	cq := &countingQuery{raw: []byte("serverinstance_serverquery_flood_commands=50 serverinstance_serverquery_flood_time=3 serverinstance_serverquery_ban_time=600")}
+
+	// when
+	waits := []time.Duration{}
+	l, err := ratelimit.NewFromInstance(context.Background(), cq, ratelimit.Config{
+		OnWait: func(r libts.Request, wait time.Duration) {
+			waits = append(waits, wait)
+		},
+	})
+
+	// then
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		l.DoRaw(libts.Request{Command: "version"})
+	}
+	if len(waits) != 0 {
+		t.Errorf("Test %s failed!\n\tUnexpected waits: %v", t.Name(), waits)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	l.DoRawContext(ctx, libts.Request{Command: "version"})
+	if len(waits) != 1 || waits[0] <= 2*time.Second {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: a wait of about %s", t.Name(), waits, 3*time.Second)
+	}
+}
@@ -1,6 +1,7 @@
 package serverquery
 
 import (
+	"context"
 	"time"
 
 	"github.com/schoeppi5/libts"
@@ -9,36 +10,42 @@ import (
 
 // This file fullfills the libts.Query interface
 
+// defaultTimeout is used as read/write deadline, if the context of a request has none
+const defaultTimeout = 10 * time.Second
+
 // Do a command and attempt to parse the response in value
 func (sq *ServerQuery) Do(request libts.Request, value interface{}) error {
-	raw, err := sq.DoRaw(request)
-	if err != nil {
-		return err
-	}
-	return communication.UnmarshalResponse(communication.ConvertResponse(raw), value)
+	return sq.DoContext(context.Background(), request, value)
 }
 
 // DoRaw a command and return the raw response
 func (sq *ServerQuery) DoRaw(request libts.Request) ([]byte, error) {
-	if request.ServerID != 0 {
-		err := sq.use(request.ServerID)
-		if err != nil {
-			return nil, err
-		}
+	return sq.DoRawContext(context.Background(), request)
+}
+
+// DoContext a command and attempt to parse the response in value
+// The request is aborted once ctx is done
+func (sq *ServerQuery) DoContext(ctx context.Context, request libts.Request, value interface{}) error {
+	raw, err := sq.DoRawContext(ctx, request)
+	if err != nil {
+		return err
 	}
-	sq.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-	sq.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
-	defer func() {
-		sq.conn.SetReadDeadline(time.Time{})
-		sq.conn.SetWriteDeadline(time.Time{})
-	}()
-	return communication.Run(sq.in, sq.conn, []byte(request.String()))
+	return communication.Unmarshal(raw, value)
 }
 
-// Notification returns an io.Reader for arriving events
+// DoRawContext a command and return the raw response
+// While reconnecting, the request waits for the new connection
+// Requests are queued and sent one at a time, so a ServerQuery can be shared by many goroutines
+// The deadline of ctx is used as read/write deadline on the connection (10 seconds if ctx has none). Cancelling ctx while the request is running interrupts the connection
+func (sq *ServerQuery) DoRawContext(ctx context.Context, request libts.Request) ([]byte, error) {
+	return sq.session.Do(ctx, request)
+}
+
+// Notification returns a chan for arriving events
+// The chan stays open across reconnects
+// Dropped notifications and lost connections are reported by a communication.GapNotification line
 func (sq *ServerQuery) Notification() <-chan []byte {
-	sq.notify = make(chan []byte, 5)
-	return sq.notify
+	return sq.session.Notification()
 }
 
 // Connected sends the version command and returns the recieved error, if any
@@ -50,21 +57,7 @@ func (sq *ServerQuery) Connected() (bool, error) {
 	return err == nil, err
 }
 
-// use selects the virtual server for queries. Only changes the virtual server when needed
-func (sq *ServerQuery) use(sid int) error {
-	if sid == sq.serverID {
-		return nil
-	}
-	use := libts.Request{
-		Command: "use",
-		Args: map[string]interface{}{
-			"sid": sid,
-		},
-	}
-	_, err := sq.DoRaw(use)
-	if err != nil {
-		return err
-	}
-	sq.serverID = sid
-	return nil
+// ServerID returns the currently selected virtual server
+func (sq *ServerQuery) ServerID() int {
+	return sq.session.ServerID()
 }
@@ -1,6 +1,7 @@
 package serverquery
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"time"
@@ -15,90 +16,78 @@ type ServerQuery struct {
 	Port     int
 	Username string
 	Password string
-	conn     net.Conn
-	serverID int
-	in       chan []byte
-	notify   chan []byte
+	session  *communication.Session
+	options  communication.Options
+}
+
+// defaultOptions of a ServerQuery
+var defaultOptions = communication.Options{
+	DialTimeout:        10 * time.Second,
+	Timeout:            defaultTimeout,
+	KeepAlive:          120 * time.Second,
+	NotificationBuffer: 5,
 }
 
 // NewServerQuery establishes the tcp connection to teamspeak and logs the query in once connected
-func NewServerQuery(host string, port int, username string, password string) (*ServerQuery, error) {
-	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, fmt.Sprint(port)), 10*time.Second)
-	if err != nil {
-		return nil, err
-	}
-	err = conn.(*net.TCPConn).SetKeepAlive(true)
-	if err != nil {
-		return nil, err
-	}
-	err = conn.(*net.TCPConn).SetKeepAlivePeriod(120 * time.Second)
-	if err != nil {
-		return nil, err
-	}
-	in := make(chan []byte, 5)
-	sq := ServerQuery{
+// opts configure the connection (see communication.Options), e.g. communication.WithKeepAlive sets the interval of the tcp keepalive (default 120s),
+// communication.WithTimeout, communication.WithServerID or communication.WithReconnectPolicy
+func NewServerQuery(host string, port int, username string, password string, opts ...communication.Option) (*ServerQuery, error) {
+	return newServerQuery(context.Background(), host, port, username, password, opts...)
+}
+
+func newServerQuery(ctx context.Context, host string, port int, username string, password string, opts ...communication.Option) (*ServerQuery, error) {
+	sq := &ServerQuery{
 		Host:     host,
 		Port:     port,
 		Username: username,
 		Password: password,
-		in:       in,
-		conn:     conn,
-		notify:   nil,
+		options:  defaultOptions.Apply(opts...),
 	}
-	go communication.Read(conn, sq.in, sq.notify) // split the input from teamspeak into notifys and everything else
-	// slurp the header
-	err = communication.ReadHeader(in)
+	session, err := communication.NewSession(ctx, sq.dial, sq.options.Setup(sq.login), sq.options.Timeout, sq.options.NotificationBuffer)
 	if err != nil {
-		conn.Close()
 		return nil, err
 	}
-	sq.login(username, password)
-	return &sq, nil
+	session.SetReconnectPolicy(sq.options.ReconnectPolicy)
+	sq.session = session
+	return sq, nil
 }
 
-// Close the tcp connection
-func (sq *ServerQuery) Close() {
-	sq.logout()
-	sq.quit()
-	sq.conn.Close()
+// SetReconnectPolicy enables reconnecting once the connection is lost (nil disables it)
+// After a reconnect the query is logged in again, uses the previously selected virtual server and renews all event registrations
+func (sq *ServerQuery) SetReconnectPolicy(p *communication.ReconnectPolicy) {
+	sq.session.SetReconnectPolicy(p)
 }
 
-// Login to a useraccount
-func (sq *ServerQuery) login(username, password string) error {
-	login := libts.Request{
-		Command: "login",
-		Args: map[string]interface{}{
-			"client_login_name":     username,
-			"client_login_password": password,
+// Close the tcp connection
+func (sq *ServerQuery) Close() {
+	sq.session.Close(
+		libts.Request{
+			Command: "logout",
 		},
-	}
-	_, err := sq.DoRaw(login)
-	if err != nil {
-		return err
-	}
-	return nil
+		libts.Request{
+			Command: "quit",
+		},
+	)
 }
 
-// logout from server
-func (sq *ServerQuery) logout() error {
-	logout := libts.Request{
-		Command: "logout",
-	}
-	_, err := sq.DoRaw(logout)
+// dial the tcp connection to teamspeak
+func (sq *ServerQuery) dial(ctx context.Context) (*communication.Connection, error) {
+	conn, err := sq.options.DialContext(ctx, "tcp", net.JoinHostPort(sq.Host, fmt.Sprint(sq.Port)))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return communication.NewConnection(conn, conn, conn, sq.options.NotificationBuffer)
 }
 
-// quit connection
-func (sq *ServerQuery) quit() error {
-	quit := libts.Request{
-		Command: "quit",
-	}
-	_, err := sq.DoRaw(quit)
-	if err != nil {
-		return err
+// Login to a useraccount
+func (sq *ServerQuery) login(ctx context.Context, d *communication.Dispatcher) error {
+	login := libts.Request{
+		Command: "login",
+		Args: map[string]interface{}{
+			"client_login_name":     sq.Username,
+			"client_login_password": sq.Password,
+		},
 	}
-	return nil
+	_, err := d.Do(ctx, 0, []byte(login.String()))
+	return err
 }
@@ -0,0 +1,88 @@
+package sshquery
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// ErrHostKeyMismatch is returned, if the host key of teamspeak doesn't match the expected one
+var ErrHostKeyMismatch = errors.New("ssh: host key mismatch")
+
+// KnownHosts verifies the host key using OpenSSH known_hosts files
+func KnownHosts(files ...string) (ssh.HostKeyCallback, error) {
+	callback, err := knownhosts.New(files...)
+	if err != nil {
+		return nil, err
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		if e, ok := err.(*knownhosts.KeyError); ok && len(e.Want) > 0 {
+			return fmt.Errorf("%w: %v", ErrHostKeyMismatch, err)
+		}
+		return err
+	}, nil
+}
+
+// Fingerprint accepts only host keys matching one of fingerprints
+// Fingerprints are expected in the format of ssh-keygen -l (SHA256:... or the legacy MD5 aa:bb:...)
+func Fingerprint(fingerprints ...string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		sha, md5 := ssh.FingerprintSHA256(key), ssh.FingerprintLegacyMD5(key)
+		for _, f := range fingerprints {
+			if f == sha || f == md5 {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %s presented %s", ErrHostKeyMismatch, hostname, sha)
+	}
+}
+
+// TrustOnFirstUse accepts the host key of unknown hosts and stores it in file (known_hosts format)
+// Known hosts have to present the stored key
+func TrustOnFirstUse(file string) ssh.HostKeyCallback {
+	lock := sync.Mutex{} // serializes reading and writing file
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		lock.Lock()
+		defer lock.Unlock()
+		callback, err := knownhosts.New(file)
+		if os.IsNotExist(err) {
+			return trust(file, hostname, remote, key)
+		}
+		if err != nil {
+			return err
+		}
+		err = callback(hostname, remote, key)
+		e, ok := err.(*knownhosts.KeyError)
+		if !ok {
+			return err
+		}
+		if len(e.Want) > 0 {
+			return fmt.Errorf("%w: %v", ErrHostKeyMismatch, err)
+		}
+		return trust(file, hostname, remote, key)
+	}
+}
+
+// trust appends key to file
+func trust(file, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	addresses := []string{knownhosts.Normalize(hostname)}
+	if r := knownhosts.Normalize(remote.String()); r != addresses[0] {
+		addresses = append(addresses, r)
+	}
+	_, err = fmt.Fprintln(f, knownhosts.Line(addresses, key))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
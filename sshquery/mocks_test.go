@@ -0,0 +1,116 @@
+package sshquery_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sshServer is an in-process ssh server answering every command with "error id=0 msg=ok"
+type sshServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	hostKey  ssh.Signer
+	host     string
+	port     int
+}
+
+// newSSHServer starts a server accepting password secret and the public key of client (if not nil)
+func newSSHServer(t *testing.T, client ssh.PublicKey) *sshServer {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("wrong password for %s", c.User())
+		},
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if client != nil && bytes.Equal(key.Marshal(), client.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown public key for %s", c.User())
+		},
+	}
+	config.AddHostKey(hostKey)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	s := &sshServer{
+		listener: listener,
+		config:   config,
+		hostKey:  hostKey,
+		host:     host,
+	}
+	s.port, _ = strconv.Atoi(port)
+	go s.serve()
+	t.Cleanup(func() {
+		listener.Close()
+	})
+	return s
+}
+
+func (s *sshServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *sshServer) handle(conn net.Conn) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for c := range chans {
+		if c.ChannelType() != "session" {
+			c.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := c.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for r := range requests {
+				r.Reply(r.Type == "shell", nil)
+			}
+		}()
+		go query(channel)
+	}
+}
+
+// query acts like the teamspeak query shell
+func query(channel ssh.Channel) {
+	defer channel.Close()
+	fmt.Fprint(channel, "TS3\n\rWelcome to the fake TeamSpeak 3 ServerQuery interface\n\r")
+	reader := bufio.NewReader(channel)
+	for {
+		_, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fmt.Fprint(channel, "error id=0 msg=ok\n\r")
+	}
+}
@@ -1,34 +1,45 @@
 package sshquery
 
 import (
+	"context"
+
 	"github.com/schoeppi5/libts"
 	"github.com/schoeppi5/libts/communication"
 )
 
 // Do tries to unmarshal the response from teamspeak to value
 func (sq *SSHQuery) Do(request libts.Request, value interface{}) error {
-	raw, err := sq.DoRaw(request)
-	if err != nil {
-		return err
-	}
-	return communication.UnmarshalResponse(communication.ConvertResponse(raw), value)
+	return sq.DoContext(context.Background(), request, value)
 }
 
 // DoRaw returns the raw response from teamspeak
 func (sq *SSHQuery) DoRaw(request libts.Request) ([]byte, error) {
-	if request.ServerID != 0 {
-		err := sq.Use(request.ServerID)
-		if err != nil {
-			return nil, err
-		}
+	return sq.DoRawContext(context.Background(), request)
+}
+
+// DoContext tries to unmarshal the response from teamspeak to value
+// The request is aborted once ctx is done
+func (sq *SSHQuery) DoContext(ctx context.Context, request libts.Request, value interface{}) error {
+	raw, err := sq.DoRawContext(ctx, request)
+	if err != nil {
+		return err
 	}
-	return communication.Run(sq.in, sq.out, []byte(request.String()))
+	return communication.Unmarshal(raw, value)
 }
 
-// Notification returns an io.Reader for arriving events
+// DoRawContext returns the raw response from teamspeak
+// While reconnecting, the request waits for the new connection
+// Requests are queued and sent one at a time, so a SSHQuery can be shared by many goroutines
+// The deadline of ctx is used as read/write deadline on the underlying tcp connection. Cancelling ctx while the request is running interrupts the connection
+func (sq *SSHQuery) DoRawContext(ctx context.Context, request libts.Request) ([]byte, error) {
+	return sq.session.Do(ctx, request)
+}
+
+// Notification returns a chan for arriving events
+// The chan stays open across reconnects
+// Dropped notifications and lost connections are reported by a communication.GapNotification line
 func (sq *SSHQuery) Notification() <-chan []byte {
-	sq.notify = make(chan []byte, 5)
-	return sq.notify
+	return sq.session.Notification()
 }
 
 // Connected sends the version command and returns the recieved error, if any
@@ -42,19 +53,10 @@ func (sq *SSHQuery) Connected() (bool, error) {
 
 // Use selects a virtual server for the client
 func (sq *SSHQuery) Use(sid int) error {
-	if sid == sq.serverID {
-		return nil
-	}
-	use := libts.Request{
-		Command: "use",
-		Args: map[string]interface{}{
-			"sid": sid,
-		},
-	}
-	_, err := sq.DoRaw(use)
-	if err != nil {
-		return err
-	}
-	sq.serverID = sid
-	return nil
+	return sq.session.Use(context.Background(), sid)
+}
+
+// ServerID returns the currently selected virtual server
+func (sq *SSHQuery) ServerID() int {
+	return sq.session.ServerID()
 }
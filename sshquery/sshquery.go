@@ -1,6 +1,8 @@
 package sshquery
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -18,27 +20,136 @@ type SSHQuery struct {
 	Port     int
 	Username string
 	Password string
-	serverID int
-	conn     *ssh.Client
-	out      io.Writer
-	in       chan []byte
-	notify   chan []byte
+	session  *communication.Session
+
+	auth            []ssh.AuthMethod
+	hostKeyCallback ssh.HostKeyCallback
+	options         communication.Options
+}
+
+// defaultOptions of a SSHQuery
+var defaultOptions = communication.Options{
+	DialTimeout:        10 * time.Second,
+	KeepAlive:          200 * time.Second,
+	NotificationBuffer: 5,
+}
+
+// Options for NewSSHQueryWithOptions
+type Options struct {
+	Host     string
+	Port     int
+	Username string
+	// Password is used for authentication, if Auth is empty
+	Password string
+	// Auth methods offered to teamspeak, e.g. ssh.PublicKeys(signer)
+	Auth []ssh.AuthMethod
+	// HostKeyCallback verifies the host key of teamspeak - required
+	// See KnownHosts, Fingerprint and TrustOnFirstUse
+	HostKeyCallback ssh.HostKeyCallback
+}
+
+// sessionWriter writes to the ssh session, but sets deadlines on the underlying tcp connection
+type sessionWriter struct {
+	io.Writer
+	tcp net.Conn
+}
+
+// SetDeadline fullfills the communication.Deadliner interface
+func (sw sessionWriter) SetDeadline(t time.Time) error {
+	return sw.tcp.SetDeadline(t)
 }
 
 // NewSSHQuery opens a new ssh connection to the host and starts a session for communicating with teamspeak
-func NewSSHQuery(host string, port int, username, password string) (*SSHQuery, error) {
+// The host key is not verified, use NewSSHQueryWithOptions for that
+func NewSSHQuery(host string, port int, username, password string, opts ...communication.Option) (*SSHQuery, error) {
+	return NewSSHQueryWithOptions(Options{
+		Host:            host,
+		Port:            port,
+		Username:        username,
+		Password:        password,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}, opts...)
+}
+
+// NewSSHQueryWithOptions opens a new ssh connection as configured in o and starts a session for communicating with teamspeak
+// opts configure the session (see communication.Options), e.g. communication.WithKeepAlive sets the interval of the keepalive commands (default 200s),
+// communication.WithTimeout, communication.WithServerID or communication.WithReconnectPolicy
+func NewSSHQueryWithOptions(o Options, opts ...communication.Option) (*SSHQuery, error) {
+	return newSSHQuery(context.Background(), o, opts...)
+}
+
+func newSSHQuery(ctx context.Context, o Options, opts ...communication.Option) (*SSHQuery, error) {
+	if o.HostKeyCallback == nil {
+		return nil, errors.New("sshquery needs a HostKeyCallback")
+	}
+	sshq := &SSHQuery{
+		Host:            o.Host,
+		Port:            o.Port,
+		Username:        o.Username,
+		Password:        o.Password,
+		auth:            o.Auth,
+		hostKeyCallback: o.HostKeyCallback,
+		options:         defaultOptions.Apply(opts...),
+	}
+	session, err := communication.NewSession(ctx, sshq.dial, sshq.options.Setup(nil), sshq.options.Timeout, sshq.options.NotificationBuffer)
+	if err != nil {
+		return nil, err
+	}
+	session.SetReconnectPolicy(sshq.options.ReconnectPolicy)
+	sshq.session = session
+	return sshq, nil
+}
+
+// SetReconnectPolicy enables reconnecting once the connection is lost (nil disables it)
+// After a reconnect the query uses the previously selected virtual server and renews all event registrations
+func (sq *SSHQuery) SetReconnectPolicy(p *communication.ReconnectPolicy) {
+	sq.session.SetReconnectPolicy(p)
+}
+
+// Close the ssh connection to teamspeak
+func (sq *SSHQuery) Close() {
+	sq.session.Close(
+		libts.Request{
+			Command: "logout",
+		},
+		libts.Request{
+			Command: "quit",
+		},
+	)
+}
+
+// dial opens the ssh connection and starts a shell on it
+func (sq *SSHQuery) dial(ctx context.Context) (*communication.Connection, error) {
+	auth := sq.auth
+	if len(auth) == 0 {
+		auth = []ssh.AuthMethod{
+			ssh.Password(sq.Password),
+		}
+	}
+	var hostKeyErr error
 	config := &ssh.ClientConfig{ // configure ssh connection
-		User: username,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(password),
+		User:    sq.Username,
+		Auth:    auth,
+		Timeout: sq.options.DialTimeout,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKeyErr = sq.hostKeyCallback(hostname, remote, key) // ssh only keeps the message of the error
+			return hostKeyErr
 		},
-		Timeout:         10 * time.Second,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // TODO: maybe change this to knownhosts
 	}
-	conn, err := ssh.Dial("tcp", net.JoinHostPort(host, fmt.Sprint(port)), config)
+	addr := net.JoinHostPort(sq.Host, fmt.Sprint(sq.Port))
+	tcp, err := sq.options.DialContext(ctx, "tcp", addr) // dial manually to be able to set deadlines
 	if err != nil {
 		return nil, err
 	}
+	c, chans, reqs, err := ssh.NewClientConn(tcp, addr, config)
+	if err != nil {
+		tcp.Close()
+		if hostKeyErr != nil {
+			return nil, hostKeyErr
+		}
+		return nil, err
+	}
+	conn := ssh.NewClient(c, chans, reqs)
 	session, err := conn.NewSession()
 	if err != nil {
 		conn.Close()
@@ -58,52 +169,10 @@ func NewSSHQuery(host string, port int, username, password string) (*SSHQuery, e
 		conn.Close()
 		return nil, err
 	}
-	in := make(chan []byte, 5)
-	sshq := &SSHQuery{
-		Host:     host,
-		Port:     port,
-		Username: username,
-		Password: password,
-		conn:     conn,
-		in:       in,
-		out:      out,
-		notify:   nil,
-	}
-	go communication.Read(input, sshq.in, sshq.notify) // split the input from teamspeak into notifys and everything else
-	err = communication.ReadHeader(in)                 // slurp header
+	connection, err := communication.NewConnection(input, sessionWriter{Writer: out, tcp: tcp}, conn, sq.options.NotificationBuffer)
 	if err != nil {
-		conn.Close()
 		return nil, err
 	}
-	go communication.KeepAlive(out, 200*time.Second) // keepAlive
-	return sshq, nil
-}
-
-// Close the ssh connection to teamspeak
-func (sq *SSHQuery) Close() {
-	sq.logout()
-	sq.quit()
-}
-
-// logout from server
-func (sq *SSHQuery) logout() error {
-	logout := libts.Request{
-		Command: "logout",
-	}
-	_, err := sq.DoRaw(logout)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func (sq *SSHQuery) quit() error {
-	quit := libts.Request{
-		Command: "quit",
-	}
-	_, err := sq.DoRaw(quit)
-	if err != nil {
-		return err
-	}
-	return nil
+	connection.KeepAlive = sq.options.KeepAlive // written by the dispatcher, so it doesn't interfere with requests
+	return connection, nil
 }
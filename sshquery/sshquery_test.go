@@ -0,0 +1,200 @@
+package sshquery_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/sshquery"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func connect(s *sshServer, callback ssh.HostKeyCallback, auth ...ssh.AuthMethod) error {
+	q, err := sshquery.NewSSHQueryWithOptions(sshquery.Options{
+		Host:            s.host,
+		Port:            s.port,
+		Username:        "serveradmin",
+		Password:        "secret",
+		Auth:            auth,
+		HostKeyCallback: callback,
+	})
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Connected()
+	return err
+}
+
+func TestNewSSHQueryWithOptionsRequiresHostKeyCallback(t *testing.T) {
+	t.Parallel()
+	// given
+	s := newSSHServer(t, nil)
+
+	// when
+	err := connect(s, nil)
+
+	// then
+	if err == nil {
+		t.Errorf("Test %s failed!\n\tExpected an error without HostKeyCallback", t.Name())
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	t.Parallel()
+	// given
+	s := newSSHServer(t, nil)
+	tests := []struct {
+		name        string
+		fingerprint string
+		mismatch    bool
+	}{
+		{"SHA256", ssh.FingerprintSHA256(s.hostKey.PublicKey()), false},
+		{"MD5", ssh.FingerprintLegacyMD5(s.hostKey.PublicKey()), false},
+		{"wrong", "SHA256:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA", true},
+	}
+
+	for _, test := range tests {
+		// when
+		err := connect(s, sshquery.Fingerprint(test.fingerprint))
+
+		// then
+		if test.mismatch != errors.Is(err, sshquery.ErrHostKeyMismatch) || (!test.mismatch && err != nil) {
+			t.Errorf("Test %s/%s failed!\n\tHave: %v\n\tWant mismatch: %t", t.Name(), test.name, err, test.mismatch)
+		}
+	}
+}
+
+func TestKnownHosts(t *testing.T) {
+	t.Parallel()
+	// given
+	s := newSSHServer(t, nil)
+	other := newSSHServer(t, nil)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(net.JoinHostPort(s.host, fmt.Sprint(s.port)))}, s.hostKey.PublicKey())
+	err := ioutil.WriteFile(file, []byte(line+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback, err := sshquery.KnownHosts(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// when
+	known := connect(s, callback)
+	unknown := connect(other, callback)
+
+	// then
+	if known != nil {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), known, nil)
+	}
+	if unknown == nil || errors.Is(unknown, sshquery.ErrHostKeyMismatch) {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: unknown host error", t.Name(), unknown)
+	}
+}
+
+func TestTrustOnFirstUse(t *testing.T) {
+	t.Parallel()
+	// given
+	s := newSSHServer(t, nil)
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	callback := sshquery.TrustOnFirstUse(file)
+
+	// when
+	first := connect(s, callback)
+	second := connect(s, callback)
+	s.hostKey = newSSHServer(t, nil).hostKey // the server changes its key
+	s.config.AddHostKey(s.hostKey)
+	changed := connect(s, callback)
+
+	// then
+	if first != nil {
+		t.Errorf("Test %s failed!\n\tFirst connection: %v", t.Name(), first)
+	}
+	if second != nil {
+		t.Errorf("Test %s failed!\n\tSecond connection: %v", t.Name(), second)
+	}
+	if !errors.Is(changed, sshquery.ErrHostKeyMismatch) {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), changed, sshquery.ErrHostKeyMismatch)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("Test %s failed!\n\tknown_hosts not written: %v", t.Name(), err)
+	}
+}
+
+func TestPublicKeyAuth(t *testing.T) {
+	t.Parallel()
+	// given
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newSSHServer(t, signer.PublicKey())
+	callback := sshquery.Fingerprint(ssh.FingerprintSHA256(s.hostKey.PublicKey()))
+
+	// when
+	err = connect(s, callback, ssh.PublicKeys(signer))
+
+	// then
+	if err != nil {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), err, nil)
+	}
+}
+
+func TestPasswordAuthFails(t *testing.T) {
+	t.Parallel()
+	// given
+	s := newSSHServer(t, nil)
+	callback := sshquery.Fingerprint(ssh.FingerprintSHA256(s.hostKey.PublicKey()))
+
+	// when
+	err := connect(s, callback, ssh.Password("wrong"))
+
+	// then
+	if err == nil {
+		t.Errorf("Test %s failed!\n\tExpected authentication to fail", t.Name())
+	}
+}
+
+func TestDial(t *testing.T) {
+	t.Parallel()
+	// given
+	s := newSSHServer(t, nil)
+	u := url.URL{
+		Scheme: "ts3ssh",
+		User:   url.UserPassword("serveradmin", "secret"),
+		Host:   net.JoinHostPort(s.host, fmt.Sprint(s.port)),
+		RawQuery: url.Values{
+			"fingerprint": []string{ssh.FingerprintSHA256(s.hostKey.PublicKey())},
+		}.Encode(),
+	}
+
+	// when
+	q, err := libts.Dial(context.Background(), u.String())
+
+	// then
+	if err != nil {
+		t.Fatalf("Test %s failed!\n\tUnexpected error: %s", t.Name(), err)
+	}
+	defer q.(*sshquery.SSHQuery).Close()
+	if ok, err := q.Connected(); !ok {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), err, nil)
+	}
+}
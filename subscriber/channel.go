@@ -4,181 +4,127 @@ import "github.com/schoeppi5/libts"
 
 // ChannelCreated subscribes to the ChannelCreated events for all channels
 // events recieved on the channel will always be of type ChannelCreatedEvent
-func (a Agent) ChannelCreated(c chan interface{}) error {
+func (a Agent) ChannelCreated(c chan interface{}) (libts.SubscriptionID, error) {
 	s := libts.Subscription{
+		ServerID:  a.serverID,
 		Name:      Channel,
 		ChannelID: 0,
 		Events: map[string]libts.Event{
-			ChannelCreated: {
-				Template: &ChannelCreatedEvent{},
-				C:        c,
-			},
+			ChannelCreated: a.event(&ChannelCreatedEvent{}, c),
 		},
 	}
-	err := a.Subscriber.Subscribe(s)
-	if err != nil {
-		return err
-	}
-	return nil
+	return a.Subscriber.SubscribeContext(a.Context(), s)
 }
 
 // ChannelDeleted subscribes to the ChannelDeleted events for channel cid (0 for all)
 // events recieved on the channel will always be of type ChannelDeletedEvent
-func (a Agent) ChannelDeleted(c chan interface{}, cid int) error {
+func (a Agent) ChannelDeleted(c chan interface{}, cid int) (libts.SubscriptionID, error) {
 	s := libts.Subscription{
+		ServerID:  a.serverID,
 		Name:      Channel,
 		ChannelID: cid,
 		Events: map[string]libts.Event{
-			ChannelDeleted: {
-				Template: &ChannelDeletedEvent{},
-				C:        c,
-			},
+			ChannelDeleted: a.event(&ChannelDeletedEvent{}, c),
 		},
 	}
-	err := a.Subscriber.Subscribe(s)
-	if err != nil {
-		return err
-	}
-	return nil
+	return a.Subscriber.SubscribeContext(a.Context(), s)
 }
 
 // ChannelMoved subscribes to the ChannelMoved events for channel cid (0 for all)
 // events recieved on the channel will always be of type ChannelMovedEvent
-func (a Agent) ChannelMoved(c chan interface{}, cid int) error {
+func (a Agent) ChannelMoved(c chan interface{}, cid int) (libts.SubscriptionID, error) {
 	s := libts.Subscription{
+		ServerID:  a.serverID,
 		Name:      Channel,
 		ChannelID: cid,
 		Events: map[string]libts.Event{
-			ChannelMoved: {
-				Template: &ChannelMovedEvent{},
-				C:        c,
-			},
+			ChannelMoved: a.event(&ChannelMovedEvent{}, c),
 		},
 	}
-	err := a.Subscriber.Subscribe(s)
-	if err != nil {
-		return err
-	}
-	return nil
+	return a.Subscriber.SubscribeContext(a.Context(), s)
 }
 
 // ChannelEdited subscribes to the ChannelEdited events for channel cid (0 for all)
 // events recieved on the channel will always be of type ChannelEditedEvent
-func (a Agent) ChannelEdited(c chan interface{}, cid int) error {
+func (a Agent) ChannelEdited(c chan interface{}, cid int) (libts.SubscriptionID, error) {
 	s := libts.Subscription{
+		ServerID:  a.serverID,
 		Name:      Channel,
 		ChannelID: cid,
 		Events: map[string]libts.Event{
-			ChannelEdited: {
-				Template: &ChannelEditedEvent{},
-				C:        c,
-			},
+			ChannelEdited: a.event(&ChannelEditedEvent{}, c),
 		},
 	}
-	err := a.Subscriber.Subscribe(s)
-	if err != nil {
-		return err
-	}
-	return nil
+	return a.Subscriber.SubscribeContext(a.Context(), s)
 }
 
 // ChannelDescriptionChanged subscribes to the ChannelDescriptionChanged events for channel cid (0 for all)
 // events recieved on the channel will always be of type ChannelDescriptionChangedEvent
-func (a Agent) ChannelDescriptionChanged(c chan interface{}, cid int) error {
+func (a Agent) ChannelDescriptionChanged(c chan interface{}, cid int) (libts.SubscriptionID, error) {
 	s := libts.Subscription{
+		ServerID:  a.serverID,
 		Name:      Channel,
 		ChannelID: cid,
 		Events: map[string]libts.Event{
-			ChannelDescriptionChanged: {
-				Template: &ChannelDescriptionChangedEvent{},
-				C:        c,
-			},
+			ChannelDescriptionChanged: a.event(&ChannelDescriptionChangedEvent{}, c),
 		},
 	}
-	err := a.Subscriber.Subscribe(s)
-	if err != nil {
-		return err
-	}
-	return nil
+	return a.Subscriber.SubscribeContext(a.Context(), s)
 }
 
 // ChannelPasswordChanged subscribes to the ChannelPasswordChanged events for channel cid (0 for all)
 // events recieved on the channel will always be of type ChannelPasswordChangedEvent
 // Is only omited when password is addded/removed not when actually changed
-func (a Agent) ChannelPasswordChanged(c chan interface{}, cid int) error {
+func (a Agent) ChannelPasswordChanged(c chan interface{}, cid int) (libts.SubscriptionID, error) {
 	s := libts.Subscription{
+		ServerID:  a.serverID,
 		Name:      Channel,
 		ChannelID: cid,
 		Events: map[string]libts.Event{
-			ChannelPasswordChanged: {
-				Template: &ChannelPasswordChangedEvent{},
-				C:        c,
-			},
+			ChannelPasswordChanged: a.event(&ChannelPasswordChangedEvent{}, c),
 		},
 	}
-	err := a.Subscriber.Subscribe(s)
-	if err != nil {
-		return err
-	}
-	return nil
+	return a.Subscriber.SubscribeContext(a.Context(), s)
 }
 
 // ClientMoved subscribes to the ClientMoved events for channel cid (0 for all)
 // events recieved on the channel will always be of type ClientMovedEvent
-func (a Agent) ClientMoved(c chan interface{}, cid int) error {
+func (a Agent) ClientMoved(c chan interface{}, cid int) (libts.SubscriptionID, error) {
 	s := libts.Subscription{
+		ServerID:  a.serverID,
 		Name:      Channel,
 		ChannelID: cid,
 		Events: map[string]libts.Event{
-			ClientMoved: {
-				Template: &ClientMovedEvent{},
-				C:        c,
-			},
+			ClientMoved: a.event(&ClientMovedEvent{}, c),
 		},
 	}
-	err := a.Subscriber.Subscribe(s)
-	if err != nil {
-		return err
-	}
-	return nil
+	return a.Subscriber.SubscribeContext(a.Context(), s)
 }
 
 // ClientJoinedChannel subscribes to the ClientEnterView events for channel cid (0 for all)
 // events recieved on the channel will always be of type ClientEnterViewEvent
-func (a Agent) ClientJoinedChannel(c chan interface{}, cid int) error {
+func (a Agent) ClientJoinedChannel(c chan interface{}, cid int) (libts.SubscriptionID, error) {
 	s := libts.Subscription{
+		ServerID:  a.serverID,
 		Name:      Channel,
 		ChannelID: cid,
 		Events: map[string]libts.Event{
-			ClientEnterView: {
-				Template: &ClientEnterViewEvent{},
-				C:        c,
-			},
+			ClientEnterView: a.event(&ClientEnterViewEvent{}, c),
 		},
 	}
-	err := a.Subscriber.Subscribe(s)
-	if err != nil {
-		return err
-	}
-	return nil
+	return a.Subscriber.SubscribeContext(a.Context(), s)
 }
 
 // ClientLeftChannel subscribes to the ClientLeftView events for channel cid (0 for all)
 // events recieved on the channel will always be of type ClientLeftViewEvent
-func (a Agent) ClientLeftChannel(c chan interface{}, cid int) error {
+func (a Agent) ClientLeftChannel(c chan interface{}, cid int) (libts.SubscriptionID, error) {
 	s := libts.Subscription{
+		ServerID:  a.serverID,
 		Name:      Channel,
 		ChannelID: cid,
 		Events: map[string]libts.Event{
-			ClientLeftView: {
-				Template: &ClientLeftViewEvent{},
-				C:        c,
-			},
+			ClientLeftView: a.event(&ClientLeftViewEvent{}, c),
 		},
 	}
-	err := a.Subscriber.Subscribe(s)
-	if err != nil {
-		return err
-	}
-	return nil
+	return a.Subscriber.SubscribeContext(a.Context(), s)
 }
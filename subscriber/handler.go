@@ -0,0 +1,334 @@
+package subscriber
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/schoeppi5/libts"
+)
+
+// Dispatch decides how the handlers of Handlers are called
+type Dispatch int
+
+const (
+	// Inline calls the handlers of a subscription one after another, in the order of the events
+	Inline Dispatch = iota
+	// Goroutine calls every handler in its own goroutine
+	Goroutine
+	// Pool calls the handlers using a fixed number of workers (see WithWorkerPool)
+	Pool
+)
+
+// eventBuffer is the buffer of the channel of every subscription
+const eventBuffer = 16
+
+// ErrHandlersClosed is returned when subscribing using closed Handlers
+var ErrHandlersClosed = errors.New("handlers closed")
+
+// HandlerOption configures Handlers
+type HandlerOption func(h *Handlers)
+
+// WithInlineDispatch calls the handlers of a subscription one after another (default)
+func WithInlineDispatch() HandlerOption {
+	return func(h *Handlers) {
+		h.dispatch = Inline
+	}
+}
+
+// WithGoroutineDispatch calls every handler in its own goroutine
+func WithGoroutineDispatch() HandlerOption {
+	return func(h *Handlers) {
+		h.dispatch = Goroutine
+	}
+}
+
+// WithWorkerPool calls the handlers using n workers
+// Events wait for a free worker, so at most n handlers run at the same time
+func WithWorkerPool(n int) HandlerOption {
+	if n < 1 {
+		panic("worker pool without workers")
+	}
+	return func(h *Handlers) {
+		h.dispatch = Pool
+		h.size = n
+	}
+}
+
+// Handlers calls typed functions for the events of an Agent instead of sending them to a channel
+// A handler, which panics, is recovered and the panic is passed to the error handler (see OnError)
+type Handlers struct {
+	agent     Agent
+	dispatch  Dispatch
+	size      int // workers of the pool
+	jobs      chan func()
+	lock      sync.Mutex
+	onError   func(error)
+	onGap     func(libts.Gap)
+	ids       []libts.SubscriptionID
+	done      chan struct{}
+	closed    bool
+	receivers sync.WaitGroup // one per subscription
+	workers   sync.WaitGroup // worker pool
+	inflight  sync.WaitGroup // handlers currently called
+}
+
+// NewHandlers returns Handlers subscribing using a
+func NewHandlers(a Agent, opts ...HandlerOption) *Handlers {
+	h := &Handlers{
+		agent: a,
+		done:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.dispatch == Pool {
+		h.jobs = make(chan func())
+		for i := 0; i < h.size; i++ {
+			h.workers.Add(1)
+			go h.work()
+		}
+	}
+	return h
+}
+
+// OnError calls f for events, which failed to decode, and for panicking handlers
+// Without error handler, these errors are dropped
+func (h *Handlers) OnError(f func(error)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.onError = f
+}
+
+// OnGap calls f, once events were missed (see libts.Gap)
+// Without gap handler, gaps are ignored
+func (h *Handlers) OnGap(f func(libts.Gap)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.onGap = f
+}
+
+// Close unsubscribes all subscriptions of h and waits for the running handlers to return
+// The first error of unsubscribing is returned
+// Close must not be called from a handler, as it would wait for that handler and never return. Use go h.Close() there instead
+func (h *Handlers) Close() error {
+	h.lock.Lock()
+	if h.closed {
+		h.lock.Unlock()
+		return nil
+	}
+	h.closed = true
+	ids := h.ids
+	h.ids = nil
+	h.lock.Unlock()
+	var err error
+	for _, id := range ids {
+		if e := h.agent.Unsubscribe(id); e != nil && err == nil {
+			err = e
+		}
+	}
+	close(h.done)
+	h.receivers.Wait()
+	if h.jobs != nil {
+		close(h.jobs)
+		h.workers.Wait()
+	}
+	h.inflight.Wait()
+	return err
+}
+
+// handle subscribes using subscribe and passes every event to call
+func (h *Handlers) handle(subscribe func(c chan interface{}) (libts.SubscriptionID, error), call func(event interface{})) (libts.SubscriptionID, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.closed {
+		return 0, ErrHandlersClosed
+	}
+	c := make(chan interface{}, eventBuffer)
+	id, err := subscribe(c)
+	if err != nil {
+		return 0, err
+	}
+	h.ids = append(h.ids, id)
+	h.receivers.Add(1)
+	go h.receive(c, call)
+	return id, nil
+}
+
+// receive dispatches the events of c until h is closed
+func (h *Handlers) receive(c <-chan interface{}, call func(event interface{})) {
+	defer h.receivers.Done()
+	for {
+		select {
+		case e, open := <-c:
+			if !open {
+				return
+			}
+			h.event(e, call)
+		case <-h.done:
+			for { // the events sent while unsubscribing
+				select {
+				case e, open := <-c:
+					if !open {
+						return
+					}
+					h.event(e, call)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// event dispatches e to call, the error handler if e is an error, or the gap handler if e is a gap
+func (h *Handlers) event(e interface{}, call func(event interface{})) {
+	switch e := e.(type) {
+	case error:
+		h.run(func() { h.fail(e) })
+	case libts.Gap:
+		h.lock.Lock()
+		f := h.onGap
+		h.lock.Unlock()
+		if f != nil {
+			h.run(func() { f(e) })
+		}
+	default:
+		h.run(func() { call(e) })
+	}
+}
+
+// run calls f according to the dispatch of h
+func (h *Handlers) run(f func()) {
+	h.inflight.Add(1)
+	switch h.dispatch {
+	case Goroutine:
+		go h.call(f)
+	case Pool:
+		h.jobs <- f
+	default:
+		h.call(f)
+	}
+}
+
+// work calls the jobs of the worker pool
+func (h *Handlers) work() {
+	defer h.workers.Done()
+	for f := range h.jobs {
+		h.call(f)
+	}
+}
+
+// call calls f and recovers it from panicking
+func (h *Handlers) call(f func()) {
+	defer h.inflight.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			h.fail(fmt.Errorf("handler panicked: %v", r))
+		}
+	}()
+	f()
+}
+
+// fail passes err to the error handler
+// A panicking error handler is recovered and its panic dropped
+func (h *Handlers) fail(err error) {
+	h.lock.Lock()
+	f := h.onError
+	h.lock.Unlock()
+	if f == nil {
+		return
+	}
+	defer func() {
+		recover()
+	}()
+	f(err)
+}
+
+// OnServerEdited calls f for every ServerEdited event
+func (h *Handlers) OnServerEdited(f func(ServerEditedEvent)) (libts.SubscriptionID, error) {
+	return h.handle(h.agent.ServerEdited, func(e interface{}) { f(*e.(*ServerEditedEvent)) })
+}
+
+// OnClientJoinedServer calls f for every ClientEnterView event on server level
+func (h *Handlers) OnClientJoinedServer(f func(ClientEnterViewEvent)) (libts.SubscriptionID, error) {
+	return h.handle(h.agent.ClientJoinedServer, func(e interface{}) { f(*e.(*ClientEnterViewEvent)) })
+}
+
+// OnClientLeftServer calls f for every ClientLeftView event on server level
+func (h *Handlers) OnClientLeftServer(f func(ClientLeftViewEvent)) (libts.SubscriptionID, error) {
+	return h.handle(h.agent.ClientLeftServer, func(e interface{}) { f(*e.(*ClientLeftViewEvent)) })
+}
+
+// OnChannelCreated calls f for every ChannelCreated event
+func (h *Handlers) OnChannelCreated(f func(ChannelCreatedEvent)) (libts.SubscriptionID, error) {
+	return h.handle(h.agent.ChannelCreated, func(e interface{}) { f(*e.(*ChannelCreatedEvent)) })
+}
+
+// OnChannelDeleted calls f for every ChannelDeleted event of channel cid (0 for all)
+func (h *Handlers) OnChannelDeleted(f func(ChannelDeletedEvent), cid int) (libts.SubscriptionID, error) {
+	return h.handle(func(c chan interface{}) (libts.SubscriptionID, error) {
+		return h.agent.ChannelDeleted(c, cid)
+	}, func(e interface{}) { f(*e.(*ChannelDeletedEvent)) })
+}
+
+// OnChannelMoved calls f for every ChannelMoved event of channel cid (0 for all)
+func (h *Handlers) OnChannelMoved(f func(ChannelMovedEvent), cid int) (libts.SubscriptionID, error) {
+	return h.handle(func(c chan interface{}) (libts.SubscriptionID, error) {
+		return h.agent.ChannelMoved(c, cid)
+	}, func(e interface{}) { f(*e.(*ChannelMovedEvent)) })
+}
+
+// OnChannelEdited calls f for every ChannelEdited event of channel cid (0 for all)
+func (h *Handlers) OnChannelEdited(f func(ChannelEditedEvent), cid int) (libts.SubscriptionID, error) {
+	return h.handle(func(c chan interface{}) (libts.SubscriptionID, error) {
+		return h.agent.ChannelEdited(c, cid)
+	}, func(e interface{}) { f(*e.(*ChannelEditedEvent)) })
+}
+
+// OnChannelDescriptionChanged calls f for every ChannelDescriptionChanged event of channel cid (0 for all)
+func (h *Handlers) OnChannelDescriptionChanged(f func(ChannelDescriptionChangedEvent), cid int) (libts.SubscriptionID, error) {
+	return h.handle(func(c chan interface{}) (libts.SubscriptionID, error) {
+		return h.agent.ChannelDescriptionChanged(c, cid)
+	}, func(e interface{}) { f(*e.(*ChannelDescriptionChangedEvent)) })
+}
+
+// OnChannelPasswordChanged calls f for every ChannelPasswordChanged event of channel cid (0 for all)
+func (h *Handlers) OnChannelPasswordChanged(f func(ChannelPasswordChangedEvent), cid int) (libts.SubscriptionID, error) {
+	return h.handle(func(c chan interface{}) (libts.SubscriptionID, error) {
+		return h.agent.ChannelPasswordChanged(c, cid)
+	}, func(e interface{}) { f(*e.(*ChannelPasswordChangedEvent)) })
+}
+
+// OnClientMoved calls f for every ClientMoved event of channel cid (0 for all)
+func (h *Handlers) OnClientMoved(f func(ClientMovedEvent), cid int) (libts.SubscriptionID, error) {
+	return h.handle(func(c chan interface{}) (libts.SubscriptionID, error) {
+		return h.agent.ClientMoved(c, cid)
+	}, func(e interface{}) { f(*e.(*ClientMovedEvent)) })
+}
+
+// OnClientJoinedChannel calls f for every ClientEnterView event of channel cid (0 for all)
+func (h *Handlers) OnClientJoinedChannel(f func(ClientEnterViewEvent), cid int) (libts.SubscriptionID, error) {
+	return h.handle(func(c chan interface{}) (libts.SubscriptionID, error) {
+		return h.agent.ClientJoinedChannel(c, cid)
+	}, func(e interface{}) { f(*e.(*ClientEnterViewEvent)) })
+}
+
+// OnClientLeftChannel calls f for every ClientLeftView event of channel cid (0 for all)
+func (h *Handlers) OnClientLeftChannel(f func(ClientLeftViewEvent), cid int) (libts.SubscriptionID, error) {
+	return h.handle(func(c chan interface{}) (libts.SubscriptionID, error) {
+		return h.agent.ClientLeftChannel(c, cid)
+	}, func(e interface{}) { f(*e.(*ClientLeftViewEvent)) })
+}
+
+// OnTextMessage calls f for every text message sent to target
+func (h *Handlers) OnTextMessage(f func(TextMessageEvent), target TextMessageTarget) (libts.SubscriptionID, error) {
+	return h.handle(func(c chan interface{}) (libts.SubscriptionID, error) {
+		return h.agent.TextMessage(c, target)
+	}, func(e interface{}) { f(*e.(*TextMessageEvent)) })
+}
+
+// OnTokenUsed calls f for every TokenUsed event
+func (h *Handlers) OnTokenUsed(f func(TokenUsedEvent)) (libts.SubscriptionID, error) {
+	return h.handle(h.agent.TokenUsed, func(e interface{}) { f(*e.(*TokenUsedEvent)) })
+}
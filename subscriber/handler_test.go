@@ -0,0 +1,286 @@
+package subscriber_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/subscriber"
+)
+
+// fakeSubscriber keeps the subscriptions, so the tests can send events to them
+type fakeSubscriber struct {
+	lock          sync.Mutex
+	subscriptions map[libts.SubscriptionID]libts.Subscription
+	unsubscribed  []libts.SubscriptionID
+}
+
+func newFakeSubscriber() *fakeSubscriber {
+	return &fakeSubscriber{subscriptions: map[libts.SubscriptionID]libts.Subscription{}}
+}
+
+func (fs *fakeSubscriber) Subscribe(s libts.Subscription) (libts.SubscriptionID, error) {
+	return fs.SubscribeContext(context.Background(), s)
+}
+
+func (fs *fakeSubscriber) SubscribeContext(ctx context.Context, s libts.Subscription) (libts.SubscriptionID, error) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	id := libts.SubscriptionID(len(fs.subscriptions) + 1)
+	fs.subscriptions[id] = s
+	return id, nil
+}
+
+func (fs *fakeSubscriber) Unsubscribe(id libts.SubscriptionID) error {
+	return fs.UnsubscribeContext(context.Background(), id)
+}
+
+func (fs *fakeSubscriber) UnsubscribeContext(ctx context.Context, id libts.SubscriptionID) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	fs.unsubscribed = append(fs.unsubscribed, id)
+	return nil
+}
+
+func (fs *fakeSubscriber) UnsubscribeAll() error {
+	return nil
+}
+
+func (fs *fakeSubscriber) UnsubscribeAllContext(ctx context.Context) error {
+	return nil
+}
+
+func (fs *fakeSubscriber) Dropped(id libts.SubscriptionID) uint64 {
+	return 0
+}
+
+// send e to the event name of subscription id
+func (fs *fakeSubscriber) send(id libts.SubscriptionID, name string, e interface{}) {
+	fs.lock.Lock()
+	c := fs.subscriptions[id].Events[name].C
+	fs.lock.Unlock()
+	c <- e
+}
+
+func TestHandlers(t *testing.T) {
+	// given
+	fs := newFakeSubscriber()
+	h := subscriber.NewHandlers(subscriber.Agent{Subscriber: fs})
+	defer h.Close()
+	moved := make(chan subscriber.ClientMovedEvent, 1)
+	id, err := h.OnClientMoved(func(e subscriber.ClientMovedEvent) {
+		moved <- e
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// when
+	fs.send(id, subscriber.ClientMoved, &subscriber.ClientMovedEvent{ID: 5, To: 2})
+
+	// then
+	want := subscriber.ClientMovedEvent{ID: 5, To: 2}
+	select {
+	case have := <-moved:
+		if have != want {
+			t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), have, want)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), nil, want)
+	}
+}
+
+func TestHandlersError(t *testing.T) {
+	// given
+	fs := newFakeSubscriber()
+	h := subscriber.NewHandlers(subscriber.Agent{Subscriber: fs})
+	defer h.Close()
+	errs := make(chan error, 2)
+	h.OnError(func(err error) {
+		errs <- err
+	})
+	id, err := h.OnTextMessage(func(e subscriber.TextMessageEvent) {
+		panic(e.Message)
+	}, subscriber.ServerMessages)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// when
+	fs.send(id, subscriber.TextMessage, errors.New("decoding failed"))
+	fs.send(id, subscriber.TextMessage, &subscriber.TextMessageEvent{Message: "boom"})
+
+	// then
+	for _, want := range []string{"decoding failed", "handler panicked: boom"} {
+		select {
+		case have := <-errs:
+			if have.Error() != want {
+				t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), have, want)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), nil, want)
+		}
+	}
+}
+
+func TestHandlersCloseWaits(t *testing.T) {
+	// given
+	fs := newFakeSubscriber()
+	h := subscriber.NewHandlers(subscriber.Agent{Subscriber: fs}, subscriber.WithGoroutineDispatch())
+	started := make(chan struct{})
+	release := make(chan struct{})
+	finished := int32(0)
+	id, err := h.OnTokenUsed(func(e subscriber.TokenUsedEvent) {
+		close(started)
+		<-release
+		atomic.StoreInt32(&finished, 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.send(id, subscriber.TokenUsed, &subscriber.TokenUsedEvent{})
+	<-started
+
+	// when
+	closed := make(chan error)
+	go func() {
+		closed <- h.Close()
+	}()
+	select {
+	case <-closed:
+		t.Errorf("Test %s failed!\n\tClose returned with a running handler", t.Name())
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+
+	// then
+	if err := <-closed; err != nil {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), err, nil)
+	}
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Errorf("Test %s failed!\n\tHandler still running after Close", t.Name())
+	}
+	if len(fs.unsubscribed) != 1 || fs.unsubscribed[0] != id {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), fs.unsubscribed, []libts.SubscriptionID{id})
+	}
+	if _, err := h.OnTokenUsed(func(subscriber.TokenUsedEvent) {}); err != subscriber.ErrHandlersClosed {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), err, subscriber.ErrHandlersClosed)
+	}
+}
+
+func TestHandlersCloseFromHandler(t *testing.T) {
+	// given
+	fs := newFakeSubscriber()
+	h := subscriber.NewHandlers(subscriber.Agent{Subscriber: fs})
+	closed := make(chan error, 1)
+	id, err := h.OnTokenUsed(func(e subscriber.TokenUsedEvent) {
+		go func() {
+			closed <- h.Close() // Close waits for this handler
+		}()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// when
+	fs.send(id, subscriber.TokenUsed, &subscriber.TokenUsedEvent{})
+
+	// then
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), err, nil)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Test %s failed!\n\tClose didn't return", t.Name())
+	}
+}
+
+func TestHandlersWorkerPool(t *testing.T) {
+	// given
+	const workers, events = 2, 10
+	fs := newFakeSubscriber()
+	h := subscriber.NewHandlers(subscriber.Agent{Subscriber: fs}, subscriber.WithWorkerPool(workers))
+	lock := sync.Mutex{}
+	running, max, handled := 0, 0, 0
+	id, err := h.OnChannelEdited(func(e subscriber.ChannelEditedEvent) {
+		lock.Lock()
+		running++
+		if running > max {
+			max = running
+		}
+		lock.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		lock.Lock()
+		running--
+		handled++
+		lock.Unlock()
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// when
+	for i := 0; i < events; i++ {
+		fs.send(id, subscriber.ChannelEdited, &subscriber.ChannelEditedEvent{ID: i})
+	}
+	h.Close()
+
+	// then
+	if handled != events {
+		t.Errorf("Test %s failed!\n\tHave: %d\n\tWant: %d", t.Name(), handled, events)
+	}
+	if max > workers {
+		t.Errorf("Test %s failed!\n\tHave: %d\n\tWant: <= %d", t.Name(), max, workers)
+	}
+}
+
+func TestHandlersGap(t *testing.T) {
+	// given
+	fs := newFakeSubscriber()
+	h := subscriber.NewHandlers(subscriber.Agent{Subscriber: fs})
+	defer h.Close()
+	gaps := make(chan libts.Gap, 1)
+	h.OnGap(func(g libts.Gap) {
+		gaps <- g
+	})
+	id, err := h.OnClientLeftServer(func(subscriber.ClientLeftViewEvent) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// when
+	fs.send(id, subscriber.ClientLeftView, libts.Gap{Dropped: 3})
+
+	// then
+	select {
+	case have := <-gaps:
+		if have != (libts.Gap{Dropped: 3}) {
+			t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), have, libts.Gap{Dropped: 3})
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), nil, libts.Gap{Dropped: 3})
+	}
+}
+
+func TestAgentBackpressure(t *testing.T) {
+	// given
+	fs := newFakeSubscriber()
+	a := subscriber.Agent{Subscriber: fs}.WithHighWater(100, func(int) {})
+
+	// when
+	id, err := a.ClientMoved(make(chan interface{}), 0)
+
+	// then
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := fs.subscriptions[id].Events[subscriber.ClientMoved]
+	if e.Backpressure != libts.Unbounded || e.HighWater != 100 || e.OnHighWater == nil {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %v", t.Name(), e, "unbounded with high water 100")
+	}
+}
@@ -4,57 +4,39 @@ import "github.com/schoeppi5/libts"
 
 // ServerEdited subscribes to the ServerEdited event
 // events recieved will be of type ServerEditedEvent
-func (a Agent) ServerEdited(c chan interface{}) error {
+func (a Agent) ServerEdited(c chan interface{}) (libts.SubscriptionID, error) {
 	s := libts.Subscription{
-		Name: Server,
+		ServerID: a.serverID,
+		Name:     Server,
 		Events: map[string]libts.Event{
-			ServerEdited: {
-				Template: &ServerEditedEvent{},
-				C:        c,
-			},
+			ServerEdited: a.event(&ServerEditedEvent{}, c),
 		},
 	}
-	err := a.Subscriber.Subscribe(s)
-	if err != nil {
-		return err
-	}
-	return nil
+	return a.Subscriber.SubscribeContext(a.Context(), s)
 }
 
 // ClientJoinedServer subscribes to the ClientEnterView events on server level
 // events recieved on the channel will always be of type ClientEnterViewEvent
-func (a Agent) ClientJoinedServer(c chan interface{}) error {
+func (a Agent) ClientJoinedServer(c chan interface{}) (libts.SubscriptionID, error) {
 	s := libts.Subscription{
-		Name: Server,
+		ServerID: a.serverID,
+		Name:     Server,
 		Events: map[string]libts.Event{
-			ClientEnterView: {
-				Template: &ClientEnterViewEvent{},
-				C:        c,
-			},
+			ClientEnterView: a.event(&ClientEnterViewEvent{}, c),
 		},
 	}
-	err := a.Subscriber.Subscribe(s)
-	if err != nil {
-		return err
-	}
-	return nil
+	return a.Subscriber.SubscribeContext(a.Context(), s)
 }
 
 // ClientLeftServer subscribes to the ClientLeftView events on server level
 // events recieved on the channel will always be of type ClientLeftViewEvent
-func (a Agent) ClientLeftServer(c chan interface{}) error {
+func (a Agent) ClientLeftServer(c chan interface{}) (libts.SubscriptionID, error) {
 	s := libts.Subscription{
-		Name: Server,
+		ServerID: a.serverID,
+		Name:     Server,
 		Events: map[string]libts.Event{
-			ClientLeftView: {
-				Template: &ClientLeftViewEvent{},
-				C:        c,
-			},
+			ClientLeftView: a.event(&ClientLeftViewEvent{}, c),
 		},
 	}
-	err := a.Subscriber.Subscribe(s)
-	if err != nil {
-		return err
-	}
-	return nil
+	return a.Subscriber.SubscribeContext(a.Context(), s)
 }
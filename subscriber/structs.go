@@ -3,11 +3,13 @@ package subscriber
 import (
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/schoeppi5/libts/query"
 )
 
 // This file contains structs for all event types
+// ServerID (sid) is not part of the notifications, it is set by the subscriber to the virtual server the event was sent by
 
 // TextMessageEvent event for TextMessage
 type TextMessageEvent struct {
@@ -21,6 +23,7 @@ type TextMessageEvent struct {
 	// Server for gms
 	InvokerName string `mapstructure:"invokername"`
 	InvokerUID  string `mapstructure:"invokeruid"`
+	ServerID    int    `mapstructure:"sid"`
 }
 
 // TokenUsedEvent event for TokenUsed
@@ -32,6 +35,7 @@ type TokenUsedEvent struct {
 	TokenCustomSet string `mapstructure:"tokencustomset"`
 	Token1         string `mapstructure:"token1"`
 	Token2         int    `mapstructure:"token2"`
+	ServerID       int    `mapstructure:"sid"`
 }
 
 // ClientMovedEvent event for ClientMoved
@@ -42,35 +46,37 @@ type ClientMovedEvent struct {
 	InvokerName string `mapstructure:"invokername"`
 	InvokerUID  string `mapstructure:"invokeruid"`
 	ID          int    `mapstructure:"clid"`
+	ServerID    int    `mapstructure:"sid"`
 }
 
 // ChannelEditedEvent event for ChannelEdited
 type ChannelEditedEvent struct {
-	ID                        int         `mapstructure:"cid"`
-	Reason                    Reason      `mapstructure:"reasonid"`
-	InvokerID                 int         `mapstructure:"invokerid"`
-	InvokerName               string      `mapstructure:"invokername"`
-	InvokerUID                string      `mapstructure:"invokeruid"`
-	Name                      string      `mapstructure:"channel_name"`
-	Topic                     string      `mapstructure:"channel_topic"`
-	Codec                     query.Codec `mapstructure:"channel_codec"`
-	CodecQuality              int         `mapstructure:"channel_codec_quality"`
-	MaxClients                int         `mapstructure:"channel_maxclients"`
-	MaxFamilyClients          int         `mapstructure:"channel_maxfamilyclients"`
-	Order                     int         `mapstructure:"channel_order"`
-	Permanent                 bool        `mapstructure:"channel_flag_permanent"`
-	SemiPermanent             bool        `mapstructure:"channel_flag_semi_permanent"`
-	Default                   bool        `mapstructure:"channel_flag_default"`
-	Password                  bool        `mapstructure:"channel_flag_password"`
-	CodecLatencyFactor        int         `mapstructure:"channel_codec_latency_factor"`
-	CodecIsUnencrypted        int         `mapstructure:"channel_codec_is_unencrypted"`
-	DeleteDelay               int         `mapstructure:"channel_delete_delay"`
-	ClientsUnlimited          bool        `mapstructure:"channel_flag_maxclients_unlimited"`
-	FamilyClientsUnlimited    bool        `mapstructure:"channel_flag_maxfamilyclients_unlimited"`
-	MaxFamilyClientsInherited bool        `mapstructure:"channel_flag_maxfamilyclients_inherited"`
-	NeededTalkPower           int         `mapstructure:"channel_needed_talk_power"`
-	NamePhonetic              string      `mapstructure:"channel_name_phonetic"`
-	IconID                    int         `mapstructure:"channel_icon_id"`
+	ID                        int           `mapstructure:"cid"`
+	Reason                    Reason        `mapstructure:"reasonid"`
+	InvokerID                 int           `mapstructure:"invokerid"`
+	InvokerName               string        `mapstructure:"invokername"`
+	InvokerUID                string        `mapstructure:"invokeruid"`
+	Name                      string        `mapstructure:"channel_name"`
+	Topic                     string        `mapstructure:"channel_topic"`
+	Codec                     query.Codec   `mapstructure:"channel_codec"`
+	CodecQuality              int           `mapstructure:"channel_codec_quality"`
+	MaxClients                int           `mapstructure:"channel_maxclients"`
+	MaxFamilyClients          int           `mapstructure:"channel_maxfamilyclients"`
+	Order                     int           `mapstructure:"channel_order"`
+	Permanent                 bool          `mapstructure:"channel_flag_permanent"`
+	SemiPermanent             bool          `mapstructure:"channel_flag_semi_permanent"`
+	Default                   bool          `mapstructure:"channel_flag_default"`
+	Password                  bool          `mapstructure:"channel_flag_password"`
+	CodecLatencyFactor        int           `mapstructure:"channel_codec_latency_factor"`
+	CodecIsUnencrypted        int           `mapstructure:"channel_codec_is_unencrypted"`
+	DeleteDelay               time.Duration `mapstructure:"channel_delete_delay" unit:"s"`
+	ClientsUnlimited          bool          `mapstructure:"channel_flag_maxclients_unlimited"`
+	FamilyClientsUnlimited    bool          `mapstructure:"channel_flag_maxfamilyclients_unlimited"`
+	MaxFamilyClientsInherited bool          `mapstructure:"channel_flag_maxfamilyclients_inherited"`
+	NeededTalkPower           int           `mapstructure:"channel_needed_talk_power"`
+	NamePhonetic              string        `mapstructure:"channel_name_phonetic"`
+	IconID                    int           `mapstructure:"channel_icon_id"`
+	ServerID                  int           `mapstructure:"sid"`
 }
 
 // ChannelDeletedEvent event for ChannelDeleted
@@ -79,35 +85,37 @@ type ChannelDeletedEvent struct {
 	InvokerName string `mapstructure:"invokername"`
 	InvokerUID  string `mapstructure:"invokeruid"`
 	ID          int    `mapstructure:"cid"`
+	ServerID    int    `mapstructure:"sid"`
 }
 
 // ChannelCreatedEvent event for ChannelCreated
 type ChannelCreatedEvent struct {
-	ID                        int         `mapstructure:"cid"`
-	ParentID                  int         `mapstructure:"cpid"`
-	Name                      string      `mapstructure:"channel_name"`
-	Topic                     string      `mapstructure:"channel_topic"`
-	Codec                     query.Codec `mapstructure:"channel_codec"`
-	CodecQuality              int         `mapstructure:"channel_codec_quality"`
-	MaxClients                int         `mapstructure:"channel_maxclients"`
-	MaxFamilyClients          int         `mapstructure:"channel_maxfamilyclients"`
-	Order                     int         `mapstructure:"channel_order"`
-	Permanent                 bool        `mapstructure:"channel_flag_permanent"`
-	SemiPermanent             bool        `mapstructure:"channel_flag_semi_permanent"`
-	Default                   bool        `mapstructure:"channel_flag_default"`
-	Password                  bool        `mapstructure:"channel_flag_password"`
-	CodecLatencyFactor        int         `mapstructure:"channel_codec_latency_factor"`
-	CodecIsUnencrypted        bool        `mapstructure:"channel_codec_is_unencrypted"`
-	DeleteDelay               int         `mapstructure:"channel_delete_delay"`
-	ClientsUnlimited          bool        `mapstructure:"channel_flag_maxclients_unlimited"`
-	FamilyClientsUnlimited    bool        `mapstructure:"channel_flag_maxfamilyclients_unlimited"`
-	MaxFamilyClientsInherited bool        `mapstructure:"channel_flag_maxfamilyclients_inherited"`
-	NeededTalkPower           int         `mapstructure:"channel_needed_talk_power"`
-	NamePhoenetic             string      `mapstructure:"channel_name_phonetic"`
-	IconID                    int         `mapstructure:"channel_icon_id"`
-	InvokerID                 int         `mapstructure:"invokerid"`
-	InvokerName               string      `mapstructure:"invokername"`
-	InvokerUID                string      `mapstructure:"invokeruid"`
+	ID                        int           `mapstructure:"cid"`
+	ParentID                  int           `mapstructure:"cpid"`
+	Name                      string        `mapstructure:"channel_name"`
+	Topic                     string        `mapstructure:"channel_topic"`
+	Codec                     query.Codec   `mapstructure:"channel_codec"`
+	CodecQuality              int           `mapstructure:"channel_codec_quality"`
+	MaxClients                int           `mapstructure:"channel_maxclients"`
+	MaxFamilyClients          int           `mapstructure:"channel_maxfamilyclients"`
+	Order                     int           `mapstructure:"channel_order"`
+	Permanent                 bool          `mapstructure:"channel_flag_permanent"`
+	SemiPermanent             bool          `mapstructure:"channel_flag_semi_permanent"`
+	Default                   bool          `mapstructure:"channel_flag_default"`
+	Password                  bool          `mapstructure:"channel_flag_password"`
+	CodecLatencyFactor        int           `mapstructure:"channel_codec_latency_factor"`
+	CodecIsUnencrypted        bool          `mapstructure:"channel_codec_is_unencrypted"`
+	DeleteDelay               time.Duration `mapstructure:"channel_delete_delay" unit:"s"`
+	ClientsUnlimited          bool          `mapstructure:"channel_flag_maxclients_unlimited"`
+	FamilyClientsUnlimited    bool          `mapstructure:"channel_flag_maxfamilyclients_unlimited"`
+	MaxFamilyClientsInherited bool          `mapstructure:"channel_flag_maxfamilyclients_inherited"`
+	NeededTalkPower           int           `mapstructure:"channel_needed_talk_power"`
+	NamePhoenetic             string        `mapstructure:"channel_name_phonetic"`
+	IconID                    int           `mapstructure:"channel_icon_id"`
+	InvokerID                 int           `mapstructure:"invokerid"`
+	InvokerName               string        `mapstructure:"invokername"`
+	InvokerUID                string        `mapstructure:"invokeruid"`
+	ServerID                  int           `mapstructure:"sid"`
 }
 
 // ChannelMovedEvent event for ChannelMoved
@@ -119,52 +127,57 @@ type ChannelMovedEvent struct {
 	InvokerID   int    `mapstructure:"invokerid"`
 	InvokerName string `mapstructure:"invokername"`
 	InvokerUID  string `mapstructure:"invokeruid"`
+	ServerID    int    `mapstructure:"sid"`
 }
 
 // ChannelDescriptionChangedEvent event for ChannelDescriptionChanged
 type ChannelDescriptionChangedEvent struct {
-	ID int `mapstructure:"cid"`
+	ID       int `mapstructure:"cid"`
+	ServerID int `mapstructure:"sid"`
 }
 
 // ChannelPasswordChangedEvent event for ChannelPasswordChanged
 type ChannelPasswordChangedEvent struct {
-	ID int `mapstructure:"cid"`
+	ID       int `mapstructure:"cid"`
+	ServerID int `mapstructure:"sid"`
 }
 
 // ServerEditedEvent event for ServerEdited
 type ServerEditedEvent struct {
-	Reason                          Reason `mapstructure:"reasonid"`
-	InvokerID                       int    `mapstructure:"invokerid"`
-	InvokerName                     string `mapstructure:"invokername"`
-	InvokerUID                      string `mapstructure:"invokeruid"`
-	Name                            string `mapstructure:"virtualserver_name"`
-	CodecEncryptionMode             string `mapstructure:"virtualserver_codec_encryption_mode"`
-	DefaultServerGroup              int    `mapstructure:"virtualserver_default_server_group"`
-	DefaultChannelGroup             int    `mapstructure:"virtualserver_default_channel_group"`
-	HostbannerURL                   string `mapstructure:"virtualserver_hostbanner_url"`
-	HostbannerGFXURL                string `mapstructure:"virtualserver_hostbanner_gfx_url"`
-	HostbannerGFXInterval           int    `mapstructure:"virtualserver_hostbanner_gfx_interval"`
-	PrioritySpeakerDimmModification int    `mapstructure:"virtualserver_priority_speaker_dimm_modification"`
-	HostbuttonTooltip               string `mapstructure:"virtualserver_hostbutton_tooltip"`
-	HostbuttonURL                   string `mapstructure:"virtualserver_hostbutton_url"`
-	HostbuttonGFXURL                string `mapstructure:"virtualserver_hostbutton_gfx_url"`
-	NamePhoenetic                   string `mapstructure:"virtualserver_name_phoenetic"`
-	IconID                          int    `mapstructure:"virtualserver_icon_id"`
-	HostbannerMode                  string `mapstructure:"virtualserver_hostbanner_mode"`
-	TempChannelDefaultDeleteDelay   int    `mapstructure:"virtualserver_channel_temp_delete_delay_default"`
+	Reason                          Reason        `mapstructure:"reasonid"`
+	InvokerID                       int           `mapstructure:"invokerid"`
+	InvokerName                     string        `mapstructure:"invokername"`
+	InvokerUID                      string        `mapstructure:"invokeruid"`
+	Name                            string        `mapstructure:"virtualserver_name"`
+	CodecEncryptionMode             string        `mapstructure:"virtualserver_codec_encryption_mode"`
+	DefaultServerGroup              int           `mapstructure:"virtualserver_default_server_group"`
+	DefaultChannelGroup             int           `mapstructure:"virtualserver_default_channel_group"`
+	HostbannerURL                   string        `mapstructure:"virtualserver_hostbanner_url"`
+	HostbannerGFXURL                string        `mapstructure:"virtualserver_hostbanner_gfx_url"`
+	HostbannerGFXInterval           time.Duration `mapstructure:"virtualserver_hostbanner_gfx_interval" unit:"s"`
+	PrioritySpeakerDimmModification int           `mapstructure:"virtualserver_priority_speaker_dimm_modification"`
+	HostbuttonTooltip               string        `mapstructure:"virtualserver_hostbutton_tooltip"`
+	HostbuttonURL                   string        `mapstructure:"virtualserver_hostbutton_url"`
+	HostbuttonGFXURL                string        `mapstructure:"virtualserver_hostbutton_gfx_url"`
+	NamePhoenetic                   string        `mapstructure:"virtualserver_name_phoenetic"`
+	IconID                          int           `mapstructure:"virtualserver_icon_id"`
+	HostbannerMode                  string        `mapstructure:"virtualserver_hostbanner_mode"`
+	TempChannelDefaultDeleteDelay   time.Duration `mapstructure:"virtualserver_channel_temp_delete_delay_default" unit:"s"`
+	ServerID                        int           `mapstructure:"sid"`
 }
 
 // ClientLeftViewEvent event for ClientLeftView
 type ClientLeftViewEvent struct {
-	From          int    `mapstructure:"cfid"`
-	To            int    `mapstructure:"ctid"`
-	Reason        Reason `mapstructure:"reasonid"`
-	InvokerID     int    `mapstructure:"invokerid"`
-	InvokerName   string `mapstructure:"invokername"`
-	InvokerUID    string `mapstructure:"invokeruid"`
-	ReasonMessage string `mapstructure:"reasonmsg"`
-	Bantime       int    `mapstructure:"bantime"`
-	ID            int    `mapstructure:"clid"`
+	From          int           `mapstructure:"cfid"`
+	To            int           `mapstructure:"ctid"`
+	Reason        Reason        `mapstructure:"reasonid"`
+	InvokerID     int           `mapstructure:"invokerid"`
+	InvokerName   string        `mapstructure:"invokername"`
+	InvokerUID    string        `mapstructure:"invokeruid"`
+	ReasonMessage string        `mapstructure:"reasonmsg"`
+	Bantime       time.Duration `mapstructure:"bantime" unit:"s"`
+	ID            int           `mapstructure:"clid"`
+	ServerID      int           `mapstructure:"sid"`
 }
 
 // ClientEnterViewEvent event for ClientEnterView
@@ -201,6 +214,7 @@ type ClientEnterViewEvent struct {
 	Country                        string          `mapstructure:"client_country"`
 	ChannelGroupInheritedChannelID int             `mapstructure:"client_channel_group_inherited_channel_id"`
 	Badges                         string          `mapstructure:"client_badges"`
+	ServerID                       int             `mapstructure:"sid"`
 }
 
 // Reason for different events
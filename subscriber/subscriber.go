@@ -1,8 +1,81 @@
 package subscriber
 
-import "github.com/schoeppi5/libts"
+import (
+	"context"
+
+	"github.com/schoeppi5/libts"
+)
 
 // Agent provides all the warpper functions for event subscription
+// Every subscribe function returns the id of the new subscription, which is needed to unsubscribe
 type Agent struct {
-	Subscriber libts.Subscriber
+	Subscriber   libts.Subscriber
+	ctx          context.Context
+	serverID     int
+	backpressure libts.Backpressure
+	highWater    int
+	onHighWater  func(queued int)
+}
+
+// WithContext returns a copy of a, which registers all subscriptions with ctx
+func (a Agent) WithContext(ctx context.Context) Agent {
+	if ctx == nil {
+		panic("nil context")
+	}
+	a.ctx = ctx
+	return a
+}
+
+// OnServer returns a copy of a, which subscribes to the events of virtual server sid
+// Several virtual servers can be subscribed to using the same Subscriber. The events have their ServerID set accordingly
+// Defaults to the server of the Subscriber
+func (a Agent) OnServer(sid int) Agent {
+	a.serverID = sid
+	return a
+}
+
+// WithBackpressure returns a copy of a, which handles slow consumers of its subscriptions according to b
+// Defaults to libts.Block
+func (a Agent) WithBackpressure(b libts.Backpressure) Agent {
+	a.backpressure = b
+	return a
+}
+
+// WithHighWater returns a copy of a, which queues all events of its subscriptions (libts.Unbounded)
+// f is called once n events are queued for a subscription. It must not block
+func (a Agent) WithHighWater(n int, f func(queued int)) Agent {
+	a.backpressure = libts.Unbounded
+	a.highWater = n
+	a.onHighWater = f
+	return a
+}
+
+// Context returns the context of a. Defaults to context.Background()
+func (a Agent) Context() context.Context {
+	if a.ctx != nil {
+		return a.ctx
+	}
+	return context.Background()
+}
+
+// Unsubscribe removes the subscription id returned by one of the subscribe functions
+// Other subscriptions of the same event keep receiving it
+func (a Agent) Unsubscribe(id libts.SubscriptionID) error {
+	return a.Subscriber.UnsubscribeContext(a.Context(), id)
+}
+
+// Dropped returns the number of events dropped because of the backpressure of subscription id
+func (a Agent) Dropped(id libts.SubscriptionID) uint64 {
+	return a.Subscriber.Dropped(id)
+}
+
+// event returns the libts.Event sending events of the type of template to c
+func (a Agent) event(template interface{}, c chan interface{}) libts.Event {
+	return libts.Event{
+		Template:     template,
+		C:            c,
+		Backpressure: a.backpressure,
+		HighWater:    a.highWater,
+		OnHighWater:  a.onHighWater,
+	}
 }
@@ -16,19 +16,13 @@ const (
 )
 
 // TextMessage subscribes to the textmessage event with the given target
-func (a Agent) TextMessage(c chan interface{}, target TextMessageTarget) error {
+func (a Agent) TextMessage(c chan interface{}, target TextMessageTarget) (libts.SubscriptionID, error) {
 	s := libts.Subscription{
-		Name: string(target),
+		ServerID: a.serverID,
+		Name:     string(target),
 		Events: map[string]libts.Event{
-			TextMessage: {
-				Template: &TextMessageEvent{},
-				C:        c,
-			},
+			TextMessage: a.event(&TextMessageEvent{}, c),
 		},
 	}
-	err := a.Subscriber.Subscribe(s)
-	if err != nil {
-		return err
-	}
-	return nil
+	return a.Subscriber.SubscribeContext(a.Context(), s)
 }
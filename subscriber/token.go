@@ -4,19 +4,13 @@ import "github.com/schoeppi5/libts"
 
 // TokenUsed subscribes to the TokenUsed events
 // events recieved on the channel will always be of type TokenUsedEvent
-func (a Agent) TokenUsed(c chan interface{}) error {
+func (a Agent) TokenUsed(c chan interface{}) (libts.SubscriptionID, error) {
 	s := libts.Subscription{
-		Name: Token,
+		ServerID: a.serverID,
+		Name:     Token,
 		Events: map[string]libts.Event{
-			TokenUsed: {
-				Template: &TokenUsedEvent{},
-				C:        c,
-			},
+			TokenUsed: a.event(&TokenUsedEvent{}, c),
 		},
 	}
-	err := a.Subscriber.Subscribe(s)
-	if err != nil {
-		return err
-	}
-	return nil
+	return a.Subscriber.SubscribeContext(a.Context(), s)
 }
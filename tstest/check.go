@@ -0,0 +1,17 @@
+package tstest
+
+import (
+	"testing"
+
+	"github.com/schoeppi5/libts/communication"
+)
+
+// CheckFields fails t, if response contains fields value doesn't cover or values which lose information when decoded
+// response is a raw serverquery response (e.g. a fixture), value a pointer to the struct or slice it is decoded to
+func CheckFields(t testing.TB, response string, value interface{}) {
+	t.Helper()
+	err := communication.Unmarshal([]byte(response), value, communication.WithStrict())
+	if err != nil {
+		t.Errorf("Test %s failed!\n\t%s", t.Name(), err)
+	}
+}
@@ -0,0 +1,596 @@
+package tstest
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// This file contains the built-in commands
+
+var builtins map[string]HandlerFunc
+
+func init() {
+	builtins = map[string]HandlerFunc{
+		"version":                version,
+		"help":                   ok,
+		"login":                  login,
+		"logout":                 logout,
+		"quit":                   ok,
+		"use":                    use,
+		"whoami":                 whoami,
+		"instanceinfo":           instanceInfo,
+		"serverlist":             serverList,
+		"serverinfo":             serverInfo,
+		"serveridgetbyport":      serverIDGetByPort,
+		"channellist":            channelList,
+		"channelinfo":            channelInfo,
+		"channelcreate":          channelCreate,
+		"channeldelete":          channelDelete,
+		"clientlist":             clientList,
+		"clientinfo":             clientInfo,
+		"clientupdate":           clientUpdate,
+		"clientmove":             clientMove,
+		"clientkick":             clientKick,
+		"servergrouplist":        serverGroupList,
+		"channelgrouplist":       channelGroupList,
+		"servergroupaddclient":   serverGroupAddClient,
+		"servergroupdelclient":   serverGroupDelClient,
+		"permissionlist":         permissionList,
+		"sendtextmessage":        sendTextMessage,
+		"servernotifyregister":   serverNotifyRegister,
+		"servernotifyunregister": serverNotifyUnregister,
+	}
+}
+
+func ok(s *Session, c Command) ([]Record, error) {
+	return nil, nil
+}
+
+func version(s *Session, c Command) ([]Record, error) {
+	return []Record{{"version": "3.13.3", "build": "1608128225", "platform": "Linux"}}, nil
+}
+
+func login(s *Session, c Command) ([]Record, error) {
+	name, password := c.Get("client_login_name"), c.Get("client_login_password")
+	s.server.lock.Lock()
+	want, known := s.server.model.Users[name]
+	s.server.lock.Unlock()
+	if !known || want != password {
+		return nil, errInvalidLogin
+	}
+	s.lock.Lock()
+	s.user = name
+	s.lock.Unlock()
+	return nil, nil
+}
+
+func logout(s *Session, c Command) ([]Record, error) {
+	s.server.lock.Lock()
+	s.leave()
+	s.server.lock.Unlock()
+	s.lock.Lock()
+	s.user = ""
+	s.registrations = nil
+	s.lock.Unlock()
+	return nil, nil
+}
+
+func use(s *Session, c Command) ([]Record, error) {
+	s.server.lock.Lock()
+	defer s.server.lock.Unlock()
+	var vs *VirtualServer
+	switch {
+	case c.Has("sid"):
+		vs = s.server.model.Server(c.Int("sid"))
+	case c.Has("port"):
+		vs = s.server.model.ServerByPort(c.Int("port"))
+	default:
+		return nil, errParameterNotFound
+	}
+	if vs == nil {
+		return nil, errInvalidServerID
+	}
+	s.use(vs)
+	return nil, nil
+}
+
+func whoami(s *Session, c Command) ([]Record, error) {
+	s.server.lock.Lock()
+	defer s.server.lock.Unlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r := Record{
+		"virtualserver_status":    "unknown",
+		"virtualserver_id":        "0",
+		"virtualserver_port":      "0",
+		"client_id":               "0",
+		"client_channel_id":       "0",
+		"client_nickname":         "",
+		"client_database_id":      "0",
+		"client_login_name":       s.user,
+		"client_origin_server_id": "0",
+	}
+	if vs := s.server.model.Server(s.serverID); vs != nil {
+		r["virtualserver_status"] = vs.Status
+		r["virtualserver_id"] = strconv.Itoa(vs.ID)
+		r["virtualserver_port"] = strconv.Itoa(vs.Port)
+	}
+	if s.client != nil {
+		r["client_id"] = strconv.Itoa(s.client.ID)
+		r["client_channel_id"] = strconv.Itoa(s.client.ChannelID)
+		r["client_nickname"] = s.client.Nickname
+		r["client_database_id"] = strconv.Itoa(s.client.DBID)
+		r["client_unique_identifier"] = s.client.UID
+	}
+	return []Record{r}, nil
+}
+
+func instanceInfo(s *Session, c Command) ([]Record, error) {
+	s.server.lock.Lock()
+	defer s.server.lock.Unlock()
+	r := Record{}
+	for k, v := range s.server.model.Instance {
+		r[k] = v
+	}
+	return []Record{r}, nil
+}
+
+func serverList(s *Session, c Command) ([]Record, error) {
+	s.server.lock.Lock()
+	defer s.server.lock.Unlock()
+	records := []Record{}
+	for _, vs := range s.server.model.Servers {
+		records = append(records, vs.list())
+	}
+	return nonEmpty(records)
+}
+
+func serverInfo(s *Session, c Command) ([]Record, error) {
+	s.server.lock.Lock()
+	defer s.server.lock.Unlock()
+	vs, err := s.selected()
+	if err != nil {
+		return nil, err
+	}
+	return []Record{vs.info()}, nil
+}
+
+func serverIDGetByPort(s *Session, c Command) ([]Record, error) {
+	s.server.lock.Lock()
+	defer s.server.lock.Unlock()
+	vs := s.server.model.ServerByPort(c.Int("virtualserver_port"))
+	if vs == nil {
+		return nil, errInvalidServerID
+	}
+	return []Record{{"server_id": strconv.Itoa(vs.ID)}}, nil
+}
+
+func channelList(s *Session, c Command) ([]Record, error) {
+	s.server.lock.Lock()
+	defer s.server.lock.Unlock()
+	vs, err := s.selected()
+	if err != nil {
+		return nil, err
+	}
+	records := []Record{}
+	for _, ch := range vs.Channels {
+		records = append(records, ch.list(vs))
+	}
+	return nonEmpty(records)
+}
+
+func channelInfo(s *Session, c Command) ([]Record, error) {
+	s.server.lock.Lock()
+	defer s.server.lock.Unlock()
+	vs, err := s.selected()
+	if err != nil {
+		return nil, err
+	}
+	ch := vs.Channel(c.Int("cid"))
+	if ch == nil {
+		return nil, errInvalidChannelID
+	}
+	return []Record{ch.info()}, nil
+}
+
+func channelCreate(s *Session, c Command) ([]Record, error) {
+	s.server.lock.Lock()
+	vs, err := s.selected()
+	if err != nil {
+		s.server.lock.Unlock()
+		return nil, err
+	}
+	if c.Get("channel_name") == "" {
+		s.server.lock.Unlock()
+		return nil, errParameterNotFound
+	}
+	ch := &Channel{
+		ParentID:   c.Int("cpid"),
+		Name:       c.Get("channel_name"),
+		Topic:      c.Get("channel_topic"),
+		Order:      c.Int("channel_order"),
+		Properties: Record{},
+	}
+	for k, v := range c.Params[0] {
+		if strings.HasPrefix(k, "channel_") && k != "channel_name" && k != "channel_topic" && k != "channel_order" {
+			ch.Properties[k] = v
+		}
+	}
+	vs.AddChannel(ch)
+	sid := vs.ID
+	s.server.lock.Unlock()
+	n := s.invoker()
+	n["cid"] = strconv.Itoa(ch.ID)
+	n["cpid"] = strconv.Itoa(ch.ParentID)
+	n["channel_name"] = ch.Name
+	n["channel_topic"] = ch.Topic
+	n["channel_order"] = strconv.Itoa(ch.Order)
+	s.server.Notify(Notification{
+		ServerID: sid,
+		Event:    "channel",
+		Name:     "notifychannelcreated",
+		Record:   n,
+	})
+	return []Record{{"cid": strconv.Itoa(ch.ID)}}, nil
+}
+
+func channelDelete(s *Session, c Command) ([]Record, error) {
+	s.server.lock.Lock()
+	vs, err := s.selected()
+	if err != nil {
+		s.server.lock.Unlock()
+		return nil, err
+	}
+	cid := c.Int("cid")
+	if vs.clientsIn(cid) > 0 && c.Get("force") != "1" {
+		s.server.lock.Unlock()
+		return nil, errChannelNotEmpty
+	}
+	if vs.RemoveChannel(cid) == nil {
+		s.server.lock.Unlock()
+		return nil, errInvalidChannelID
+	}
+	sid := vs.ID
+	s.server.lock.Unlock()
+	n := s.invoker()
+	n["cid"] = strconv.Itoa(cid)
+	s.server.Notify(Notification{
+		ServerID:  sid,
+		Event:     "channel",
+		ChannelID: cid,
+		Name:      "notifychanneldeleted",
+		Record:    n,
+	})
+	return nil, nil
+}
+
+func clientList(s *Session, c Command) ([]Record, error) {
+	s.server.lock.Lock()
+	defer s.server.lock.Unlock()
+	vs, err := s.selected()
+	if err != nil {
+		return nil, err
+	}
+	records := []Record{}
+	for _, cl := range vs.Clients {
+		records = append(records, cl.list())
+	}
+	return nonEmpty(records)
+}
+
+func clientInfo(s *Session, c Command) ([]Record, error) {
+	s.server.lock.Lock()
+	defer s.server.lock.Unlock()
+	vs, err := s.selected()
+	if err != nil {
+		return nil, err
+	}
+	records := []Record{}
+	for _, clid := range c.All("clid") {
+		id, _ := strconv.Atoi(clid)
+		cl := vs.Client(id)
+		if cl == nil {
+			return nil, errInvalidClientID
+		}
+		records = append(records, cl.info())
+	}
+	if len(records) == 0 {
+		return nil, errParameterNotFound
+	}
+	return records, nil
+}
+
+func clientUpdate(s *Session, c Command) ([]Record, error) {
+	s.server.lock.Lock()
+	defer s.server.lock.Unlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.client == nil {
+		return nil, errInvalidServerID
+	}
+	for k, v := range c.Params[0] {
+		if k == "client_nickname" {
+			s.client.Nickname = v
+			continue
+		}
+		if s.client.Properties == nil {
+			s.client.Properties = Record{}
+		}
+		s.client.Properties[k] = v
+	}
+	return nil, nil
+}
+
+func clientMove(s *Session, c Command) ([]Record, error) {
+	s.server.lock.Lock()
+	vs, err := s.selected()
+	if err != nil {
+		s.server.lock.Unlock()
+		return nil, err
+	}
+	to := vs.Channel(c.Int("cid"))
+	if to == nil {
+		s.server.lock.Unlock()
+		return nil, errInvalidChannelID
+	}
+	moved := []*Client{}
+	for _, clid := range c.All("clid") {
+		id, _ := strconv.Atoi(clid)
+		cl := vs.Client(id)
+		if cl == nil {
+			s.server.lock.Unlock()
+			return nil, errInvalidClientID
+		}
+		moved = append(moved, cl)
+	}
+	if len(moved) == 0 {
+		s.server.lock.Unlock()
+		return nil, errParameterNotFound
+	}
+	for _, cl := range moved {
+		cl.ChannelID = to.ID
+	}
+	sid := vs.ID
+	s.server.lock.Unlock()
+	for _, cl := range moved {
+		n := s.invoker()
+		n["ctid"] = strconv.Itoa(to.ID)
+		n["reasonid"] = "1"
+		n["clid"] = strconv.Itoa(cl.ID)
+		s.server.Notify(Notification{
+			ServerID:  sid,
+			Event:     "channel",
+			ChannelID: to.ID,
+			Name:      "notifyclientmoved",
+			Record:    n,
+		})
+	}
+	return nil, nil
+}
+
+func clientKick(s *Session, c Command) ([]Record, error) {
+	reason := c.Int("reasonid")
+	if reason != 4 && reason != 5 {
+		return nil, errInvalidParameter
+	}
+	s.server.lock.Lock()
+	vs, err := s.selected()
+	if err != nil {
+		s.server.lock.Unlock()
+		return nil, err
+	}
+	kicked := []*Client{}
+	for _, clid := range c.All("clid") {
+		id, _ := strconv.Atoi(clid)
+		cl := vs.Client(id)
+		if cl == nil {
+			s.server.lock.Unlock()
+			return nil, errInvalidClientID
+		}
+		kicked = append(kicked, cl)
+	}
+	from := map[int]int{}
+	for _, cl := range kicked {
+		from[cl.ID] = cl.ChannelID
+		if reason == 5 {
+			vs.RemoveClient(cl.ID)
+		} else if d := vs.DefaultChannel(); d != nil {
+			cl.ChannelID = d.ID
+		}
+	}
+	sid := vs.ID
+	s.server.lock.Unlock()
+	for _, cl := range kicked {
+		n := s.invoker()
+		n["clid"] = strconv.Itoa(cl.ID)
+		n["reasonid"] = strconv.Itoa(reason)
+		n["reasonmsg"] = c.Get("reasonmsg")
+		if reason == 4 {
+			n["ctid"] = strconv.Itoa(cl.ChannelID)
+			s.server.Notify(Notification{ServerID: sid, Event: "channel", ChannelID: cl.ChannelID, Name: "notifyclientmoved", Record: n})
+			continue
+		}
+		n["cfid"] = strconv.Itoa(from[cl.ID])
+		n["ctid"] = "0"
+		s.server.Notify(Notification{ServerID: sid, Event: "server", Name: "notifyclientleftview", Record: n})
+	}
+	return nil, nil
+}
+
+func serverGroupList(s *Session, c Command) ([]Record, error) {
+	s.server.lock.Lock()
+	defer s.server.lock.Unlock()
+	vs, err := s.selected()
+	if err != nil {
+		return nil, err
+	}
+	records := []Record{}
+	for _, g := range vs.ServerGroups {
+		records = append(records, g.record("sgid"))
+	}
+	return nonEmpty(records)
+}
+
+func serverGroupAddClient(s *Session, c Command) ([]Record, error) {
+	return changeServerGroup(s, c, func(groups []int, sgid int) ([]int, error) {
+		for _, g := range groups {
+			if g == sgid {
+				return nil, errDuplicateEntry
+			}
+		}
+		return append(groups, sgid), nil
+	})
+}
+
+func serverGroupDelClient(s *Session, c Command) ([]Record, error) {
+	return changeServerGroup(s, c, func(groups []int, sgid int) ([]int, error) {
+		for i, g := range groups {
+			if g == sgid {
+				return append(groups[:i:i], groups[i+1:]...), nil
+			}
+		}
+		return nil, errPermEmptyResult
+	})
+}
+
+// changeServerGroup applies change to the server groups of all clients cldbid of c
+func changeServerGroup(s *Session, c Command, change func(groups []int, sgid int) ([]int, error)) ([]Record, error) {
+	s.server.lock.Lock()
+	defer s.server.lock.Unlock()
+	vs, err := s.selected()
+	if err != nil {
+		return nil, err
+	}
+	sgid := c.Int("sgid")
+	if vs.serverGroup(sgid) == nil {
+		return nil, errInvalidGroupID
+	}
+	for _, cldbid := range c.All("cldbid") {
+		id, _ := strconv.Atoi(cldbid)
+		cl := vs.clientByDBID(id)
+		if cl == nil {
+			return nil, errInvalidClientID
+		}
+		groups, err := change(cl.ServerGroups, sgid)
+		if err != nil {
+			return nil, err
+		}
+		cl.ServerGroups = groups
+	}
+	return nil, nil
+}
+
+func channelGroupList(s *Session, c Command) ([]Record, error) {
+	s.server.lock.Lock()
+	defer s.server.lock.Unlock()
+	vs, err := s.selected()
+	if err != nil {
+		return nil, err
+	}
+	records := []Record{}
+	for _, g := range vs.ChannelGroups {
+		records = append(records, g.record("cgid"))
+	}
+	return nonEmpty(records)
+}
+
+func permissionList(s *Session, c Command) ([]Record, error) {
+	s.server.lock.Lock()
+	defer s.server.lock.Unlock()
+	ids := []int{}
+	for id := range s.server.model.Permissions {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	records := []Record{}
+	for _, id := range ids {
+		records = append(records, Record{"permid": strconv.Itoa(id), "permname": s.server.model.Permissions[id], "permdesc": ""})
+	}
+	return nonEmpty(records)
+}
+
+func sendTextMessage(s *Session, c Command) ([]Record, error) {
+	s.server.lock.Lock()
+	vs, err := s.selected()
+	if err != nil {
+		s.server.lock.Unlock()
+		return nil, err
+	}
+	sid := vs.ID
+	n := Notification{
+		ServerID: sid,
+		Name:     "notifytextmessage",
+	}
+	switch c.Int("targetmode") {
+	case 1:
+		if vs.Client(c.Int("target")) == nil {
+			s.server.lock.Unlock()
+			return nil, errInvalidClientID
+		}
+		n.Event, n.ClientID = "textprivate", c.Int("target")
+	case 2:
+		n.Event = "textchannel"
+	case 3:
+		n.Event = "textserver"
+	default:
+		s.server.lock.Unlock()
+		return nil, errInvalidParameter
+	}
+	s.server.lock.Unlock()
+	n.Record = s.invoker()
+	n.Record["targetmode"] = c.Get("targetmode")
+	n.Record["msg"] = c.Get("msg")
+	if n.ClientID != 0 {
+		n.Record["target"] = c.Get("target")
+	}
+	s.server.Notify(n)
+	return nil, nil
+}
+
+func serverNotifyRegister(s *Session, c Command) ([]Record, error) {
+	event := c.Get("event")
+	switch event {
+	case "server", "channel", "textserver", "textchannel", "textprivate", "tokenused":
+	default:
+		return nil, errInvalidParameter
+	}
+	s.server.lock.Lock()
+	_, err := s.selected()
+	s.server.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.registrations = append(s.registrations, registration{
+		serverID:  s.serverID,
+		event:     event,
+		channelID: c.Int("id"),
+	})
+	return nil, nil
+}
+
+func serverNotifyUnregister(s *Session, c Command) ([]Record, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.registrations = nil
+	return nil, nil
+}
+
+// selected returns the selected virtual server. s.server.lock must be held
+func (s *Session) selected() (*VirtualServer, error) {
+	vs := s.server.model.Server(s.ServerID())
+	if vs == nil {
+		return nil, errInvalidServerID
+	}
+	return vs, nil
+}
+
+// nonEmpty returns the empty result error for empty lists, like teamspeak does
+func nonEmpty(records []Record) ([]Record, error) {
+	if len(records) == 0 {
+		return nil, errEmptyResult
+	}
+	return records, nil
+}
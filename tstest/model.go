@@ -0,0 +1,368 @@
+package tstest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// This file contains the in-memory state of the fake teamspeak
+
+// Model is the state served by a Server
+// Only change it inside Server.Update
+type Model struct {
+	// Users maps login names to passwords. Without users no login is required
+	Users map[string]string
+	// APIKeys accepted by the webquery handler. Without keys every request is accepted
+	APIKeys []string
+	// Instance contains the properties returned by instanceinfo
+	Instance Record
+	// Servers are the virtual servers of the instance
+	Servers []*VirtualServer
+	// Permissions maps permission ids to their names (returned by permissionlist)
+	Permissions map[int]string
+}
+
+// VirtualServer is a virtual server of the model
+type VirtualServer struct {
+	ID     int
+	Port   int
+	Name   string
+	Status string
+	// Properties are added to serverinfo
+	Properties    Record
+	Channels      []*Channel
+	Clients       []*Client
+	ServerGroups  []*Group
+	ChannelGroups []*Group
+}
+
+// Channel is a channel on a virtual server
+type Channel struct {
+	ID       int
+	ParentID int
+	Name     string
+	Topic    string
+	Order    int
+	// Properties are added to channelinfo
+	Properties Record
+}
+
+// Client is a client connected to a virtual server
+type Client struct {
+	ID           int
+	DBID         int
+	ChannelID    int
+	Nickname     string
+	UID          string
+	Query        bool // serverquery client
+	ServerGroups []int
+	ChannelGroup int
+	// Properties are added to clientinfo
+	Properties Record
+}
+
+// Group is a server or channel group
+type Group struct {
+	ID   int
+	Name string
+	Type int // 0 = template | 1 = regular | 2 = query
+}
+
+// DefaultModel returns an instance with one virtual server (sid 1, port 9987) containing a default channel, the default groups and the user serveradmin (password secret)
+func DefaultModel() *Model {
+	return &Model{
+		Users: map[string]string{
+			"serveradmin": "secret",
+		},
+		Instance: Record{
+			"serverinstance_database_version":             "26",
+			"serverinstance_filetransfer_port":            "30033",
+			"serverinstance_guest_serverquery_group":      "1",
+			"serverinstance_serverquery_flood_commands":   "50",
+			"serverinstance_serverquery_flood_time":       "3",
+			"serverinstance_serverquery_ban_time":         "600",
+			"serverinstance_template_serveradmin_group":   "3",
+			"serverinstance_template_serverdefault_group": "5",
+		},
+		Permissions: map[int]string{
+			1: "b_serverinstance_help_view",
+			4: "b_serverinstance_info_view",
+			6: "b_serverinstance_virtualserver_list",
+			9: "b_virtualserver_select",
+		},
+
+		Servers: []*VirtualServer{
+			{
+				ID:     1,
+				Port:   9987,
+				Name:   "TeamSpeak ]I[ Server",
+				Status: "online",
+				Channels: []*Channel{
+					{ID: 1, Name: "Default Channel", Properties: Record{"channel_flag_default": "1", "channel_flag_permanent": "1"}},
+				},
+				ServerGroups: []*Group{
+					{ID: 1, Name: "Guest Server Query", Type: 2},
+					{ID: 2, Name: "Admin Server Query", Type: 2},
+					{ID: 6, Name: "Server Admin", Type: 1},
+					{ID: 8, Name: "Guest", Type: 1},
+				},
+				ChannelGroups: []*Group{
+					{ID: 5, Name: "Channel Admin", Type: 1},
+					{ID: 8, Name: "Guest", Type: 1},
+				},
+			},
+		},
+	}
+}
+
+// Server returns the virtual server sid
+func (m *Model) Server(sid int) *VirtualServer {
+	for _, vs := range m.Servers {
+		if vs.ID == sid {
+			return vs
+		}
+	}
+	return nil
+}
+
+// ServerByPort returns the virtual server listening on port
+func (m *Model) ServerByPort(port int) *VirtualServer {
+	for _, vs := range m.Servers {
+		if vs.Port == port {
+			return vs
+		}
+	}
+	return nil
+}
+
+// Channel returns the channel cid
+func (vs *VirtualServer) Channel(cid int) *Channel {
+	for _, c := range vs.Channels {
+		if c.ID == cid {
+			return c
+		}
+	}
+	return nil
+}
+
+// Client returns the client clid
+func (vs *VirtualServer) Client(clid int) *Client {
+	for _, c := range vs.Clients {
+		if c.ID == clid {
+			return c
+		}
+	}
+	return nil
+}
+
+// DefaultChannel returns the channel new clients join
+func (vs *VirtualServer) DefaultChannel() *Channel {
+	for _, c := range vs.Channels {
+		if c.Properties["channel_flag_default"] == "1" {
+			return c
+		}
+	}
+	if len(vs.Channels) > 0 {
+		return vs.Channels[0]
+	}
+	return nil
+}
+
+// AddChannel adds c with the next free id (if c.ID is 0) and returns it
+func (vs *VirtualServer) AddChannel(c *Channel) *Channel {
+	if c.ID == 0 {
+		c.ID = 1
+		for _, other := range vs.Channels {
+			if other.ID >= c.ID {
+				c.ID = other.ID + 1
+			}
+		}
+	}
+	vs.Channels = append(vs.Channels, c)
+	return c
+}
+
+// AddClient adds c with the next free id (if c.ID is 0) and returns it
+// Clients without channel join the default channel, clients without groups are guests
+func (vs *VirtualServer) AddClient(c *Client) *Client {
+	if c.ID == 0 {
+		c.ID = 1
+		for _, other := range vs.Clients {
+			if other.ID >= c.ID {
+				c.ID = other.ID + 1
+			}
+		}
+	}
+	if c.DBID == 0 {
+		c.DBID = c.ID
+	}
+	if c.UID == "" {
+		c.UID = fmt.Sprintf("fakeuid%d=", c.ID)
+	}
+	if len(c.ServerGroups) == 0 {
+		c.ServerGroups = []int{8}
+	}
+	if c.ChannelGroup == 0 {
+		c.ChannelGroup = 8
+	}
+	if c.ChannelID == 0 {
+		if d := vs.DefaultChannel(); d != nil {
+			c.ChannelID = d.ID
+		}
+	}
+	vs.Clients = append(vs.Clients, c)
+	return c
+}
+
+// RemoveClient removes client clid and returns it (nil if unknown)
+func (vs *VirtualServer) RemoveClient(clid int) *Client {
+	for i, c := range vs.Clients {
+		if c.ID == clid {
+			vs.Clients = append(vs.Clients[:i], vs.Clients[i+1:]...)
+			return c
+		}
+	}
+	return nil
+}
+
+// RemoveChannel removes channel cid and returns it (nil if unknown)
+func (vs *VirtualServer) RemoveChannel(cid int) *Channel {
+	for i, c := range vs.Channels {
+		if c.ID == cid {
+			vs.Channels = append(vs.Channels[:i], vs.Channels[i+1:]...)
+			return c
+		}
+	}
+	return nil
+}
+
+func (vs *VirtualServer) clientsIn(cid int) int {
+	n := 0
+	for _, c := range vs.Clients {
+		if c.ChannelID == cid {
+			n++
+		}
+	}
+	return n
+}
+
+// list returns the short representation used by serverlist
+func (vs *VirtualServer) list() Record {
+	return Record{
+		"virtualserver_id":            strconv.Itoa(vs.ID),
+		"virtualserver_port":          strconv.Itoa(vs.Port),
+		"virtualserver_status":        vs.Status,
+		"virtualserver_clientsonline": strconv.Itoa(len(vs.Clients)),
+		"virtualserver_name":          vs.Name,
+	}
+}
+
+// info returns the detailed representation used by serverinfo
+func (vs *VirtualServer) info() Record {
+	r := vs.list()
+	r["virtualserver_channelsonline"] = strconv.Itoa(len(vs.Channels))
+	queries := 0
+	for _, c := range vs.Clients {
+		if c.Query {
+			queries++
+		}
+	}
+	r["virtualserver_queryclientsonline"] = strconv.Itoa(queries)
+	for k, v := range vs.Properties {
+		r[k] = v
+	}
+	return r
+}
+
+func (c *Channel) list(vs *VirtualServer) Record {
+	return Record{
+		"cid":                            strconv.Itoa(c.ID),
+		"pid":                            strconv.Itoa(c.ParentID),
+		"channel_order":                  strconv.Itoa(c.Order),
+		"channel_name":                   c.Name,
+		"total_clients":                  strconv.Itoa(vs.clientsIn(c.ID)),
+		"channel_needed_subscribe_power": "0",
+	}
+}
+
+// info of a channel doesn't contain its id
+func (c *Channel) info() Record {
+	r := Record{
+		"pid":           strconv.Itoa(c.ParentID),
+		"channel_name":  c.Name,
+		"channel_topic": c.Topic,
+		"channel_order": strconv.Itoa(c.Order),
+		"channel_codec": "4",
+	}
+	for k, v := range c.Properties {
+		r[k] = v
+	}
+	return r
+}
+
+func (c *Client) list() Record {
+	return Record{
+		"clid":               strconv.Itoa(c.ID),
+		"cid":                strconv.Itoa(c.ChannelID),
+		"client_database_id": strconv.Itoa(c.DBID),
+		"client_nickname":    c.Nickname,
+		"client_type":        boolString(c.Query),
+	}
+}
+
+// info of a client doesn't contain its id
+func (c *Client) info() Record {
+	groups := make([]string, len(c.ServerGroups))
+	for i, g := range c.ServerGroups {
+		groups[i] = strconv.Itoa(g)
+	}
+	r := Record{
+		"cid":                      strconv.Itoa(c.ChannelID),
+		"client_database_id":       strconv.Itoa(c.DBID),
+		"client_nickname":          c.Nickname,
+		"client_unique_identifier": c.UID,
+		"client_type":              boolString(c.Query),
+		"client_servergroups":      strings.Join(groups, ","),
+		"client_channel_group_id":  strconv.Itoa(c.ChannelGroup),
+	}
+	for k, v := range c.Properties {
+		r[k] = v
+	}
+	return r
+}
+
+func (vs *VirtualServer) serverGroup(sgid int) *Group {
+	for _, g := range vs.ServerGroups {
+		if g.ID == sgid {
+			return g
+		}
+	}
+	return nil
+}
+
+func (vs *VirtualServer) clientByDBID(cldbid int) *Client {
+	for _, c := range vs.Clients {
+		if c.DBID == cldbid {
+			return c
+		}
+	}
+	return nil
+}
+
+func (g *Group) record(id string) Record {
+	return Record{
+		id:       strconv.Itoa(g.ID),
+		"name":   g.Name,
+		"type":   strconv.Itoa(g.Type),
+		"iconid": "0",
+		"savedb": "1",
+	}
+}
+
+func boolString(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,202 @@
+package tstest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/communication"
+)
+
+// This file contains the serverquery line protocol
+
+// Record is a single entry of a response or notification (key=value pairs)
+type Record map[string]string
+
+// Command is a parsed command line
+// Params contains one Record per | separated group (clid=1|clid=2)
+type Command struct {
+	Name   string
+	Params []Record
+	Flags  []string
+}
+
+// ParseCommand splits a command line into its name, parameters and flags
+// Keys without value (login serveradmin secret) are stored as parameters without value as well
+func ParseCommand(line string) Command {
+	line = strings.TrimRight(line, "\r\n")
+	fields := strings.SplitN(line, " ", 2)
+	c := Command{
+		Name:   fields[0],
+		Params: []Record{{}},
+	}
+	if len(fields) == 1 {
+		return c
+	}
+	for i, record := range communication.Tokenize(fields[1]) {
+		if i > 0 {
+			c.Params = append(c.Params, Record{})
+		}
+		for _, field := range record {
+			if field.NoValue && strings.HasPrefix(field.Key, "-") {
+				c.Flags = append(c.Flags, field.Key)
+				continue
+			}
+			c.Params[i][field.Key] = field.Value
+		}
+	}
+	return c
+}
+
+// Get returns the value of key from the first group containing it
+func (c Command) Get(key string) string {
+	for _, p := range c.Params {
+		if v, ok := p[key]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// Has returns true, if any group contains key
+func (c Command) Has(key string) bool {
+	for _, p := range c.Params {
+		if _, ok := p[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Int returns the value of key as int (0 if missing or invalid)
+func (c Command) Int(key string) int {
+	i, _ := strconv.Atoi(c.Get(key))
+	return i
+}
+
+// All returns the values of key from all groups
+func (c Command) All(key string) []string {
+	values := []string{}
+	for _, p := range c.Params {
+		if v, ok := p[key]; ok {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Flag returns true, if the flag (e.g. -continueonerror) is set
+func (c Command) Flag(flag string) bool {
+	for _, f := range c.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// Items splits c into one command per group (clid=1|clid=2 -> clid=1 and clid=2)
+// Keys found in a single group only (e.g. reasonid) are added to every item
+func (c Command) Items() []Command {
+	count := map[string]int{}
+	for _, p := range c.Params {
+		for k := range p {
+			count[k]++
+		}
+	}
+	items := make([]Command, len(c.Params))
+	for i, p := range c.Params {
+		item := Record{}
+		for _, other := range c.Params {
+			for k, v := range other {
+				if count[k] == 1 {
+					item[k] = v
+				}
+			}
+		}
+		for k, v := range p {
+			item[k] = v
+		}
+		items[i] = Command{Name: c.Name, Params: []Record{item}, Flags: c.Flags}
+	}
+	return items
+}
+
+// Format returns the serverquery representation of records (without line terminator)
+// Keys are sorted to keep the output stable
+func Format(records []Record) string {
+	lines := make([]string, len(records))
+	for i, r := range records {
+		lines[i] = r.String()
+	}
+	return strings.Join(lines, "|")
+}
+
+// String returns r as key=value pairs with escaped values
+func (r Record) String() string {
+	keys := make([]string, 0, len(r))
+	for k := range r {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fields := make([]string, len(keys))
+	for i, k := range keys {
+		if r[k] == "" {
+			fields[i] = k
+			continue
+		}
+		fields[i] = k + "=" + libts.Escape(r[k])
+	}
+	return strings.Join(fields, " ")
+}
+
+// Error returns a QueryError as teamspeak would send it
+func Error(id int, msg string) error {
+	return communication.QueryError{
+		ID:      id,
+		Message: msg,
+	}
+}
+
+// errorLine returns the terminating error line for err
+func errorLine(err error) string {
+	if err == nil {
+		return "error id=0 msg=ok"
+	}
+	var e communication.QueryError
+	if !errors.As(err, &e) {
+		e = communication.QueryError{ID: 1, Message: err.Error()}
+	}
+	line := fmt.Sprintf("error id=%d msg=%s", e.ID, libts.Escape(e.Message))
+	if e.ExtraMessage != "" {
+		line += " extra_msg=" + libts.Escape(e.ExtraMessage)
+	}
+	if e.FailedPermID != 0 {
+		line += fmt.Sprintf(" failed_permid=%d", e.FailedPermID)
+	}
+	return line
+}
+
+// errors as sent by teamspeak
+var (
+	errCommandNotFound   = errorID(libts.ErrCommandNotFound)
+	errInvalidClientID   = errorID(libts.ErrInvalidClientID)
+	errNotLoggedIn       = errorID(libts.ErrNotLoggedIn)
+	errInvalidLogin      = errorID(libts.ErrInvalidLogin)
+	errInvalidChannelID  = errorID(libts.ErrInvalidChannelID)
+	errChannelNotEmpty   = errorID(libts.ErrChannelNotEmpty)
+	errInvalidServerID   = errorID(libts.ErrInvalidServerID)
+	errEmptyResult       = errorID(libts.ErrEmptyResult)
+	errInvalidParameter  = errorID(libts.ErrInvalidParameter)
+	errParameterNotFound = errorID(libts.ErrParameterNotFound)
+	errInvalidGroupID    = errorID(libts.ErrInvalidGroupID)
+	errDuplicateEntry    = errorID(libts.ErrPermDuplicateEntry)
+	errPermEmptyResult   = errorID(libts.ErrPermEmptyResult)
+)
+
+func errorID(id libts.ErrorID) error {
+	return Error(int(id), id.Error())
+}
@@ -0,0 +1,207 @@
+package tstest
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// HandlerFunc answers a command. The records are sent before the terminating error line
+type HandlerFunc func(s *Session, c Command) ([]Record, error)
+
+// Server is a fake teamspeak instance, that speaks the serverquery protocol
+// The same Model is served over telnet (ListenTelnet), ssh (ListenSSH) and webquery (Handler)
+type Server struct {
+	lock     sync.Mutex // guards model
+	model    *Model
+	handlers map[string]HandlerFunc
+	received []string
+
+	sessionsLock sync.Mutex
+	sessions     map[*Session]struct{}
+	closers      []io.Closer
+	hostKey      ssh.Signer
+}
+
+// Notification is pushed to every session registered for it (servernotifyregister)
+type Notification struct {
+	ServerID int
+	// Event is the name used to register (server, channel, textserver, textchannel, textprivate, tokenused)
+	Event string
+	// ChannelID of channel events. Sessions registered with id=0 receive the events of all channels
+	ChannelID int
+	// ClientID of private text messages. Only the session of that query client receives them
+	ClientID int
+	// Name of the notification, e.g. notifycliententerview
+	Name   string
+	Record Record
+}
+
+// NewServer returns a Server serving DefaultModel
+func NewServer() *Server {
+	return NewServerWithModel(DefaultModel())
+}
+
+// NewServerWithModel returns a Server serving m
+func NewServerWithModel(m *Model) *Server {
+	return &Server{
+		model:    m,
+		handlers: map[string]HandlerFunc{},
+		sessions: map[*Session]struct{}{},
+	}
+}
+
+// Update runs f with exclusive access to the model
+func (s *Server) Update(f func(m *Model)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f(s.model)
+}
+
+// Handle answers command using h instead of the built-in handler
+func (s *Server) Handle(command string, h HandlerFunc) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.handlers[command] = h
+}
+
+// Received returns all commands received so far (keys in alphabetical order)
+func (s *Server) Received() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string{}, s.received...)
+}
+
+// Notify pushes n to all registered sessions
+func (s *Server) Notify(n Notification) {
+	line := n.Name + " " + n.Record.String()
+	for _, session := range s.sessionList() {
+		if session.registered(n) {
+			session.write(line)
+		}
+	}
+}
+
+// Close stops all listeners and closes all connections
+func (s *Server) Close() {
+	s.sessionsLock.Lock()
+	closers := s.closers
+	s.closers = nil
+	s.sessionsLock.Unlock()
+	for _, c := range closers {
+		c.Close()
+	}
+}
+
+// ServeConn speaks the serverquery protocol on conn until it is closed or the client quits
+// user is the already authenticated login (e.g. ssh), "" if the client has to login
+func (s *Server) ServeConn(conn io.ReadWriteCloser, user string) {
+	session := s.newSession(conn, user)
+	defer s.closeSession(session)
+	session.write("TS3\n\rWelcome to the fake TeamSpeak 3 ServerQuery interface, type \"help\" for a list of commands and \"help <command>\" for information on a specific command.")
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+		if line == "" { // keepalive
+			continue
+		}
+		c := ParseCommand(line)
+		session.write(session.Exec(c))
+		if c.Name == "quit" {
+			return
+		}
+	}
+}
+
+func (s *Server) newSession(conn io.ReadWriteCloser, user string) *Session {
+	session := &Session{
+		server: s,
+		user:   user,
+		conn:   conn,
+	}
+	s.sessionsLock.Lock()
+	s.sessions[session] = struct{}{}
+	s.closers = append(s.closers, conn)
+	s.sessionsLock.Unlock()
+	return session
+}
+
+func (s *Server) closeSession(session *Session) {
+	s.sessionsLock.Lock()
+	delete(s.sessions, session)
+	s.sessionsLock.Unlock()
+	session.conn.Close()
+	s.lock.Lock()
+	session.leave()
+	s.lock.Unlock()
+}
+
+func (s *Server) sessionList() []*Session {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+	sessions := make([]*Session, 0, len(s.sessions))
+	for session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+func (s *Server) addCloser(c io.Closer) {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+	s.closers = append(s.closers, c)
+}
+
+// Connect adds c to the virtual server sid and notifies the registered sessions (notifycliententerview)
+// Returns nil, if sid is unknown
+func (s *Server) Connect(sid int, c *Client) *Client {
+	s.lock.Lock()
+	vs := s.model.Server(sid)
+	if vs == nil {
+		s.lock.Unlock()
+		return nil
+	}
+	vs.AddClient(c)
+	r := c.info()
+	s.lock.Unlock()
+	delete(r, "cid")
+	r["cfid"] = "0"
+	r["ctid"] = strconv.Itoa(c.ChannelID)
+	r["reasonid"] = "0"
+	r["clid"] = strconv.Itoa(c.ID)
+	s.Notify(Notification{ServerID: sid, Event: "server", Name: "notifycliententerview", Record: r})
+	s.Notify(Notification{ServerID: sid, Event: "channel", ChannelID: c.ChannelID, Name: "notifycliententerview", Record: r})
+	return c
+}
+
+// Disconnect removes client clid from the virtual server sid and notifies the registered sessions (notifyclientleftview)
+func (s *Server) Disconnect(sid int, clid int, msg string) {
+	s.lock.Lock()
+	vs := s.model.Server(sid)
+	if vs == nil {
+		s.lock.Unlock()
+		return
+	}
+	c := vs.RemoveClient(clid)
+	s.lock.Unlock()
+	if c == nil {
+		return
+	}
+	r := Record{
+		"cfid":      strconv.Itoa(c.ChannelID),
+		"ctid":      "0",
+		"reasonid":  "8",
+		"reasonmsg": msg,
+		"clid":      strconv.Itoa(c.ID),
+	}
+	s.Notify(Notification{ServerID: sid, Event: "server", Name: "notifyclientleftview", Record: r})
+	s.Notify(Notification{ServerID: sid, Event: "channel", ChannelID: c.ChannelID, Name: "notifyclientleftview", Record: r})
+}
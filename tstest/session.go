@@ -0,0 +1,210 @@
+package tstest
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/schoeppi5/libts"
+)
+
+// Session is a single query connection (or webquery request)
+type Session struct {
+	server    *Server
+	conn      io.ReadWriteCloser // nil for webquery
+	writeLock sync.Mutex
+
+	lock          sync.Mutex
+	user          string
+	serverID      int
+	client        *Client // query client on the selected virtual server
+	registrations []registration
+}
+
+type registration struct {
+	serverID  int
+	event     string
+	channelID int
+}
+
+// Server returns the server s is connected to
+func (s *Session) Server() *Server {
+	return s.server
+}
+
+// User returns the login name ("" if not logged in)
+func (s *Session) User() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.user
+}
+
+// ServerID returns the selected virtual server
+func (s *Session) ServerID() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.serverID
+}
+
+// ClientID returns the id of the query client on the selected virtual server
+func (s *Session) ClientID() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.client == nil {
+		return 0
+	}
+	return s.client.ID
+}
+
+// Exec runs c and returns the response including the terminating error line
+// With -continueonerror every item is run on its own. A failed item is answered with its error line, a succeeded one with its records (if any)
+func (s *Session) Exec(c Command) string {
+	if !c.Flag(string(libts.FlagContinueOnError)) {
+		return response(s.run(c))
+	}
+	s.record(c)
+	lines := []string{}
+	for _, item := range c.Items() {
+		records, err := s.handle(item)
+		if err != nil {
+			lines = append(lines, errorLine(err))
+		} else if len(records) != 0 {
+			lines = append(lines, Format(records))
+		}
+	}
+	return strings.Join(append(lines, errorLine(nil)), "\n\r")
+}
+
+func response(records []Record, err error) string {
+	if len(records) == 0 {
+		return errorLine(err)
+	}
+	return Format(records) + "\n\r" + errorLine(err)
+}
+
+// run c using the custom or built-in handler
+func (s *Session) run(c Command) ([]Record, error) {
+	s.record(c)
+	return s.handle(c)
+}
+
+func (s *Session) record(c Command) {
+	s.server.lock.Lock()
+	defer s.server.lock.Unlock()
+	s.server.received = append(s.server.received, c.String())
+}
+
+func (s *Session) handle(c Command) ([]Record, error) {
+	s.server.lock.Lock()
+	h, custom := s.server.handlers[c.Name]
+	loginRequired := len(s.server.model.Users) > 0
+	s.server.lock.Unlock()
+	if loginRequired && s.User() == "" && !anonymous[c.Name] {
+		return nil, errNotLoggedIn
+	}
+	if custom {
+		return h(s, c)
+	}
+	h, ok := builtins[c.Name]
+	if !ok {
+		return nil, errCommandNotFound
+	}
+	return h(s, c)
+}
+
+// anonymous commands can be used without login
+var anonymous = map[string]bool{
+	"login":   true,
+	"quit":    true,
+	"version": true,
+	"help":    true,
+}
+
+// String returns c as command line with sorted keys
+func (c Command) String() string {
+	line := c.Name
+	if params := Format(c.Params); params != "" {
+		line += " " + params
+	}
+	if len(c.Flags) > 0 {
+		line += " " + strings.Join(c.Flags, " ")
+	}
+	return line
+}
+
+func (s *Session) write(text string) {
+	if s.conn == nil {
+		return
+	}
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	io.WriteString(s.conn, text+"\n\r")
+}
+
+func (s *Session) registered(n Notification) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if n.ClientID != 0 && (s.client == nil || s.client.ID != n.ClientID) {
+		return false
+	}
+	for _, r := range s.registrations {
+		if r.serverID != n.ServerID || r.event != n.Event {
+			continue
+		}
+		if r.event != "channel" || r.channelID == 0 || r.channelID == n.ChannelID {
+			return true
+		}
+	}
+	return false
+}
+
+// use selects vs and joins it with a query client. s.server.lock must be held
+func (s *Session) use(vs *VirtualServer) {
+	s.leave()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.serverID = vs.ID
+	if s.conn == nil { // webquery has no client
+		return
+	}
+	nickname := s.user
+	if nickname == "" {
+		nickname = "Unknown from 127.0.0.1"
+	}
+	s.client = vs.AddClient(&Client{
+		Nickname:     nickname,
+		Query:        true,
+		ServerGroups: []int{2},
+	})
+}
+
+// leave removes the query client from the selected virtual server. s.server.lock must be held
+func (s *Session) leave() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.client != nil {
+		if vs := s.server.model.Server(s.serverID); vs != nil {
+			vs.RemoveClient(s.client.ID)
+		}
+	}
+	s.client = nil
+	s.serverID = 0
+}
+
+// invoker returns the invoker fields of notifications caused by s
+func (s *Session) invoker() Record {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r := Record{
+		"invokerid":   "0",
+		"invokername": "Server",
+		"invokeruid":  "serveradmin",
+	}
+	if s.client != nil {
+		r["invokerid"] = strconv.Itoa(s.client.ID)
+		r["invokername"] = s.client.Nickname
+		r["invokeruid"] = s.client.UID
+	}
+	return r
+}
@@ -0,0 +1,101 @@
+package tstest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ListenSSH serves the serverquery over ssh on a random local port and returns its address
+// Clients authenticate using the users of the model. The host key is generated once per Server (see HostKey)
+func (s *Server) ListenSSH() (string, error) {
+	signer, err := s.signer()
+	if err != nil {
+		return "", err
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			s.lock.Lock()
+			want, ok := s.model.Users[c.User()]
+			s.lock.Unlock()
+			if !ok || want != string(password) {
+				return nil, errors.New("invalid loginname or password")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	s.addCloser(l)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serveSSH(conn, config)
+		}
+	}()
+	return l.Addr().String(), nil
+}
+
+// HostKey returns the public host key used by ListenSSH
+func (s *Server) HostKey() ssh.PublicKey {
+	signer, err := s.signer()
+	if err != nil {
+		return nil
+	}
+	return signer.PublicKey()
+}
+
+func (s *Server) signer() (ssh.Signer, error) {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+	if s.hostKey != nil {
+		return s.hostKey, nil
+	}
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	s.hostKey, err = ssh.NewSignerFromKey(private)
+	return s.hostKey, err
+}
+
+func (s *Server) serveSSH(conn net.Conn, config *ssh.ServerConfig) {
+	s.addCloser(conn)
+	sc, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sc.Close()
+	go ssh.DiscardRequests(reqs)
+	for c := range chans {
+		if c.ChannelType() != "session" {
+			c.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := c.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			shell := false
+			for r := range requests {
+				start := r.Type == "shell" && !shell
+				r.Reply(start, nil)
+				if start {
+					shell = true
+					go s.ServeConn(channel, sc.User())
+				}
+			}
+		}()
+	}
+}
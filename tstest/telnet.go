@@ -0,0 +1,24 @@
+package tstest
+
+import (
+	"net"
+)
+
+// ListenTelnet serves the raw serverquery on a random local port and returns its address
+func (s *Server) ListenTelnet() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	s.addCloser(l)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.ServeConn(conn, "")
+		}
+	}()
+	return l.Addr().String(), nil
+}
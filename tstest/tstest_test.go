@@ -0,0 +1,359 @@
+package tstest_test
+
+import (
+	"errors"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/communication"
+	"github.com/schoeppi5/libts/middleware"
+	"github.com/schoeppi5/libts/query"
+	"github.com/schoeppi5/libts/serverquery"
+	"github.com/schoeppi5/libts/sshquery"
+	"github.com/schoeppi5/libts/subscriber"
+	"github.com/schoeppi5/libts/tstest"
+	"github.com/schoeppi5/libts/webquery"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func hostPort(t *testing.T, addr string) (string, int) {
+	host, p, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(p)
+	return host, port
+}
+
+// transports returns a query for every transport, all serving the same server
+func transports(t *testing.T, s *tstest.Server) map[string]libts.Query {
+	telnet, err := s.ListenTelnet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port := hostPort(t, telnet)
+	sq, err := serverquery.NewServerQuery(host, port, "serveradmin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sq.Close)
+	addr, err := s.ListenSSH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port = hostPort(t, addr)
+	sshq, err := sshquery.NewSSHQueryWithOptions(sshquery.Options{
+		Host:            host,
+		Port:            port,
+		Username:        "serveradmin",
+		Password:        "secret",
+		HostKeyCallback: ssh.FixedHostKey(s.HostKey()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sshq.Close)
+	web := httptest.NewServer(s.Handler())
+	t.Cleanup(web.Close)
+	u, _ := url.Parse(web.URL)
+	host, port = hostPort(t, u.Host)
+	wq, err := webquery.NewWebQuery(host, port, "key", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]libts.Query{
+		"telnet":   sq,
+		"ssh":      sshq,
+		"webquery": wq,
+	}
+}
+
+func TestTransportsServeTheSameModel(t *testing.T) {
+	// given
+	s := tstest.NewServer()
+	defer s.Close()
+	s.Update(func(m *tstest.Model) {
+		m.Server(1).AddChannel(&tstest.Channel{Name: "Lobby | Main", Topic: "Welcome\\here"})
+	})
+
+	for name, q := range transports(t, s) {
+		a := query.Agent{Query: q}
+
+		// when
+		ids, err := a.ChannelIDList(1)
+		if err != nil {
+			t.Fatalf("Test %s/%s failed!\n\tUnexpected error: %s", t.Name(), name, err)
+		}
+		channel, err := a.Channel(1, 2)
+
+		// then
+		if len(ids) != 2 {
+			t.Errorf("Test %s/%s failed!\n\tHave: %v\n\tWant: %v", t.Name(), name, ids, []int{1, 2})
+		}
+		if err != nil || channel.Name != "Lobby | Main" || channel.Topic != "Welcome\\here" {
+			t.Errorf("Test %s/%s failed!\n\tHave: %+v (%v)\n\tWant: %s", t.Name(), name, channel, err, "Lobby | Main")
+		}
+	}
+}
+
+func TestLoginRequired(t *testing.T) {
+	t.Parallel()
+	// given
+	s := tstest.NewServer()
+	defer s.Close()
+	addr, err := s.ListenTelnet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port := hostPort(t, addr)
+
+	// when
+	_, err = serverquery.NewServerQuery(host, port, "serveradmin", "wrong")
+
+	// then
+	if e, ok := err.(communication.QueryError); !ok || e.ID != 520 {
+		t.Errorf("Test %s failed!\n\tHave: %v\n\tWant: %s", t.Name(), err, "invalid loginname or password")
+	}
+}
+
+func TestEmptyResult(t *testing.T) {
+	// given
+	s := tstest.NewServer()
+	defer s.Close()
+	s.Update(func(m *tstest.Model) {
+		m.Server(1).ServerGroups = nil
+	})
+
+	for name, q := range transports(t, s) {
+		a := query.Agent{Query: q}
+
+		// when
+		_, raw := q.DoRaw(libts.Request{ServerID: 1, Command: "servergrouplist"})
+		groups, err := a.ServerGroupList(1)
+
+		// then
+		var empty communication.EmptyResultError
+		if !errors.As(raw, &empty) || !errors.Is(raw, libts.ErrEmptyResult) {
+			t.Errorf("Test %s/%s failed!\n\tHave: %#v\n\tWant: %s", t.Name(), name, raw, "database empty result set")
+		}
+		if err != nil || groups == nil || len(groups) != 0 {
+			t.Errorf("Test %s/%s failed!\n\tHave: %#v (%v)\n\tWant: %v", t.Name(), name, groups, err, []query.Group{})
+		}
+	}
+}
+
+func TestDoWithoutValue(t *testing.T) {
+	// given
+	s := tstest.NewServer()
+	defer s.Close()
+
+	for name, q := range transports(t, s) {
+		// when
+		err := q.Do(libts.Request{ServerID: 1, Command: "sendtextmessage", Args: map[string]interface{}{"targetmode": 3, "msg": "hello"}}, nil)
+
+		// then
+		if err != nil {
+			t.Errorf("Test %s/%s failed!\n\tHave: %v\n\tWant: %v", t.Name(), name, err, nil)
+		}
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	// given
+	s := tstest.NewServer()
+	defer s.Close()
+	s.Handle("serverstop", func(s *tstest.Session, c tstest.Command) ([]tstest.Record, error) {
+		e := tstest.Error(int(libts.ErrInsufficientPerms), "insufficient client permissions").(communication.QueryError)
+		e.FailedPermID = 4
+		return nil, e
+	})
+
+	for name, q := range transports(t, s) {
+		a := query.Agent{Query: q}
+		mw := middleware.Wrap(q, middleware.ResolvePermissions(q))
+
+		// when
+		_, invalid := a.Channel(1, 99)
+		_, denied := mw.DoRaw(libts.Request{Command: "serverstop", Args: map[string]interface{}{"sid": 1}})
+		perm, err := a.PermissionName(4)
+
+		// then
+		if !errors.Is(invalid, libts.ErrInvalidChannelID) {
+			t.Errorf("Test %s/%s failed!\n\tHave: %v\n\tWant: %v", t.Name(), name, invalid, libts.ErrInvalidChannelID)
+		}
+		var qe communication.QueryError
+		if !errors.As(denied, &qe) || qe.Code() != libts.ErrInsufficientPerms || qe.FailedPermission != "b_serverinstance_info_view" {
+			t.Errorf("Test %s/%s failed!\n\tHave: %v\n\tWant: %s", t.Name(), name, denied, "b_serverinstance_info_view")
+		}
+		if err != nil || perm != "b_serverinstance_info_view" {
+			t.Errorf("Test %s/%s failed!\n\tHave: %s (%v)\n\tWant: %s", t.Name(), name, perm, err, "b_serverinstance_info_view")
+		}
+	}
+}
+
+func TestBulkCommands(t *testing.T) {
+	for _, name := range []string{"telnet", "ssh", "webquery"} {
+		// given
+		s := tstest.NewServer()
+		defer s.Close()
+		var alice, bob *tstest.Client
+		s.Update(func(m *tstest.Model) {
+			alice = m.Server(1).AddClient(&tstest.Client{Nickname: "Alice"})
+			bob = m.Server(1).AddClient(&tstest.Client{Nickname: "Bob"})
+		})
+		a := query.Agent{Query: transports(t, s)[name]}
+
+		// when
+		added, addErr := a.ServerGroupAddClients(1, 6, alice.DBID, 999, bob.DBID)
+		removed, delErr := a.ServerGroupDelClients(1, 6, alice.DBID, bob.DBID)
+		kicked, kickErr := a.KickClients(1, false, "bye", alice.ID, bob.ID)
+
+		// then
+		if addErr != nil || len(added) != 3 {
+			t.Fatalf("Test %s/%s failed!\n\tHave: %v (%v)\n\tWant: %d results", t.Name(), name, added, addErr, 3)
+		}
+		if added[0].Err != nil || !errors.Is(added[1].Err, libts.ErrInvalidClientID) || added[1].Index != 1 || added[2].Err != nil {
+			t.Errorf("Test %s/%s failed!\n\tHave: %v\n\tWant: %s", t.Name(), name, added, "[<nil> invalid clientID <nil>]")
+		}
+		for _, rs := range [][]query.Result{removed, kicked} {
+			if len(rs) != 2 || rs[0].Err != nil || rs[1].Err != nil {
+				t.Errorf("Test %s/%s failed!\n\tHave: %v\n\tWant: %s", t.Name(), name, rs, "[<nil> <nil>]")
+			}
+		}
+		if delErr != nil || kickErr != nil {
+			t.Errorf("Test %s/%s failed!\n\tHave: %v, %v\n\tWant: %v", t.Name(), name, delErr, kickErr, nil)
+		}
+	}
+}
+
+func TestHandle(t *testing.T) {
+	t.Parallel()
+	// given
+	s := tstest.NewServer()
+	defer s.Close()
+	s.Handle("version", func(session *tstest.Session, c tstest.Command) ([]tstest.Record, error) {
+		return []tstest.Record{{"version": "1.0 beta"}}, nil
+	})
+	addr, _ := s.ListenTelnet()
+	host, port := hostPort(t, addr)
+	sq, err := serverquery.NewServerQuery(host, port, "serveradmin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sq.Close()
+
+	// when
+	have, err := sq.DoRaw(libts.Request{Command: "version"})
+
+	// then
+	if err != nil || string(have) != `version=1.0\sbeta` {
+		t.Errorf("Test %s failed!\n\tHave: %s (%v)\n\tWant: %s", t.Name(), have, err, `version=1.0\sbeta`)
+	}
+	received := s.Received()
+	if received[0] != "login client_login_name=serveradmin client_login_password=secret" || received[1] != "version" {
+		t.Errorf("Test %s failed!\n\tHave: %v", t.Name(), received)
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	t.Parallel()
+	// given
+	s := tstest.NewServer()
+	defer s.Close()
+	addr, _ := s.ListenTelnet()
+	host, port := hostPort(t, addr)
+	sq, err := serverquery.NewServerQuery(host, port, "serveradmin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sq.Close()
+	a := subscriber.Agent{Subscriber: communication.NewBasicSubscriber(sq, 1)}
+	joined := make(chan interface{}, 1)
+	messages := make(chan interface{}, 1)
+	_, err = a.ClientJoinedServer(joined)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = a.TextMessage(messages, subscriber.ServerMessages)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// when
+	s.Connect(1, &tstest.Client{Nickname: "Alice"})
+	_, err = sq.DoRaw(libts.Request{
+		ServerID: 1,
+		Command:  "sendtextmessage",
+		Args:     map[string]interface{}{"targetmode": 3, "msg": "hello world"},
+	})
+
+	// then
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-joined:
+		if event, ok := e.(*subscriber.ClientEnterViewEvent); !ok || event.Nickname != "Alice" {
+			t.Errorf("Test %s failed!\n\tHave: %+v\n\tWant: %s", t.Name(), e, "Alice")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Test %s failed!\n\tNo cliententerview received", t.Name())
+	}
+	select {
+	case e := <-messages:
+		if event, ok := e.(*subscriber.TextMessageEvent); !ok || event.Message != "hello world" {
+			t.Errorf("Test %s failed!\n\tHave: %+v\n\tWant: %s", t.Name(), e, "hello world")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Test %s failed!\n\tNo textmessage received", t.Name())
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	t.Parallel()
+	// given
+	line := `clientkick clid=1|clid=2 reasonid=5 reasonmsg=bye\sbye -continueonerror`
+
+	// when
+	c := tstest.ParseCommand(line)
+
+	// then
+	if c.Name != "clientkick" || strings.Join(c.All("clid"), ",") != "1,2" || c.Get("reasonmsg") != "bye bye" || !c.Flag("-continueonerror") {
+		t.Errorf("Test %s failed!\n\tHave: %+v", t.Name(), c)
+	}
+	if c.String() != `clientkick clid=1|clid=2 reasonid=5 reasonmsg=bye\sbye -continueonerror` {
+		t.Errorf("Test %s failed!\n\tHave: %s\n\tWant: %s", t.Name(), c, line)
+	}
+}
+
+func TestCheckFields(t *testing.T) {
+	// given
+	s := tstest.NewServer()
+	defer s.Close()
+	sq := transports(t, s)["telnet"]
+	tests := []struct {
+		request libts.Request
+		value   interface{}
+	}{
+		{libts.Request{ServerID: 1, Command: "serverinfo"}, &query.VirtualServer{}},
+		{libts.Request{ServerID: 1, Command: "channelinfo", Args: map[string]interface{}{"cid": 1}}, &query.Channel{}},
+	}
+
+	for _, test := range tests {
+		// when
+		raw, err := sq.DoRaw(test.request)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// then
+		tstest.CheckFields(t, string(raw), test.value)
+	}
+}
@@ -0,0 +1,135 @@
+package tstest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/schoeppi5/libts/communication"
+)
+
+// webResponse is the json answer of the webquery
+type webResponse struct {
+	Body   []Record                 `json:"body,omitempty"`
+	Status communication.QueryError `json:"status"`
+}
+
+// Handler returns a http.Handler serving the webquery (/{sid}/{command}?api-key=key)
+// Use it with httptest.NewServer
+func (s *Server) Handler() http.Handler {
+	return http.HandlerFunc(s.serveHTTP)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("api-key")
+	if key == "" {
+		key = r.Header.Get("x-api-key")
+	}
+	if !s.validKey(key) {
+		writeWeb(w, http.StatusForbidden, nil, Error(5122, "invalid apikey"))
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	session := &Session{
+		server: s,
+		user:   "apikey",
+	}
+	if len(parts) == 2 {
+		sid, err := strconv.Atoi(parts[0])
+		if err != nil {
+			writeWeb(w, http.StatusNotFound, nil, errInvalidServerID)
+			return
+		}
+		s.lock.Lock()
+		vs := s.model.Server(sid)
+		if vs != nil {
+			session.use(vs)
+		}
+		s.lock.Unlock()
+		if vs == nil {
+			writeWeb(w, http.StatusNotFound, nil, errInvalidServerID)
+			return
+		}
+	}
+	c := Command{
+		Name:   parts[len(parts)-1],
+		Params: []Record{{}},
+	}
+	if r.Body != nil && r.Method == http.MethodPost {
+		args := map[string]interface{}{}
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber() // keep large ids as they are
+		if err := decoder.Decode(&args); err != nil {
+			writeWeb(w, http.StatusBadRequest, nil, errInvalidParameter)
+			return
+		}
+		c = commandFromJSON(c.Name, args)
+	}
+	records, err := session.run(c)
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusBadRequest
+	}
+	writeWeb(w, status, records, err)
+}
+
+func (s *Server) validKey(key string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.model.APIKeys) == 0 {
+		return true
+	}
+	for _, k := range s.model.APIKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// commandFromJSON turns the json arguments of the webquery into a Command. Arrays are split into groups
+func commandFromJSON(name string, args map[string]interface{}) Command {
+	c := Command{
+		Name:   name,
+		Params: []Record{{}},
+	}
+	for k, v := range args {
+		if strings.HasPrefix(k, "-") {
+			c.Flags = append(c.Flags, k)
+			continue
+		}
+		values, ok := v.([]interface{})
+		if !ok {
+			values = []interface{}{v}
+		}
+		for i, value := range values {
+			for len(c.Params) <= i {
+				c.Params = append(c.Params, Record{})
+			}
+			c.Params[i][k] = fmt.Sprint(value)
+		}
+	}
+	return c
+}
+
+func writeWeb(w http.ResponseWriter, status int, records []Record, err error) {
+	resp := webResponse{
+		Body: records,
+		Status: communication.QueryError{
+			Message: "ok",
+		},
+	}
+	if err != nil {
+		var e communication.QueryError
+		if !errors.As(err, &e) {
+			e = communication.QueryError{ID: 1, Message: err.Error()}
+		}
+		resp.Status = e
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
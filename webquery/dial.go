@@ -0,0 +1,38 @@
+package webquery
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/communication"
+)
+
+// default ports of the webquery
+const (
+	defaultPort    = 10080
+	defaultTLSPort = 10443
+)
+
+func init() {
+	libts.Register("http", dial)
+	libts.Register("https", dial)
+}
+
+// dial opens a WebQuery for urls like https://host:10443/?apikey=key&sid=1
+func dial(ctx context.Context, u *url.URL) (libts.Query, error) {
+	tls := u.Scheme == "https"
+	port := defaultPort
+	if tls {
+		port = defaultTLSPort
+	}
+	host, port, err := communication.HostPort(u, port)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := communication.OptionsFromURL(u)
+	if err != nil {
+		return nil, err
+	}
+	return newWebQuery(ctx, host, port, u.Query().Get("apikey"), tls, opts...)
+}
@@ -2,11 +2,14 @@ package webquery
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/schoeppi5/libts"
 	"github.com/schoeppi5/libts/communication"
@@ -21,10 +24,24 @@ type response struct {
 
 // Do executes the given command against TeamSpeak
 func (wq WebQuery) Do(request libts.Request, response interface{}) error {
-	respBody, err := wq.DoRaw(request)
+	return wq.DoContext(context.Background(), request, response)
+}
+
+// DoRaw executes the given command against TeamSpeak and returns the unformated output
+func (wq WebQuery) DoRaw(request libts.Request) ([]byte, error) {
+	return wq.DoRawContext(context.Background(), request)
+}
+
+// DoContext executes the given command against TeamSpeak
+// The http request is bound to ctx
+func (wq WebQuery) DoContext(ctx context.Context, request libts.Request, response interface{}) error {
+	respBody, err := wq.DoRawContext(ctx, request)
 	if err != nil {
 		return err
 	}
+	if request.HasFlag(libts.FlagContinueOnError) {
+		return communication.Unmarshal(respBody, response)
+	}
 	err = unmarshalBody(respBody, response)
 	if err != nil {
 		return err
@@ -32,9 +49,10 @@ func (wq WebQuery) Do(request libts.Request, response interface{}) error {
 	return nil
 }
 
-// DoRaw executes the given command against TeamSpeak and returns the unformated output
-func (wq WebQuery) DoRaw(request libts.Request) ([]byte, error) {
-	resp, err := wq.HTTPClient.Do(wq.marshalRequest(request))
+// DoRawContext executes the given command against TeamSpeak and returns the unformated output
+// The http request is bound to ctx
+func (wq WebQuery) DoRawContext(ctx context.Context, request libts.Request) ([]byte, error) {
+	resp, err := wq.HTTPClient.Do(wq.marshalRequest(request).WithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -49,7 +67,10 @@ func (wq WebQuery) DoRaw(request libts.Request) ([]byte, error) {
 		return nil, err
 	}
 	if body.Status.ID != 0 {
-		return nil, body.Status
+		return nil, communication.ResponseError(body.Status)
+	}
+	if request.HasFlag(libts.FlagContinueOnError) {
+		return itemResponse(body.Body, items(request))
 	}
 	return body.Body, nil
 }
@@ -69,7 +90,13 @@ func (wq WebQuery) Connected() (bool, error) {
 }
 
 func unmarshalBody(body []byte, value interface{}) error {
+	if value == nil {
+		return nil
+	}
 	response := []map[string]interface{}{}
+	if len(bytes.TrimSpace(body)) == 0 { // commands without output have no body
+		return communication.UnmarshalResponse(response, value)
+	}
 	err := json.Unmarshal(body, &response)
 	if err != nil {
 		return err
@@ -78,7 +105,7 @@ func unmarshalBody(body []byte, value interface{}) error {
 	for i := range response {
 		for key := range response[i] {
 			if s, ok := response[i][key].(string); ok {
-				response[i][key] = libts.QueryDecoder.Replace(s)
+				response[i][key] = libts.Unescape(s)
 			}
 		}
 	}
@@ -87,14 +114,16 @@ func unmarshalBody(body []byte, value interface{}) error {
 
 func (wq WebQuery) marshalRequest(r libts.Request) *http.Request {
 	var url string
+	if r.ServerID == 0 {
+		r.ServerID = wq.ServerID
+	}
 	if r.ServerID != 0 {
 		url = wq.url(fmt.Sprintf("%d/%s", r.ServerID, r.Command))
 	} else {
 		url = wq.url(r.Command)
 	}
-	if r.Args != nil {
-		body, _ := json.Marshal(r.Args)
-		req, _ := http.NewRequest("POST", url, bytes.NewReader(body))
+	if r.Args != nil || r.Params != nil {
+		req, _ := http.NewRequest("POST", url, bytes.NewReader(marshalParams(r.Ordered())))
 		return req
 	}
 	req, _ := http.NewRequest("GET", url, nil)
@@ -107,3 +136,90 @@ func (wq WebQuery) url(c string) string {
 	}
 	return fmt.Sprintf("http://%s:%d/%s?api-key=%s", wq.Host, wq.Port, c, wq.Key)
 }
+
+// itemResponse converts body to the line by line response of telnet and ssh for commands sent with -continueonerror (see communication.Results)
+// The webquery doesn't answer the items separately, so either all items succeeded or the whole request failed
+func itemResponse(body []byte, items int) ([]byte, error) {
+	records := []map[string]interface{}{}
+	if len(bytes.TrimSpace(body)) != 0 {
+		err := json.Unmarshal(body, &records)
+		if err != nil {
+			return nil, err
+		}
+	}
+	lines := make([]string, len(records))
+	for i, record := range records {
+		keys := make([]string, 0, len(record))
+		for k := range record {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for j, k := range keys {
+			value := libts.Unescape(fmt.Sprint(record[k]))
+			pairs[j] = k + "=" + libts.Escape(value)
+		}
+		lines[i] = strings.Join(pairs, " ")
+	}
+	if len(lines) != items { // the data can't be assigned to the items
+		lines = []string{strings.Join(lines, "|")}
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// items returns the number of items of r (clid=1|clid=2)
+func items(r libts.Request) int {
+	if n := len(r.Ordered().Records); n > 1 {
+		return n
+	}
+	return 1
+}
+
+// marshalParams returns p as json object keeping the order of p
+// Keys of the records and keys with multiple values are sent as a single array, flags with an empty value
+func marshalParams(p *libts.Params) []byte {
+	keys := []string{}
+	values := map[string][]interface{}{}
+	lists := map[string]bool{} // keys sent as array
+	add := func(key string, value interface{}) {
+		if _, ok := values[key]; ok {
+			lists[key] = true
+		} else {
+			keys = append(keys, key)
+		}
+		values[key] = append(values[key], value)
+	}
+	for _, a := range p.Pairs {
+		add(a.Key, a.Value)
+	}
+	for _, r := range p.Records {
+		for _, a := range r {
+			add(a.Key, a.Value)
+			lists[a.Key] = true
+		}
+	}
+	for _, f := range p.Flags {
+		if _, ok := values[string(f)]; !ok {
+			add(string(f), "")
+		}
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		var value []byte
+		if lists[k] {
+			value, _ = json.Marshal(values[k])
+		} else {
+			value, _ = json.Marshal(values[k][0])
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
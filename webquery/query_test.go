@@ -0,0 +1,59 @@
+package webquery
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/schoeppi5/libts"
+)
+
+func TestMarshalRequest(t *testing.T) {
+	t.Parallel()
+	// given
+	wq := WebQuery{Host: "localhost", Port: 10080, Key: "key"}
+	r := libts.Request{
+		ServerID: 1,
+		Command:  "clientkick",
+		Args: map[string]interface{}{
+			"-continueonerror": "",
+			"reasonmsg":        "bye",
+			"clid":             []int{1, 2},
+			"reasonid":         5,
+		},
+	}
+	want := `{"reasonid":5,"reasonmsg":"bye","clid":[1,2],"-continueonerror":""}`
+
+	for i := 0; i < 10; i++ { // map iteration is random
+		// when
+		req := wq.marshalRequest(r)
+		body, _ := ioutil.ReadAll(req.Body)
+
+		// then
+		if string(body) != want {
+			t.Fatalf("Test %s failed!\n\tHave: %s\n\tWant: %s", t.Name(), body, want)
+		}
+		if req.URL.Path != "/1/clientkick" {
+			t.Errorf("Test %s failed!\n\tHave: %s\n\tWant: %s", t.Name(), req.URL.Path, "/1/clientkick")
+		}
+	}
+}
+
+func TestMarshalParamsMergesKeys(t *testing.T) {
+	t.Parallel()
+	// given
+	p := libts.NewParams().
+		Add("cid", 1).
+		Add("clid", 5).
+		Add("cid", 2).
+		Record(libts.Arg{Key: "clid", Value: 6}).
+		Record(libts.Arg{Key: "clid", Value: 7})
+
+	// when
+	have := string(marshalParams(p))
+
+	// then
+	want := `{"cid":[1,2],"clid":[5,6,7]}`
+	if have != want {
+		t.Errorf("Test %s failed!\n\tHave: %s\n\tWant: %s", t.Name(), have, want)
+	}
+}
@@ -3,7 +3,11 @@ package webquery
 // This file contains the basic structs and helper funcs
 
 import (
+	"context"
 	"net/http"
+
+	"github.com/schoeppi5/libts"
+	"github.com/schoeppi5/libts/communication"
 )
 
 // WebQuery stores info for webquery connections
@@ -13,4 +17,46 @@ type WebQuery struct {
 	Key        string
 	TLS        bool
 	HTTPClient *http.Client
+	// ServerID is used for requests without a ServerID
+	ServerID int
+}
+
+// NewWebQuery returns a WebQuery configured by opts
+// Dialer, DialTimeout and KeepAlive configure the transport of the http client, Timeout limits every http request
+// ServerPort is resolved to the ServerID right away. NotificationBuffer, Nickname and ReconnectPolicy are not supported
+func NewWebQuery(host string, port int, key string, tls bool, opts ...communication.Option) (*WebQuery, error) {
+	return newWebQuery(context.Background(), host, port, key, tls, opts...)
+}
+
+func newWebQuery(ctx context.Context, host string, port int, key string, tls bool, opts ...communication.Option) (*WebQuery, error) {
+	options := communication.Options{}.Apply(opts...)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = options.DialContext
+	wq := &WebQuery{
+		Host: host,
+		Port: port,
+		Key:  key,
+		TLS:  tls,
+		HTTPClient: &http.Client{
+			Transport: transport,
+			Timeout:   options.Timeout,
+		},
+		ServerID: options.ServerID,
+	}
+	if wq.ServerID == 0 && options.ServerPort != 0 {
+		server := struct {
+			ID int `mapstructure:"server_id"`
+		}{}
+		err := wq.DoContext(ctx, libts.Request{
+			Command: "serveridgetbyport",
+			Args: map[string]interface{}{
+				"virtualserver_port": options.ServerPort,
+			},
+		}, &server)
+		if err != nil {
+			return nil, err
+		}
+		wq.ServerID = server.ID
+	}
+	return wq, nil
 }